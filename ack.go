@@ -0,0 +1,192 @@
+package amqpx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// WithAckEvery batches acknowledgements: instead of one basic.ack per delivery,
+// the consumer acks with the multiple flag once n deliveries have been handled
+// or maxDelay has passed, whichever comes first. Only the highest contiguous
+// tag is acked, so a multiple ack never covers a delivery that is still being
+// processed or that was rejected; rejects flush pending acks before being sent.
+// The OnAck hook and the acked count do not wait for the flush.
+//
+// The prefetch count is raised to at least n, or the broker would stop
+// delivering before a batch is complete. Both n and maxDelay must be positive:
+// AddFunc and friends fail with ErrInvalidOption otherwise.
+func WithAckEvery(n int, maxDelay time.Duration) EntryOption {
+	return func(e *entry) {
+		if n <= 0 || maxDelay <= 0 {
+			e.invalid = fmt.Errorf("%w: WithAckEvery(%d, %s)", ErrInvalidOption, n, maxDelay)
+			return
+		}
+		e.ackEvery = n
+		e.ackDelay = maxDelay
+	}
+}
+
+// ackBatcher is an amqp.Acknowledger that coalesces acks into multiple acks.
+type ackBatcher struct {
+	mu       sync.Mutex
+	ch       amqp.Acknowledger
+	every    int
+	maxDelay time.Duration
+	timer    *time.Timer
+
+	next     uint64          // lowest delivery tag not yet settled
+	ackable  uint64          // highest tag that can be acked with the multiple flag
+	acked    uint64          // highest tag acked with the multiple flag
+	settled  map[uint64]bool // tags settled out of order: true if acked, false if rejected
+	pending  int             // acks not yet sent to the broker
+	flushErr error           // error of the last flush triggered by the timer
+}
+
+func newAckBatcher(ch amqp.Acknowledger, every int, maxDelay time.Duration) *ackBatcher {
+	return &ackBatcher{
+		ch:       ch,
+		every:    every,
+		maxDelay: maxDelay,
+		settled:  make(map[uint64]bool),
+	}
+}
+
+// track routes the acknowledgements of dely through the batcher. Deliveries
+// must be tracked in the order they were received.
+func (b *ackBatcher) track(dely *amqp.Delivery) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.next == 0 {
+		b.next = dely.DeliveryTag
+		b.ackable = dely.DeliveryTag - 1
+		b.acked = b.ackable
+	}
+	dely.Acknowledger = b
+}
+
+// Ack records tag as acked and flushes once enough acks are pending.
+func (b *ackBatcher) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if multiple {
+		if err := b.flushLocked(); err != nil {
+			return err
+		}
+		if err := b.ch.Ack(tag, true); err != nil {
+			return err
+		}
+		b.settleThrough(tag)
+		b.acked = max(b.acked, tag)
+		return nil
+	}
+	b.settle(tag, true)
+	b.pending++
+	if b.pending >= b.every {
+		return b.flushLocked()
+	}
+	if b.timer == nil && b.maxDelay > 0 {
+		b.timer = time.AfterFunc(b.maxDelay, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.timer = nil
+			b.flushErr = b.flushLocked()
+		})
+	}
+	return nil
+}
+
+// Nack flushes pending acks and then nacks tag.
+func (b *ackBatcher) Nack(tag uint64, multiple bool, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.flushLocked(); err != nil {
+		return err
+	}
+	if err := b.ch.Nack(tag, multiple, requeue); err != nil {
+		return err
+	}
+	if multiple {
+		b.settleThrough(tag)
+	} else {
+		b.settle(tag, false)
+	}
+	return nil
+}
+
+// Reject flushes pending acks and then rejects tag.
+func (b *ackBatcher) Reject(tag uint64, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.flushLocked(); err != nil {
+		return err
+	}
+	if err := b.ch.Reject(tag, requeue); err != nil {
+		return err
+	}
+	b.settle(tag, false)
+	return nil
+}
+
+// Flush sends pending acks for the contiguous range of settled tags.
+func (b *ackBatcher) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if err := b.flushLocked(); err != nil {
+		return err
+	}
+	return b.flushErr
+}
+
+// settle marks tag as settled and advances the contiguous range.
+func (b *ackBatcher) settle(tag uint64, ack bool) {
+	b.settled[tag] = ack
+	b.advance()
+}
+
+// settleThrough marks the tags up to tag as settled by a multiple ack or nack
+// sent to the channel, and advances the contiguous range past them.
+func (b *ackBatcher) settleThrough(tag uint64) {
+	for ; b.next <= tag; b.next++ {
+		delete(b.settled, b.next)
+	}
+	b.advance()
+}
+
+// advance moves the contiguous range over the tags settled out of order.
+func (b *ackBatcher) advance() {
+	for {
+		ack, ok := b.settled[b.next]
+		if !ok {
+			return
+		}
+		delete(b.settled, b.next)
+		if ack {
+			b.ackable = b.next
+		}
+		b.next++
+	}
+}
+
+func (b *ackBatcher) flushLocked() error {
+	if b.ackable <= b.acked {
+		return nil
+	}
+	if err := b.ch.Ack(b.ackable, true); err != nil {
+		return err
+	}
+	b.acked = b.ackable
+	b.pending = 0
+	return nil
+}
@@ -0,0 +1,120 @@
+package amqpx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAcknowledger records the acknowledgements sent to the channel.
+type recordingAcknowledger struct {
+	ops []string
+}
+
+func (r *recordingAcknowledger) Ack(tag uint64, multiple bool) error {
+	r.ops = append(r.ops, fmt.Sprintf("ack %d %t", tag, multiple))
+	return nil
+}
+
+func (r *recordingAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	r.ops = append(r.ops, fmt.Sprintf("nack %d %t %t", tag, multiple, requeue))
+	return nil
+}
+
+func (r *recordingAcknowledger) Reject(tag uint64, requeue bool) error {
+	r.ops = append(r.ops, fmt.Sprintf("reject %d %t", tag, requeue))
+	return nil
+}
+
+func trackedDeliveries(b *ackBatcher, first, n uint64) []amqp.Delivery {
+	deliveries := make([]amqp.Delivery, 0, n)
+	for tag := first; tag < first+n; tag++ {
+		d := amqp.Delivery{DeliveryTag: tag}
+		b.track(&d)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries
+}
+
+func TestAckBatcherContiguous(t *testing.T) {
+	ch := &recordingAcknowledger{}
+	b := newAckBatcher(ch, 3, 0)
+	d := trackedDeliveries(b, 1, 6)
+
+	// Out of order: tag 1 is still in flight, nothing can be acked yet.
+	require.NoError(t, d[1].Ack(false))
+	require.NoError(t, d[2].Ack(false))
+	require.NoError(t, d[3].Ack(false))
+	require.Empty(t, ch.ops)
+
+	require.NoError(t, d[0].Ack(false))
+	require.Equal(t, []string{"ack 4 true"}, ch.ops)
+
+	require.NoError(t, d[4].Ack(false))
+	require.NoError(t, b.Flush())
+	require.Equal(t, []string{"ack 4 true", "ack 5 true"}, ch.ops)
+}
+
+func TestAckBatcherRejectFlushesFirst(t *testing.T) {
+	ch := &recordingAcknowledger{}
+	b := newAckBatcher(ch, 10, 0)
+	d := trackedDeliveries(b, 7, 4)
+
+	require.NoError(t, d[0].Ack(false))
+	require.NoError(t, d[2].Ack(false))
+	require.NoError(t, d[1].Reject(true))
+	require.NoError(t, d[3].Ack(false))
+	require.NoError(t, b.Flush())
+
+	require.Equal(t, []string{"ack 7 true", "reject 8 true", "ack 10 true"}, ch.ops)
+}
+
+func BenchmarkAckIndividual(b *testing.B) {
+	ch := &recordingAcknowledger{}
+	for i := 0; i < b.N; i++ {
+		amqp.Delivery{Acknowledger: ch, DeliveryTag: uint64(i + 1)}.Ack(false)
+	}
+	b.ReportMetric(float64(len(ch.ops))/float64(b.N), "channel-ops/msg")
+}
+
+func BenchmarkAckEvery(b *testing.B) {
+	ch := &recordingAcknowledger{}
+	batcher := newAckBatcher(ch, 100, 0)
+	for i := 0; i < b.N; i++ {
+		d := amqp.Delivery{DeliveryTag: uint64(i + 1)}
+		batcher.track(&d)
+		d.Ack(false)
+	}
+	batcher.Flush()
+	b.ReportMetric(float64(len(ch.ops))/float64(b.N), "channel-ops/msg")
+}
+
+func TestWithAckEveryInvalid(t *testing.T) {
+	ac := &AmqpxConsumer{entries: map[string]*entry{}}
+	noop := func(amqp.Delivery) error { return nil }
+
+	_, err := ac.AddDeliveryFunc("orders", "c", noop, WithAckEvery(0, time.Second))
+	require.ErrorIs(t, err, ErrInvalidOption)
+	_, err = ac.AddDeliveryFunc("orders", "c", noop, WithAckEvery(10, 0))
+	require.ErrorIs(t, err, ErrInvalidOption)
+	_, err = ac.AddDeliveryFunc("orders", "c", noop, WithAckEvery(10, 0), WithStreamOffset("first"), WithPrefetch(10))
+	require.ErrorIs(t, err, ErrInvalidOption, "not cleared by a valid option")
+
+	tag, err := ac.AddDeliveryFunc("orders", "c", noop, WithAckEvery(10, time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 10, ac.entries[tag].ackEvery)
+}
+
+func TestAckBatcherMultiple(t *testing.T) {
+	ch := &recordingAcknowledger{}
+	b := newAckBatcher(ch, 2, 0)
+	d := trackedDeliveries(b, 1, 5)
+
+	require.NoError(t, d[2].Ack(true))
+	require.NoError(t, d[3].Ack(false))
+	require.NoError(t, d[4].Ack(false))
+	require.Equal(t, []string{"ack 3 true", "ack 5 true"}, ch.ops, "the range continues after a multiple ack")
+}
@@ -0,0 +1,29 @@
+package amqpx
+
+import "fmt"
+
+// UnroutableQueue returns the name of the queue DeclareExchangeWithAE binds to
+// the alternate exchange aeName to hold the unroutable messages.
+func UnroutableQueue(aeName string) string {
+	return aeName + ".unroutable"
+}
+
+// DeclareExchangeWithAE declares the durable exchange name of type kind with
+// the durable fanout exchange aeName as alternate exchange, and the durable
+// queue UnroutableQueue(aeName) bound to it, so that the messages name cannot
+// route are kept there for inspection. Declaring the same set again is
+// harmless, and with EnableTopologyRecovery it is declared again after a
+// reconnect.
+func (ad *Amqpx) DeclareExchangeWithAE(name, kind, aeName string) error {
+	if err := ad.declareExchange(ExchangeSpec{Name: aeName, Kind: ExchangeFanout, Durable: true}); err != nil {
+		return fmt.Errorf("amqpd declare alternate exchange err: %w", err)
+	}
+	queue := UnroutableQueue(aeName)
+	if _, err := ad.declareQueue(QueueSpec{Name: queue, Durable: true}); err != nil {
+		return fmt.Errorf("amqpd declare unroutable queue err: %w", err)
+	}
+	if err := ad.bind(BindingSpec{Queue: queue, Exchange: aeName}); err != nil {
+		return fmt.Errorf("amqpd bind unroutable queue err: %w", err)
+	}
+	return ad.ExchangeDeclareWithOptions(name, kind, WithAlternateExchange(aeName))
+}
@@ -0,0 +1,41 @@
+package amqpx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeclareExchangeWithAE(t *testing.T) {
+	const (
+		exchange = "test_ae_primary"
+		ae       = "test_ae_alternate"
+		queue    = "test_ae_routed"
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	defer cli.ExchangeDelete(exchange, false)
+	defer cli.ExchangeDelete(ae, false)
+	defer cli.QueueDelete(UnroutableQueue(ae), false, false)
+	_, _ = cli.QueuePurge(UnroutableQueue(ae))
+
+	require.NoError(t, cli.DeclareExchangeWithAE(exchange, ExchangeDirect, ae))
+	require.NoError(t, cli.DeclareExchangeWithAE(exchange, ExchangeDirect, ae), "declaring again")
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithQueueAutoDelete())
+	require.NoError(t, err)
+	defer cli.QueueDelete(queue, false, false)
+	require.NoError(t, cli.QueueBind(queue, "known", exchange))
+
+	require.NoError(t, cli.Publish(exchange, "known", []byte("routed")))
+	require.NoError(t, cli.Publish(exchange, "unknown", []byte("unroutable")))
+	require.Eventually(t, func() bool {
+		d, ok, err := cli.channel.Get(UnroutableQueue(ae), true)
+		return err == nil && ok && string(d.Body) == "unroutable"
+	}, time.Second*5, time.Millisecond*50)
+	info, err := cli.QueueInspect(queue)
+	require.NoError(t, err)
+	require.Equal(t, 1, info.Messages)
+}
@@ -0,0 +1,104 @@
+package amqpx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HeaderKeyID is the header in which AESGCM stores the id of the key that
+// encrypted a message.
+const HeaderKeyID = "x-amqpx-key-id"
+
+// KeyProvider provides the keys of AESGCM. Keys are 16, 24 or 32 bytes long,
+// selecting AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the key encrypting new messages and its id.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key of the given id, to decrypt messages encrypted
+	// with it, including after it stopped being the current one.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding its keys in memory.
+type StaticKeys struct {
+	Current string            // id of the current key
+	Keys    map[string][]byte // keys by id
+}
+
+// CurrentKey implements KeyProvider.
+func (s StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := s.Key(s.Current)
+	return s.Current, key, err
+}
+
+// Key implements KeyProvider.
+func (s StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// AESGCM is a Transformer encrypting message bodies with AES-GCM. The body is
+// prefixed with a random nonce, and the id of the key is stored in the
+// HeaderKeyID header and authenticated, so that keys can be rotated.
+type AESGCM struct {
+	Keys KeyProvider
+}
+
+// Encode implements Transformer.
+func (a AESGCM) Encode(body []byte, msg *amqp.Publishing) ([]byte, error) {
+	id, key, err := a.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(body)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	msg.Headers[HeaderKeyID] = id
+	return aead.Seal(nonce, nonce, body, []byte(id)), nil
+}
+
+// Decode implements Transformer.
+func (a AESGCM) Decode(d amqp.Delivery) ([]byte, error) {
+	id, ok := d.Headers[HeaderKeyID].(string)
+	if !ok {
+		return nil, errors.New("missing " + HeaderKeyID + " header")
+	}
+	key, err := a.Keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Body) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := d.Body[:aead.NonceSize()], d.Body[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(id))
+}
+
+// newGCM returns the AES-GCM AEAD of key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
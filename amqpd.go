@@ -1,22 +1,103 @@
 package amqpx
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type Amqpx struct {
-	channel *amqp.Channel
-	stop    chan struct{}
+	channel    *amqp.Channel
+	stop       chan struct{}
+	redialDone chan struct{} // closed when redial returns
+
+	invalid error // error of an option, returned by New
+
+	url    string // set by WithURL or WithConfig, empty to use the package Connection
+	connMu sync.Mutex
+	conn   *amqp.Connection // dialed from url
+	blocks *blockState      // of conn, see blockState
+
+	cancelMu   sync.Mutex
+	cancelSubs map[string]func() // consumer tag to broker cancellation callback
+
+	readyMu sync.Mutex
+	ready   chan struct{} // closed while the channel is open
+
+	closeOnce sync.Once
+	closeErr  error
+
+	metrics atomic.Value // metricsHolder set by SetMetrics
+
+	publishMu      sync.Mutex
+	sendChain      atomic.Pointer[PublishFunc] // built by publisher
+	interceptors   []PublishInterceptor
+	customPipeline bool          // interceptors set by SetPublishInterceptors, including the built-in ones
+	deliveryMode   atomic.Uint32 // set by SetDefaultDeliveryMode
+	appID          atomic.Value  // string set by SetAppID
+	maxRetries     int           // publish retries, set by SetPublishRetry
+	retryBackoff   Backoff
+	pool           *channelPool // set by SetPublishPool
+	breaker        *breaker     // set by WithCircuitBreaker
+	maxMessageSize int          // set by SetMaxMessageSize
+	validator      Validator    // set by SetValidator
+	strictRouting  atomic.Bool  // set by SetStrictRouting
+
+	delayMu      sync.Mutex
+	delayBuckets []time.Duration     // set by SetDelayBuckets, sorted
+	delayQueues  map[string]struct{} // wait queues declared by PublishWithDelay
+
+	confirms  atomic.Bool                    // put every channel in confirm mode, set by EnableConfirms
+	tracker   atomic.Pointer[confirmTracker] // messages of PublishAsync awaiting confirmation
+	onConfirm func(tag uint64, acked bool, msg PublishedMessage)
+
+	returns     atomic.Pointer[returnListener] // listener of the current channel
+	returnSeq   atomic.Uint64                  // last HeaderReturnID of PublishMandatory
+	returnMu    sync.Mutex
+	returnWaits map[string]chan amqp.Return // PublishMandatory calls by HeaderReturnID
+	returnHook  func(amqp.Return)
+
+	draining   atomic.Bool // set by Drain
+	publishing inFlight    // messages being published or awaiting confirmation
+
+	onBlocked   func(reason string) // guarded by the mu of blockState
+	onUnblocked func()
+
+	topologyMu sync.Mutex
+	topologies []Topology // declared again by redial, see ApplyTopology
+	recovery   recovery   // declarations recorded by EnableTopologyRecovery
+	ephemeral  ephemeralQueues
+
+	fullMu     sync.Mutex
+	fullRoutes map[route]string // routes to the queues rejecting messages when full
 }
 
-// New creates a new Amqpx instance and initializes its channel.
-func New() (*Amqpx, error) {
+// Option configures an Amqpx created by New.
+type Option func(*Amqpx)
+
+// New creates a new Amqpx instance and initializes its channel. The channel is
+// opened on the package Connection, set up by Init from GlobalConfig, unless
+// WithURL or WithConfig gives the instance a connection of its own.
+func New(opts ...Option) (*Amqpx, error) {
 	ad := &Amqpx{
-		stop: make(chan struct{}),
+		stop:       make(chan struct{}),
+		redialDone: make(chan struct{}),
+		ready:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ad)
+	}
+	if ad.invalid != nil {
+		return nil, ad.invalid
+	}
+	if ad.url != "" {
+		ad.blocks = newBlockState()
 	}
 	if err := ad.initChannel(); err != nil {
 		return nil, err
@@ -27,33 +108,116 @@ func New() (*Amqpx, error) {
 
 // initChannel initializes the AMQP channel for the Amqpx instance.
 func (ad *Amqpx) initChannel() error {
-	if Connection == nil || Connection.IsClosed() {
-		// amqpd connection
-		if err := Init(); err != nil {
-			return fmt.Errorf("amqpd connection error: %s", err)
-		}
+	conn, err := ad.dial()
+	if err != nil {
+		return fmt.Errorf("amqpd connection error: %s", err)
 	}
 	if ad.channel != nil && !ad.channel.IsClosed() {
 		ad.channel.Close()
 	}
 	// In a situation where Close is not called, there can be up to 2047 simultaneous channels.
-	channel, err := Connection.Channel()
+	channel, err := conn.Channel()
 	if err != nil {
 		return fmt.Errorf("open channel error: %s", err)
 	}
+	select {
+	case <-ad.stop:
+		// Close ran while dialing: the instance gets no new channel.
+		channel.Close()
+		return fmt.Errorf("open channel error: %w", amqp.ErrClosed)
+	default:
+	}
+	var tracker *confirmTracker
+	if ad.confirms.Load() {
+		if tracker, err = ad.confirmMode(channel); err != nil {
+			channel.Close()
+			return fmt.Errorf("confirm mode error: %s", err)
+		}
+	}
 	ad.channel = channel
+	ad.tracker.Store(tracker)
+	ad.returns.Store(ad.listenReturns(channel))
+	go ad.dispatchCancels(channel.NotifyCancel(make(chan string, 1)))
+	ad.reapplyTopology()
+	// Before recovery, which would bind the queues replaced otherwise.
+	renames := ad.redeclareEphemeralQueues()
+	ad.recoverTopology()
+	ad.setReady(true)
+	ad.ephemeralQueuesChanged(renames)
 	return nil
 }
 
-// redial monitors the channel and re-establishes it if it's closed.
+// setReady records whether the channel is open, waking up the waiters of
+// channelReady when it becomes so.
+func (ad *Amqpx) setReady(ready bool) {
+	ad.readyMu.Lock()
+	defer ad.readyMu.Unlock()
+
+	select {
+	case <-ad.ready:
+		if !ready {
+			ad.ready = make(chan struct{})
+		}
+	default:
+		if ready {
+			close(ad.ready)
+		}
+	}
+}
+
+// channelReady returns a channel that is closed once the AMQP channel is open,
+// which is immediately unless it is being re-established by redial.
+func (ad *Amqpx) channelReady() <-chan struct{} {
+	if ad.channel.IsClosed() {
+		ad.setReady(false)
+	}
+	ad.readyMu.Lock()
+	defer ad.readyMu.Unlock()
+
+	return ad.ready
+}
+
+// dispatchCancels forwards basic.cancel notifications sent by the broker to the
+// callback registered for the consumer tag, until the channel is closed.
+func (ad *Amqpx) dispatchCancels(cancels <-chan string) {
+	for tag := range cancels {
+		ad.cancelMu.Lock()
+		fn := ad.cancelSubs[tag]
+		ad.cancelMu.Unlock()
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// onCancel registers fn to be called when the broker cancels the consumer tag,
+// for instance because its queue was deleted. A nil fn removes the registration.
+func (ad *Amqpx) onCancel(tag string, fn func()) {
+	ad.cancelMu.Lock()
+	defer ad.cancelMu.Unlock()
+
+	if fn == nil {
+		delete(ad.cancelSubs, tag)
+		return
+	}
+	if ad.cancelSubs == nil {
+		ad.cancelSubs = make(map[string]func())
+	}
+	ad.cancelSubs[tag] = fn
+}
+
+// redial monitors the channel and re-establishes it if it's closed, until
+// Close is called.
 func (ad *Amqpx) redial() {
+	defer close(ad.redialDone)
 	printf := func(format string, v ...any) { log.Printf("amqpd-redial: "+format, v...) }
 	for {
 		select {
 		case <-ad.stop:
 			return
-		case closeErr := <-ad.channel.NotifyClose(make(chan *amqp.Error)):
+		case closeErr := <-ad.channel.NotifyClose(make(chan *amqp.Error, 1)):
 			printf("channel closing: %s", closeErr)
+			ad.setReady(false)
 			for {
 				select {
 				case <-ad.stop:
@@ -61,13 +225,21 @@ func (ad *Amqpx) redial() {
 				default:
 				}
 				printf("reconnecting...")
-				if err := ad.initChannel(); err != nil {
-					printf("reconnect error: %s", err)
-					time.Sleep(time.Second * 10)
-					continue
+				err := ad.initChannel()
+				if err == nil {
+					printf("channel re-established")
+					ad.collector().IncReconnect()
+					if ad.breaker != nil {
+						ad.breaker.reset()
+					}
+					break
+				}
+				printf("reconnect error: %s", err)
+				select {
+				case <-ad.stop:
+					return
+				case <-time.After(time.Second * 10):
 				}
-				printf("channel re-established")
-				break
 			}
 		}
 	}
@@ -78,34 +250,116 @@ func (ad *Amqpx) Cancel(consumer string) error {
 	return ad.channel.Cancel(consumer, false)
 }
 
-// Close closes the Amqpx instance's channel and stops the redialing process.
+// queueExists checks with a passive declare whether the queue exists.
+func (ad *Amqpx) queueExists(name string) (bool, error) {
+	err := ad.throwaway(func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclarePassive(name, false, false, false, false, nil)
+		return err
+	})
+	var ae *amqp.Error
+	if errors.As(err, &ae) && ae.Code == amqp.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// throwaway runs fn on a channel of its own, closed afterwards, so that a
+// passive declare failing with 404 closes it instead of the shared channel.
+func (ad *Amqpx) throwaway(fn func(ch *amqp.Channel) error) error {
+	ch, err := ad.openChannel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	return fn(ch)
+}
+
+// Close closes the Amqpx instance's channel, and its connection if it has one
+// of its own, and stops the redialing process. The package Connection is left
+// open for the other instances. Subsequent calls do nothing and return the
+// result of the first one.
+//
+// If the channel is being re-established, Close waits for the attempt to end,
+// so that no channel is opened once Close has returned.
 func (ad *Amqpx) Close() error {
-	ad.stop <- struct{}{}
-	return ad.channel.Close()
+	ad.closeOnce.Do(func() {
+		close(ad.stop)
+		if ad.redialDone != nil {
+			<-ad.redialDone
+		}
+		ad.OnBlocked(nil)
+		ad.OnUnblocked(nil)
+		ad.SetPublishPool(0)
+		if !ad.channel.IsClosed() {
+			ad.closeErr = ad.channel.Close()
+		}
+		if err := ad.closeConnection(); ad.closeErr == nil {
+			ad.closeErr = err
+		}
+	})
+	return ad.closeErr
 }
 
-// DeclareExchange declares an exchange on the AMQP server with the given name and type.
+// ExchangeDeclare declares a durable exchange on the AMQP server with the given
+// name and type, which may be a plugin type, see ExchangeDeclareWithOptions.
 func (ad *Amqpx) ExchangeDeclare(name string, kind string) error {
-	return ad.channel.ExchangeDeclare(name, kind, true, false, false, false, nil)
+	return ad.ExchangeDeclareWithOptions(name, kind, WithCustomKind())
 }
 
 // Publish publishes a message to the specified exchange with the given routing key.
-func (ad *Amqpx) Publish(exchange, key string, body []byte) error {
-	return ad.channel.Publish(exchange, key, false, false,
-		amqp.Publishing{ContentType: "text/plain", Body: body})
+// The message is a transient "text/plain" one unless opts say otherwise.
+func (ad *Amqpx) Publish(exchange, key string, body []byte, opts ...PublishOption) error {
+	return ad.PublishWithContext(context.Background(), exchange, key, body, opts...)
+}
+
+// PublishWithContext is like Publish but gives up with ctx.Err() as soon as ctx
+// is done, e.g. while the connection is flow-controlled. The message may still
+// reach the broker after PublishWithContext returned on cancellation.
+func (ad *Amqpx) PublishWithContext(ctx context.Context, exchange, key string, body []byte, opts ...PublishOption) error {
+	msg := ad.newPublishing(body, opts)
+	return ad.publisher()(ctx, exchange, key, msg)
+}
+
+// publish publishes a fully populated amqp.Publishing on the instance's channel.
+func (ad *Amqpx) publish(exchange, key string, msg amqp.Publishing) error {
+	return ad.publisher()(context.Background(), exchange, key, &msg)
 }
 
-// QueueDeclare declares a queue with the given name on the AMQP server.
+// QueueDeclare declares a durable queue with the given name on the AMQP server,
+// see QueueDeclareWithOptions.
 func (ad *Amqpx) QueueDeclare(name string) (amqp.Queue, error) {
-	return ad.channel.QueueDeclare(name, true, false, false, false, nil)
+	return ad.QueueDeclareWithOptions(name)
 }
 
 // QueueBind binds a queue to an exchange with a routing key.
 func (ad *Amqpx) QueueBind(name, key, exchange string) error {
-	return ad.channel.QueueBind(name, key, exchange, false, nil)
+	return ad.QueueBindWithArgs(name, key, exchange, nil)
+}
+
+// QueueBindWithArgs is like QueueBind with binding arguments, such as those
+// built by MatchAll and MatchAny for a headers exchange.
+func (ad *Amqpx) QueueBindWithArgs(name, key, exchange string, args amqp.Table) error {
+	return ad.bind(BindingSpec{Queue: name, Exchange: exchange, Key: key, Args: args})
+}
+
+// Qos sets the prefetch count for consumers subsequently started on the channel.
+func (ad *Amqpx) Qos(prefetchCount int) error {
+	return ad.channel.Qos(prefetchCount, 0, false)
 }
 
 // Consume starts consuming messages from a queue identified by its name.
 func (ad *Amqpx) Consume(queue, consumer string) (<-chan amqp.Delivery, error) {
-	return ad.channel.Consume(queue, consumer, false, false, false, false, nil)
+	return ad.ConsumeWithOptions(queue, consumer, ConsumeOptions{})
+}
+
+// ConsumeOptions holds the flags of a basic.consume.
+type ConsumeOptions struct {
+	AutoAck   bool       // the broker considers deliveries acknowledged as soon as they are sent
+	Exclusive bool       // request to be the only consumer of the queue
+	Args      amqp.Table // consumer arguments such as x-priority or x-stream-offset
+}
+
+// ConsumeWithOptions starts consuming messages from a queue with the given options.
+func (ad *Amqpx) ConsumeWithOptions(queue, consumer string, opts ConsumeOptions) (<-chan amqp.Delivery, error) {
+	return ad.channel.Consume(queue, consumer, opts.AutoAck, opts.Exclusive, false, false, opts.Args)
 }
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -48,7 +49,8 @@ func TestAmqpxConsumer(t *testing.T) {
 
 	ac, err := NewAmqpxConsumer()
 	require.NoError(t, err)
-	ac.AddFunc("test_queues", "test-consumer", fn)
+	_, err = ac.AddFunc("test_queues", "test-consumer", fn)
+	require.NoError(t, err)
 
 	go func() {
 		time.Sleep(time.Millisecond * 100)
@@ -56,7 +58,144 @@ func TestAmqpxConsumer(t *testing.T) {
 		fmt.Println("ac stop...")
 		cancel()
 	}()
-	ac.Start()
+	require.NoError(t, ac.Start())
 
 	<-ctx.Done()
 }
+
+func TestAmqpxConsumerDelivery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fn := func(d amqp.Delivery) error {
+		fmt.Println(d.RoutingKey, d.Redelivered, string(d.Body))
+		return nil
+	}
+
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddDeliveryFunc("test_queues", "test-delivery-consumer", fn)
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		<-ac.Stop().Done()
+		cancel()
+	}()
+	require.NoError(t, ac.Start())
+
+	<-ctx.Done()
+}
+
+func TestAmqpxCloseWhileReconnecting(t *testing.T) {
+	cli, err := New()
+	require.NoError(t, err)
+
+	// Make the reconnection fail so that redial waits before retrying.
+	config := GlobalConfig
+	GlobalConfig.Port = "1"
+	defer func() {
+		GlobalConfig = config
+		require.NoError(t, Init())
+	}()
+	require.NoError(t, Connection.Close())
+	time.Sleep(time.Millisecond * 200)
+
+	closed := make(chan error, 1)
+	go func() { closed <- cli.Close() }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked while the channel was being re-established")
+	}
+	require.NoError(t, cli.Close())
+}
+
+func TestAmqpxCloseDuringReconnect(t *testing.T) {
+	cli, err := New()
+	require.NoError(t, err)
+
+	// The exclusive queue goes with the connection: redeclaring it calls the
+	// callback from within the reconnection, which it holds up.
+	_, err = cli.DeclareEphemeralQueue()
+	require.NoError(t, err)
+	reconnecting, release := make(chan struct{}), make(chan struct{})
+	cli.OnEphemeralQueueChange(func(string, amqp.Queue) {
+		close(reconnecting)
+		<-release
+	})
+	require.NoError(t, Connection.Close())
+	<-reconnecting
+
+	closed := make(chan error, 1)
+	go func() { closed <- cli.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while the channel was being re-established")
+	case <-time.After(time.Millisecond * 200):
+	}
+	close(release)
+	require.NoError(t, <-closed)
+	require.True(t, cli.channel.IsClosed(), "the re-established channel is closed by Close")
+}
+
+func TestConfigURL(t *testing.T) {
+	cfg := Config{Host: "rabbit", Port: "5671", Username: "u", Password: "p", Vhost: "orders"}
+	require.Equal(t, "amqp://u:p@rabbit:5671/orders", cfg.url())
+	cfg.TlsProtocols = true
+	require.Equal(t, "amqps://u:p@rabbit:5671/orders", cfg.url())
+
+	ad := &Amqpx{}
+	WithConfig(cfg)(ad)
+	require.Equal(t, cfg.url(), ad.url)
+	require.NotNil(t, dialConfig(true).TLSClientConfig)
+	require.Nil(t, dialConfig(false).TLSClientConfig)
+}
+
+func TestBlockedPerConnection(t *testing.T) {
+	own := &Amqpx{blocks: newBlockState()}
+	shared := &Amqpx{}
+	own.blocks.set(amqp.Blocking{Active: true, Reason: "low on memory"})
+	defer own.blocks.set(amqp.Blocking{Active: false})
+	require.True(t, own.IsBlocked())
+	require.False(t, shared.IsBlocked(), "instances on other connections are not blocked")
+}
+
+func TestAmqpxOwnConnection(t *testing.T) {
+	const queue = "test_own_connection"
+
+	cli, err := New(WithConfig(GlobalConfig))
+	require.NoError(t, err)
+	shared, err := New()
+	require.NoError(t, err)
+	defer shared.Close()
+	require.NotNil(t, cli.conn)
+	require.NotSame(t, Connection, cli.conn)
+
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false))
+	require.NoError(t, err)
+	defer shared.QueueDelete(queue, false, false)
+	require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("own")))
+	require.Eventually(t, func() bool {
+		info, err := shared.QueueInspect(queue)
+		return err == nil && info.Messages == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// The instance redials its own connection.
+	first := cli.conn
+	require.NoError(t, first.Close())
+	require.Eventually(t, func() bool {
+		cli.connMu.Lock()
+		defer cli.connMu.Unlock()
+		return cli.conn != first && !cli.channel.IsClosed()
+	}, 5*time.Second, 50*time.Millisecond)
+	d, ok, err := cli.GetAndAck(queue)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "own", string(d.Body))
+
+	require.NoError(t, cli.Close())
+	require.True(t, cli.conn.IsClosed())
+	require.False(t, Connection.IsClosed(), "the package connection is left open")
+	require.NoError(t, shared.Publish(DefaultExchange, queue, []byte("shared")))
+}
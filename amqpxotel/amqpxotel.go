@@ -0,0 +1,170 @@
+// Package amqpxotel adds OpenTelemetry tracing to amqpx publishers and
+// consumers, propagating the trace context in the AMQP message headers. It is
+// a module of its own, so that amqpx does not depend on OpenTelemetry.
+//
+// Example:
+//
+//	cli.UsePublishInterceptor(amqpxotel.PublishInterceptor())
+//	ac.Use(amqpxotel.Middleware())
+package amqpxotel
+
+import (
+	"context"
+	"errors"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"amqpx"
+)
+
+const instrumentationName = "amqpx/amqpxotel"
+
+// Option configures the instrumentation.
+type Option func(*config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+}
+
+// WithTracerProvider sets the TracerProvider, the global one by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithPropagator sets the propagator writing and reading the message headers,
+// the global one by default.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		tracerProvider: otel.GetTracerProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// PublishInterceptor returns an amqpx.PublishInterceptor starting a producer
+// span for every published message and injecting its context into the message
+// headers.
+func PublishInterceptor(opts ...Option) amqpx.PublishInterceptor {
+	c := newConfig(opts)
+	tracer := c.tracerProvider.Tracer(instrumentationName)
+	return func(next amqpx.PublishFunc) amqpx.PublishFunc {
+		return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+			ctx, span := tracer.Start(ctx, spanName(exchange, key, "publish"),
+				trace.WithSpanKind(trace.SpanKindProducer),
+				trace.WithAttributes(attributes(exchange, key, "")...),
+			)
+			defer span.End()
+
+			if msg.Headers == nil {
+				msg.Headers = amqp.Table{}
+			}
+			c.propagator.Inject(ctx, headerCarrier(msg.Headers))
+			err := next(ctx, exchange, key, msg)
+			// Read once next returned: the id may be stamped by DefaultsInterceptor,
+			// which runs last.
+			if msg.MessageId != "" {
+				span.SetAttributes(attribute.String("messaging.message.id", msg.MessageId))
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
+
+// Middleware returns an amqpx.Middleware extracting the trace context from the
+// delivery headers and starting a consumer span around the handler. The handler
+// receives the span in its context.
+func Middleware(opts ...Option) amqpx.Middleware {
+	c := newConfig(opts)
+	tracer := c.tracerProvider.Tracer(instrumentationName)
+	return func(next amqpx.Handler) amqpx.Handler {
+		return func(ctx context.Context, d amqp.Delivery) error {
+			ctx = c.propagator.Extract(ctx, headerCarrier(d.Headers))
+			ctx, span := tracer.Start(ctx, spanName(d.Exchange, d.RoutingKey, "process"),
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(attributes(d.Exchange, d.RoutingKey, d.MessageId)...),
+				trace.WithAttributes(
+					attribute.String("messaging.consumer.id", d.ConsumerTag),
+					attribute.Bool("messaging.rabbitmq.redelivered", d.Redelivered),
+				),
+			)
+			defer span.End()
+
+			err := next(ctx, d)
+			if err == nil {
+				span.SetAttributes(attribute.String("messaging.amqpx.outcome", "ack"))
+				return nil
+			}
+			outcome := "requeue"
+			if errors.Is(err, amqpx.ErrDropMessage) {
+				outcome = "reject"
+			}
+			span.SetAttributes(attribute.String("messaging.amqpx.outcome", outcome))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+}
+
+func spanName(exchange, key, operation string) string {
+	if exchange == "" {
+		exchange = key
+	}
+	if exchange == "" {
+		return operation
+	}
+	return exchange + " " + operation
+}
+
+func attributes(exchange, key, messageID string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", exchange),
+		attribute.String("messaging.rabbitmq.destination.routing_key", key),
+	}
+	if messageID != "" {
+		attrs = append(attrs, attribute.String("messaging.message.id", messageID))
+	}
+	return attrs
+}
+
+// headerCarrier adapts AMQP headers to a propagation.TextMapCarrier.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
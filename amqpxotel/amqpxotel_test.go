@@ -0,0 +1,67 @@
+package amqpxotel
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"amqpx"
+)
+
+func TestPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	opts := []Option{
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+		WithPropagator(propagation.TraceContext{}),
+	}
+
+	var published amqp.Publishing
+	publish := PublishInterceptor(opts...)(func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+		published = *msg
+		return nil
+	})
+	require.NoError(t, publish(context.Background(), "orders", "created", &amqp.Publishing{Body: []byte("{}")}))
+	require.Contains(t, published.Headers, "traceparent")
+
+	var handled trace.SpanContext
+	handler := Middleware(opts...)(func(ctx context.Context, d amqp.Delivery) error {
+		handled = trace.SpanContextFromContext(ctx)
+		return amqpx.Drop(nil)
+	})
+	err := handler(context.Background(), amqp.Delivery{Exchange: "orders", RoutingKey: "created", Headers: published.Headers})
+	require.ErrorIs(t, err, amqpx.ErrDropMessage)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	producer, consumer := spans[0], spans[1]
+	require.Equal(t, "orders publish", producer.Name())
+	require.Equal(t, trace.SpanKindProducer, producer.SpanKind())
+	require.Equal(t, "orders process", consumer.Name())
+	require.Equal(t, trace.SpanKindConsumer, consumer.SpanKind())
+	require.Equal(t, producer.SpanContext().TraceID(), consumer.SpanContext().TraceID())
+	require.Equal(t, producer.SpanContext().SpanID(), consumer.Parent().SpanID())
+	require.Equal(t, consumer.SpanContext(), handled)
+	require.Equal(t, codes.Error, consumer.Status().Code)
+}
+
+func TestPublishStampedMessageID(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	publish := PublishInterceptor(WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))(
+		func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+			msg.MessageId = "stamped" // as DefaultsInterceptor does, innermost
+			return nil
+		})
+	require.NoError(t, publish(context.Background(), "orders", "created", &amqp.Publishing{}))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Contains(t, spans[0].Attributes(), attribute.String("messaging.message.id", "stamped"))
+}
@@ -0,0 +1,158 @@
+// Package amqpxprom exports the metrics of amqpx consumers to Prometheus. It
+// is a module of its own, so that amqpx does not depend on the Prometheus
+// client.
+//
+// Example:
+//
+//	ac, err := amqpx.NewAmqpxConsumer(amqpx.WithMetrics(amqpxprom.MustRegister(prometheus.DefaultRegisterer)))
+package amqpxprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"amqpx"
+)
+
+// Collector is an amqpx.MetricsCollector and a prometheus.Collector.
+type Collector struct {
+	consumed    *prometheus.CounterVec
+	acked       *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+	panics      *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	lastMessage *prometheus.GaugeVec
+	reconnects  prometheus.Counter
+	restarts    *prometheus.CounterVec
+}
+
+var _ amqpx.MetricsCollector = (*Collector)(nil)
+
+// NewCollector creates a Collector whose metrics are prefixed by namespace,
+// "amqpx" if empty.
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = "amqpx"
+	}
+	labels := []string{"queue", "consumer"}
+	return &Collector{
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_consumed_total",
+			Help:      "Deliveries received by consumers.",
+		}, labels),
+		acked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_acked_total",
+			Help:      "Deliveries acknowledged after their handler succeeded.",
+		}, labels),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_rejected_total",
+			Help:      "Deliveries rejected or retried after their handler failed.",
+		}, append(labels, "requeue")),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "handler_panics_total",
+			Help:      "Handlers that panicked.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent in handlers.",
+			Buckets:   prometheus.DefBuckets,
+		}, append(labels, "result")),
+		lastMessage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_message_timestamp_seconds",
+			Help:      "Time the last delivery was received, as a Unix timestamp.",
+		}, labels),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "channel_reconnects_total",
+			Help:      "AMQP channels re-established after they were closed.",
+		}),
+		restarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "watchdog_restarts_total",
+			Help:      "Stuck consumers restarted by the watchdog.",
+		}, labels),
+	}
+}
+
+// MustRegister creates a Collector with the default namespace and registers it
+// with reg, panicking on failure.
+func MustRegister(reg prometheus.Registerer) *Collector {
+	c := NewCollector("")
+	reg.MustRegister(c)
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.consumed.Describe(ch)
+	c.acked.Describe(ch)
+	c.rejected.Describe(ch)
+	c.panics.Describe(ch)
+	c.duration.Describe(ch)
+	c.lastMessage.Describe(ch)
+	c.reconnects.Describe(ch)
+	c.restarts.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.consumed.Collect(ch)
+	c.acked.Collect(ch)
+	c.rejected.Collect(ch)
+	c.panics.Collect(ch)
+	c.duration.Collect(ch)
+	c.lastMessage.Collect(ch)
+	c.reconnects.Collect(ch)
+	c.restarts.Collect(ch)
+}
+
+// IncConsumed implements amqpx.MetricsCollector.
+func (c *Collector) IncConsumed(queue, tag string) {
+	c.consumed.WithLabelValues(queue, tag).Inc()
+	c.lastMessage.WithLabelValues(queue, tag).SetToCurrentTime()
+}
+
+// IncAcked implements amqpx.MetricsCollector.
+func (c *Collector) IncAcked(queue, tag string) {
+	c.acked.WithLabelValues(queue, tag).Inc()
+}
+
+// IncRejected implements amqpx.MetricsCollector.
+func (c *Collector) IncRejected(queue, tag string, requeue bool) {
+	r := "false"
+	if requeue {
+		r = "true"
+	}
+	c.rejected.WithLabelValues(queue, tag, r).Inc()
+}
+
+// IncPanics implements amqpx.MetricsCollector.
+func (c *Collector) IncPanics(queue, tag string) {
+	c.panics.WithLabelValues(queue, tag).Inc()
+}
+
+// ObserveHandlerDuration implements amqpx.MetricsCollector.
+func (c *Collector) ObserveHandlerDuration(queue, tag string, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	c.duration.WithLabelValues(queue, tag, result).Observe(d.Seconds())
+}
+
+// IncReconnect implements amqpx.MetricsCollector.
+func (c *Collector) IncReconnect() {
+	c.reconnects.Inc()
+}
+
+// IncWatchdogRestart implements amqpx.MetricsCollector.
+func (c *Collector) IncWatchdogRestart(queue, tag string) {
+	c.restarts.WithLabelValues(queue, tag).Inc()
+}
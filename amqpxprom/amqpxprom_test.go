@@ -0,0 +1,37 @@
+package amqpxprom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	c := MustRegister(reg)
+
+	c.IncConsumed("orders", "orders-1")
+	c.IncConsumed("orders", "orders-1")
+	c.IncAcked("orders", "orders-1")
+	c.IncRejected("orders", "orders-1", false)
+	c.ObserveHandlerDuration("orders", "orders-1", time.Millisecond, errors.New("boom"))
+	c.IncReconnect()
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP amqpx_messages_consumed_total Deliveries received by consumers.
+# TYPE amqpx_messages_consumed_total counter
+amqpx_messages_consumed_total{consumer="orders-1",queue="orders"} 2
+# HELP amqpx_messages_rejected_total Deliveries rejected or retried after their handler failed.
+# TYPE amqpx_messages_rejected_total counter
+amqpx_messages_rejected_total{consumer="orders-1",queue="orders",requeue="false"} 1
+# HELP amqpx_channel_reconnects_total AMQP channels re-established after they were closed.
+# TYPE amqpx_channel_reconnects_total counter
+amqpx_channel_reconnects_total 1
+`), "amqpx_messages_consumed_total", "amqpx_messages_rejected_total", "amqpx_channel_reconnects_total"))
+	require.Equal(t, 1, testutil.CollectAndCount(c, "amqpx_handler_duration_seconds"))
+}
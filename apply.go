@@ -0,0 +1,215 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Topology describes the exchanges, queues and bindings an application relies
+// on, declared together by ApplyTopology.
+type Topology struct {
+	Exchanges []ExchangeSpec `json:"exchanges,omitempty" yaml:"exchanges,omitempty"`
+	Queues    []QueueSpec    `json:"queues,omitempty" yaml:"queues,omitempty"`
+	Bindings  []BindingSpec  `json:"bindings,omitempty" yaml:"bindings,omitempty"`
+}
+
+// ApplyTopology declares the exchanges, then the queues, then the bindings of
+// t, and declares them again every time redial re-establishes the channel, so
+// that auto-deleted and transient elements lost in a broker restart are back
+// before publishing resumes. Declaring is idempotent: elements that already
+// exist with the same settings are left as they are.
+//
+// An element the broker refuses does not prevent the others from being
+// declared; ApplyTopology then returns a *TopologyError listing the failures.
+// Elements are declared on a channel of their own, so that a refusal does not
+// close the channel shared with publishers.
+func (ad *Amqpx) ApplyTopology(t Topology) error {
+	ad.topologyMu.Lock()
+	ad.topologies = append(ad.topologies, t)
+	ad.topologyMu.Unlock()
+
+	return ad.applyTopology(t, false)
+}
+
+// CheckTopology is a dry run of ApplyTopology: it declares nothing but reports
+// the elements of t missing on the broker or existing there with other
+// settings, in a *TopologyError whose errors match ErrTopologyDrift. AMQP has no
+// way to look up a binding without declaring it, so bindings are only reported
+// when their queue or exchange is missing.
+func (ad *Amqpx) CheckTopology(t Topology) error {
+	return ad.applyTopology(t, true)
+}
+
+// reapplyTopology declares again the topologies given to ApplyTopology, after
+// the channel was re-established.
+func (ad *Amqpx) reapplyTopology() {
+	ad.topologyMu.Lock()
+	topologies := ad.topologies
+	ad.topologyMu.Unlock()
+
+	for _, t := range topologies {
+		if err := ad.applyTopology(t, false); err != nil {
+			log.Printf("amqpd-redial: topology: %s", err)
+		}
+	}
+}
+
+// applyTopology declares t, or checks it against the broker if dryRun is set.
+func (ad *Amqpx) applyTopology(t Topology, dryRun bool) error {
+	var (
+		a    = &applier{ad: ad, dryRun: dryRun}
+		errs []error
+	)
+	defer a.close()
+
+	for _, spec := range t.Exchanges {
+		if err := a.exchange(spec); err != nil {
+			errs = append(errs, elementError("exchange", spec.Name, err))
+		}
+	}
+	for _, spec := range t.Queues {
+		if err := a.queue(spec); err != nil {
+			errs = append(errs, elementError("queue", spec.Name, err))
+		}
+	}
+	for _, spec := range t.Bindings {
+		if err := a.binding(spec); err != nil {
+			errs = append(errs, elementError("binding", fmt.Sprintf("of %s to %s", spec.Queue, spec.Exchange), err))
+		}
+	}
+	if len(errs) > 0 {
+		return &TopologyError{Errors: errs}
+	}
+	return nil
+}
+
+// elementError wraps err with the element of a Topology it concerns, unless it
+// is a *DeclareError, which already names it.
+func elementError(kind, name string, err error) error {
+	var de *DeclareError
+	if errors.As(err, &de) {
+		return err
+	}
+	return fmt.Errorf("%s %s: %w", kind, name, err)
+}
+
+// applier declares or checks the elements of a Topology on a channel of its
+// own, opened on the connection of ad and reopened after a refusal closed it.
+type applier struct {
+	ad     *Amqpx
+	ch     *amqp.Channel
+	dryRun bool
+}
+
+// channel returns the open channel of a.
+func (a *applier) channel() (*amqp.Channel, error) {
+	if a.ch != nil && !a.ch.IsClosed() {
+		return a.ch, nil
+	}
+	ch, err := a.ad.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	a.ch = ch
+	return ch, nil
+}
+
+// close closes the channel of a.
+func (a *applier) close() {
+	if a.ch != nil && !a.ch.IsClosed() {
+		a.ch.Close()
+	}
+}
+
+// exchange declares or checks the exchange described by spec.
+func (a *applier) exchange(spec ExchangeSpec) error {
+	if spec.Name == "" {
+		return errors.New("exchange name is empty")
+	}
+	ch, err := a.channel()
+	if err != nil {
+		return err
+	}
+	if a.dryRun {
+		err := ch.ExchangeDeclarePassive(spec.Name, spec.Kind, spec.Durable, spec.AutoDelete, spec.Internal, false, spec.Args)
+		if missing(err) {
+			return fmt.Errorf("%w: missing", ErrTopologyDrift)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Declaring an existing exchange changes nothing, but is refused if its
+	// settings differ, which is how a dry run finds drift.
+	return drift(a.dryRun, declareExchangeOn(ch, spec))
+}
+
+// queue declares or checks the queue described by spec.
+func (a *applier) queue(spec QueueSpec) error {
+	if spec.Name == "" {
+		return ErrEmptyQueue
+	}
+	ch, err := a.channel()
+	if err != nil {
+		return err
+	}
+	if a.dryRun {
+		_, err := ch.QueueDeclarePassive(spec.Name, spec.Durable, spec.AutoDelete, spec.Exclusive, false, spec.Args)
+		if missing(err) {
+			return fmt.Errorf("%w: missing", ErrTopologyDrift)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = declareQueueOn(ch, spec)
+	return drift(a.dryRun, err)
+}
+
+// binding declares the binding described by spec, or checks that its queue
+// and exchange exist.
+func (a *applier) binding(spec BindingSpec) error {
+	ch, err := a.channel()
+	if err != nil {
+		return err
+	}
+	if !a.dryRun {
+		return bindOn(ch, spec)
+	}
+	if _, err := ch.QueueDeclarePassive(spec.Queue, false, false, false, false, nil); missing(err) {
+		return fmt.Errorf("%w: queue %s missing", ErrTopologyDrift, spec.Queue)
+	} else if err != nil {
+		return err
+	}
+	if spec.Exchange == DefaultExchange {
+		return nil
+	}
+	ch, err = a.channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.ExchangeDeclarePassive(spec.Exchange, ExchangeDirect, false, false, false, false, nil); missing(err) {
+		return fmt.Errorf("%w: exchange %s missing", ErrTopologyDrift, spec.Exchange)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// missing reports whether err is the NOT_FOUND raised by a passive declare.
+func missing(err error) bool {
+	var ae *amqp.Error
+	return errors.As(err, &ae) && ae.Code == amqp.NotFound
+}
+
+// drift wraps the *DeclareError found in a dry run with ErrTopologyDrift.
+func drift(dryRun bool, err error) error {
+	var de *DeclareError
+	if dryRun && errors.As(err, &de) {
+		return fmt.Errorf("%w: %w", ErrTopologyDrift, err)
+	}
+	return err
+}
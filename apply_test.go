@@ -0,0 +1,89 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyError(t *testing.T) {
+	missing := elementError("queue", "orders", fmt.Errorf("%w: missing", ErrTopologyDrift))
+	declare := &DeclareError{Kind: "exchange", Name: "events", Reason: "PRECONDITION_FAILED"}
+	err := error(&TopologyError{Errors: []error{missing, elementError("exchange", "events", declare)}})
+
+	require.ErrorIs(t, err, ErrTopologyDrift)
+	var de *DeclareError
+	require.ErrorAs(t, err, &de)
+	require.Equal(t, "amqpd topology err: queue orders: amqpx: topology drift: missing; amqpd declare err: exchange events: PRECONDITION_FAILED", err.Error())
+	require.False(t, errors.Is(err, ErrQueueNotFound))
+}
+
+func TestApplyTopology(t *testing.T) {
+	const (
+		exchange = "test_apply_topology_exchange"
+		queue    = "test_apply_topology_queue"
+		conflict = "test_apply_topology_conflict"
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	defer cli.ExchangeDelete(exchange, false)
+	for _, q := range []string{queue, conflict} {
+		_, _ = cli.QueueDelete(q, false, false)
+		defer cli.QueueDelete(q, false, false)
+	}
+	_, err = cli.QueueDeclareWithOptions(conflict, WithQueueDurable(false), WithQueueAutoDelete())
+	require.NoError(t, err)
+
+	topo := Topology{
+		Exchanges: []ExchangeSpec{{Name: exchange, Kind: ExchangeDirect}},
+		Queues: []QueueSpec{
+			{Name: conflict, Durable: true},
+			{Name: queue, AutoDelete: true},
+		},
+		Bindings: []BindingSpec{{Queue: queue, Exchange: exchange, Key: "k"}},
+	}
+	drift := cli.CheckTopology(topo)
+	var te *TopologyError
+	require.ErrorAs(t, drift, &te)
+	require.Len(t, te.Errors, 4, "exchange and queue missing, conflict differing, binding to missing queue")
+	require.ErrorIs(t, drift, ErrTopologyDrift)
+	exists, err := cli.ExchangeExists(exchange, ExchangeDirect)
+	require.NoError(t, err)
+	require.False(t, exists, "dry run declares nothing")
+
+	err = cli.ApplyTopology(topo)
+	require.ErrorAs(t, err, &te)
+	require.Len(t, te.Errors, 1)
+	var de *DeclareError
+	require.ErrorAs(t, err, &de)
+	require.Equal(t, conflict, de.Name)
+	require.NoError(t, cli.Publish(exchange, "k", []byte("routed")))
+	require.Eventually(t, func() bool {
+		info, err := cli.QueueInspect(queue)
+		return err == nil && info.Messages == 1
+	}, time.Second*5, time.Millisecond*50)
+
+	// Elements lost while the channel is down are declared again by redial.
+	_, err = cli.QueueDelete(queue, false, false)
+	require.NoError(t, err)
+	require.NoError(t, cli.channel.Close())
+	require.Eventually(t, func() bool {
+		_, err := cli.QueueInspect(queue)
+		return err == nil
+	}, time.Second*5, time.Millisecond*50)
+	require.Eventually(t, func() bool {
+		return cli.Publish(exchange, "k", []byte("routed")) == nil
+	}, time.Second*5, time.Millisecond*50)
+	require.Eventually(t, func() bool {
+		info, err := cli.QueueInspect(queue)
+		return err == nil && info.Messages == 1
+	}, time.Second*5, time.Millisecond*50)
+
+	topo.Queues = topo.Queues[1:]
+	require.NoError(t, cli.CheckTopology(topo))
+}
@@ -0,0 +1,98 @@
+package amqpx
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes the delay between attempts after an error, to subscribe to a
+// queue again or to retry a publish.
+type Backoff interface {
+	// NextDelay returns the delay before the next attempt after the given
+	// number of consecutive failures, starting at 1.
+	NextDelay(failures int) time.Duration
+}
+
+// ExponentialBackoff is a Backoff whose delay starts at InitialInterval and is
+// multiplied by Multiplier after each consecutive failure, up to MaxInterval.
+// Jitter is the fraction of the delay, between 0 and 1, randomly added or
+// removed so that many consumers do not retry in lockstep.
+//
+// A zero InitialInterval or MaxInterval takes the value of DefaultBackoff, so
+// that the zero ExponentialBackoff does not retry in a busy loop.
+type ExponentialBackoff struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+}
+
+// DefaultBackoff is the Backoff used by consumers created without WithBackoff.
+var DefaultBackoff = ExponentialBackoff{
+	InitialInterval: time.Second,
+	MaxInterval:     15 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// DefaultBackoffReset is how long a subscription must last before the
+// failures preceding it are forgotten.
+const DefaultBackoffReset = time.Minute
+
+// NextDelay implements Backoff.
+func (b ExponentialBackoff) NextDelay(failures int) time.Duration {
+	initial, maxInterval := b.InitialInterval, b.MaxInterval
+	if initial <= 0 {
+		initial = DefaultBackoff.InitialInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = max(DefaultBackoff.MaxInterval, initial)
+	}
+	d := float64(initial)
+	for i := 1; i < failures && d < float64(maxInterval); i++ {
+		d *= max(b.Multiplier, 1)
+	}
+	d = min(d, float64(maxInterval))
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// WithBackoff sets the delay between attempts to subscribe to a queue after an
+// error. The count of consecutive failures is reset once a subscription lasts
+// longer than resetAfter, or DefaultBackoffReset if it is zero. A consumer
+// whose channel dropped does not wait for this delay: it subscribes again as
+// soon as the channel has been re-established. A nil b stands for
+// DefaultBackoff.
+func WithBackoff(b Backoff, resetAfter time.Duration) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		if b == nil {
+			b = DefaultBackoff
+		}
+		ac.backoff = b
+		if resetAfter > 0 {
+			ac.backoffReset = resetAfter
+		}
+	}
+}
+
+// retryState tracks the consecutive failures of the run loop of an entry.
+type retryState struct {
+	failures   int
+	subscribed time.Time // start of the current subscription
+}
+
+// retryDelay records a failure and returns the delay before the next attempt.
+func (ac *AmqpxConsumer) retryDelay(s *retryState) time.Duration {
+	s.failures++
+	return ac.backoff.NextDelay(s.failures)
+}
+
+// unsubscribed forgets the failures of s if the subscription that just ended
+// lasted long enough to be considered stable.
+func (ac *AmqpxConsumer) unsubscribed(s *retryState) {
+	if ac.now().Sub(s.subscribed) >= ac.backoffReset {
+		s.failures = 0
+	}
+}
@@ -0,0 +1,82 @@
+package amqpx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{InitialInterval: time.Second, MaxInterval: time.Second * 10, Multiplier: 2}
+
+	require.Equal(t, time.Second, b.NextDelay(1))
+	require.Equal(t, time.Second*2, b.NextDelay(2))
+	require.Equal(t, time.Second*8, b.NextDelay(4))
+	require.Equal(t, time.Second*10, b.NextDelay(5))
+	require.Equal(t, time.Second*10, b.NextDelay(100))
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.NextDelay(2)
+		require.GreaterOrEqual(t, d, time.Second)
+		require.LessOrEqual(t, d, time.Second*3)
+	}
+}
+
+func TestExponentialBackoffDefaults(t *testing.T) {
+	var zero ExponentialBackoff
+	require.Equal(t, DefaultBackoff.InitialInterval, zero.NextDelay(1), "no busy loop")
+	require.Equal(t, DefaultBackoff.MaxInterval, ExponentialBackoff{Multiplier: 2}.NextDelay(100))
+
+	b := ExponentialBackoff{InitialInterval: time.Minute, Multiplier: 2}
+	require.Equal(t, time.Minute, b.NextDelay(3), "the cap is at least the initial interval")
+
+	ac := &AmqpxConsumer{}
+	WithBackoff(nil, 0)(ac)
+	require.Equal(t, DefaultBackoff, ac.backoff)
+}
+
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestRetryBackoffReset(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	ac := &AmqpxConsumer{now: clock.Now, after: clock.After}
+	WithBackoff(ExponentialBackoff{
+		InitialInterval: time.Second,
+		MaxInterval:     time.Minute,
+		Multiplier:      3,
+	}, time.Second*30)(ac)
+	e := &entry{quit: make(chan struct{}), cancelled: make(chan struct{}, 1)}
+
+	var s retryState
+	for i := 0; i < 3; i++ {
+		require.False(t, ac.sleep(e, ac.retryDelay(&s)))
+	}
+	require.Equal(t, []time.Duration{time.Second, time.Second * 3, time.Second * 9}, clock.sleeps)
+
+	// A short-lived subscription keeps the failures.
+	s.subscribed = clock.now
+	clock.now = clock.now.Add(time.Second * 10)
+	ac.unsubscribed(&s)
+	require.Equal(t, time.Second*27, ac.retryDelay(&s))
+
+	// A stable one forgets them.
+	s.subscribed = clock.now
+	clock.now = clock.now.Add(time.Minute)
+	ac.unsubscribed(&s)
+	require.Equal(t, time.Second, ac.retryDelay(&s))
+}
@@ -0,0 +1,137 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AddBatchFunc adds a queue consumption configuration whose handler receives
+// deliveries in batches. Deliveries are accumulated until size of them have
+// arrived or flushInterval has passed since the last flush, whichever comes
+// first, and the handler is then called once with the whole batch. A flush
+// triggered by size restarts the interval.
+//
+// The batch is settled as a unit: if the handler returns nil every delivery is
+// acked, otherwise every delivery is rejected according to the error (requeued
+// unless the error is wrapped with Drop). There is no partial success; handlers
+// that commit part of a batch must be idempotent for the redelivered remainder.
+// On Stop the pending partial batch is flushed before the channel is closed.
+// WithMaxRetries does not apply to batch handlers. A size that is not positive
+// fails with ErrInvalidOption.
+func (ac *AmqpxConsumer) AddBatchFunc(queue, consumer string, size int, flushInterval time.Duration, fn func([]amqp.Delivery) error, opts ...EntryOption) (string, error) {
+	if size <= 0 {
+		return "", fmt.Errorf("%w: batch size %d", ErrInvalidOption, size)
+	}
+	return ac.addEntry(consumer, &entry{
+		Queue:         queue,
+		BatchHandler:  fn,
+		batchSize:     size,
+		flushInterval: flushInterval,
+	}, opts)
+}
+
+// consumeBatch accumulates deliveries into batches for e.BatchHandler until
+// the deliveries channel is closed, then flushes what is left.
+func (ac *AmqpxConsumer) consumeBatch(e *entry, deliveries <-chan amqp.Delivery) {
+	var (
+		ticker *time.Ticker
+		tick   <-chan time.Time
+	)
+	if e.flushInterval > 0 {
+		ticker = time.NewTicker(e.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	batch := make([]amqp.Delivery, 0, e.batchSize)
+	flush := func() {
+		if ticker != nil {
+			// The interval runs from the last flush, whatever triggered it.
+			ticker.Reset(e.flushInterval)
+			select {
+			case <-tick:
+			default:
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		start := time.Now()
+		err := ac.runBatchWithRecovery(e, batch)
+		ac.settleBatch(e, batch, err, time.Since(start))
+		batch = make([]amqp.Delivery, 0, e.batchSize)
+	}
+	for {
+		select {
+		case dely, ok := <-deliveries:
+			if !ok {
+				flush()
+				return
+			}
+			stripReturnID(dely.Headers)
+			e.received()
+			ac.onMessage(e, dely)
+			batch = append(batch, dely)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-tick:
+			flush()
+		}
+	}
+}
+
+// runBatchWithRecovery runs the batch handler of e with panic recovery.
+func (ac *AmqpxConsumer) runBatchWithRecovery(e *entry, batch []amqp.Delivery) (err error) {
+	atomic.AddInt64(&ac.inflight, 1)
+	e.stats.inflight.Add(1)
+	defer func() {
+		atomic.AddInt64(&ac.inflight, -1)
+		e.stats.inflight.Add(-1)
+	}()
+	defer recoverPanic(&err)
+	return e.BatchHandler(batch)
+}
+
+// settleBatch acks or rejects every delivery of batch according to err.
+//
+// The batch is settled with a single ack or nack with the multiple flag on its
+// last delivery: the entry has a channel of its own and handles one batch at a
+// time, so the deliveries it covers are those of the batch.
+func (ac *AmqpxConsumer) settleBatch(e *entry, batch []amqp.Delivery, err error, elapsed time.Duration) {
+	for range batch {
+		e.stats.recordResult(err)
+	}
+	ac.observeHandler(e, err, elapsed)
+	if err != nil {
+		ac.handlerError(e, err, nil)
+	}
+	if e.autoAckMode() {
+		return
+	}
+	last := batch[len(batch)-1]
+	if err == nil {
+		if aerr := last.Ack(true); aerr != nil {
+			ac.channelError(e, "ack", aerr, &last)
+		}
+		for _, dely := range batch {
+			ac.onAck(e, dely, elapsed)
+		}
+		return
+	}
+	requeue := requeueOnError(err)
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		requeue = ac.panicRequeue
+	}
+	if nerr := last.Nack(true, requeue); nerr != nil {
+		ac.channelError(e, "reject", nerr, &last)
+	}
+	for _, dely := range batch {
+		ac.onReject(e, dely, err, requeue)
+	}
+}
@@ -0,0 +1,77 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmqpxConsumerBatch(t *testing.T) {
+	const queue = "test_batch_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	_, err = cli.channel.QueuePurge(queue, false)
+	require.NoError(t, err)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("row")))
+	}
+
+	var (
+		mu    sync.Mutex
+		sizes []int
+	)
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddBatchFunc(queue, "test-batch-consumer", 10, time.Millisecond*200, func(batch []amqp.Delivery) error {
+		mu.Lock()
+		sizes = append(sizes, len(batch))
+		mu.Unlock()
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+
+	time.Sleep(time.Second)
+	<-ac.Stop().Done()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []int{10, 10, 5}, sizes)
+}
+
+func TestAddBatchFuncSize(t *testing.T) {
+	ac := &AmqpxConsumer{entries: map[string]*entry{}}
+	noop := func([]amqp.Delivery) error { return nil }
+
+	for _, size := range []int{0, -1} {
+		_, err := ac.AddBatchFunc("rows", "c", size, time.Second, noop)
+		require.ErrorIs(t, err, ErrInvalidOption, "size %d", size)
+	}
+	tag, err := ac.AddBatchFunc("rows", "c", 10, time.Second, noop)
+	require.NoError(t, err)
+	require.Equal(t, 10, ac.entries[tag].batchSize)
+}
+
+func TestSettleBatch(t *testing.T) {
+	ac := &AmqpxConsumer{ctx: context.Background(), errorHandler: func(string, string, error, []byte) {}}
+	e := &entry{Queue: "rows", tag: "rows-1"}
+	ch := &recordingAcknowledger{}
+	batch := []amqp.Delivery{{Acknowledger: ch, DeliveryTag: 1}, {Acknowledger: ch, DeliveryTag: 2}, {Acknowledger: ch, DeliveryTag: 3}}
+
+	ac.settleBatch(e, batch, nil, 0)
+	require.Equal(t, []string{"ack 3 true"}, ch.ops)
+
+	ch.ops = nil
+	ac.settleBatch(e, batch, Drop(errors.New("bad rows")), 0)
+	require.Equal(t, []string{"nack 3 true false"}, ch.ops)
+}
@@ -0,0 +1,154 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// blocked tracks the connection.blocked notifications of Connection, sent by
+// the broker while a resource alarm makes it stop reading from publishers. The
+// instances with a connection of their own track theirs, see blocking.
+var blocked = newBlockState()
+
+type blockState struct {
+	mu        sync.Mutex
+	reason    string
+	unblocked chan struct{}       // closed while the connection is not blocked
+	watchers  map[*Amqpx]struct{} // instances with OnBlocked or OnUnblocked callbacks
+}
+
+func newBlockState() *blockState {
+	s := &blockState{unblocked: make(chan struct{}), watchers: make(map[*Amqpx]struct{})}
+	close(s.unblocked)
+	return s
+}
+
+// watch records the notifications until the connection is closed, after
+// which the next one starts unblocked.
+func (s *blockState) watch(notifications <-chan amqp.Blocking) {
+	for b := range notifications {
+		s.set(b)
+	}
+	s.set(amqp.Blocking{Active: false})
+}
+
+func (s *blockState) set(b amqp.Blocking) {
+	s.mu.Lock()
+	select {
+	case <-s.unblocked:
+		if !b.Active {
+			s.mu.Unlock()
+			return
+		}
+		s.unblocked = make(chan struct{})
+	default:
+		if b.Active {
+			s.mu.Unlock()
+			return
+		}
+		close(s.unblocked)
+	}
+	s.reason = b.Reason
+	var hooks []func()
+	for ad := range s.watchers {
+		if b.Active && ad.onBlocked != nil {
+			fn := ad.onBlocked
+			hooks = append(hooks, func() { fn(b.Reason) })
+		}
+		if !b.Active && ad.onUnblocked != nil {
+			hooks = append(hooks, ad.onUnblocked)
+		}
+	}
+	s.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// state returns whether the connection is blocked, why, and a channel closed
+// once it is not.
+func (s *blockState) state() (bool, string, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.unblocked:
+		return false, "", s.unblocked
+	default:
+		return true, s.reason, s.unblocked
+	}
+}
+
+// blocking returns the state of the connection of ad.
+func (ad *Amqpx) blocking() *blockState {
+	if ad.blocks != nil {
+		return ad.blocks
+	}
+	return blocked
+}
+
+// IsBlocked reports whether the broker blocked the connection because of a
+// memory or disk alarm. Messages published meanwhile are not read by the
+// broker, see ErrConnectionBlocked.
+func (ad *Amqpx) IsBlocked() bool {
+	isBlocked, _, _ := ad.blocking().state()
+	return isBlocked
+}
+
+// OnBlocked registers fn to be called with the reason given by the broker when
+// it blocks the connection. A nil fn removes the registration.
+func (ad *Amqpx) OnBlocked(fn func(reason string)) {
+	s := ad.blocking()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ad.onBlocked = fn
+	ad.watchBlocked()
+}
+
+// OnUnblocked registers fn to be called when the broker unblocks the
+// connection. A nil fn removes the registration.
+func (ad *Amqpx) OnUnblocked(fn func()) {
+	s := ad.blocking()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ad.onUnblocked = fn
+	ad.watchBlocked()
+}
+
+// watchBlocked updates the registration of ad for the blocked callbacks. The
+// caller must hold the mu of ad.blocking().
+func (ad *Amqpx) watchBlocked() {
+	s := ad.blocking()
+	if ad.onBlocked == nil && ad.onUnblocked == nil {
+		delete(s.watchers, ad)
+		return
+	}
+	s.watchers[ad] = struct{}{}
+}
+
+// unblocking wraps p, the innermost PublishFunc, to hold messages while the
+// connection is blocked instead of piling them up in the socket buffer. It
+// fails fast with ErrConnectionBlocked if ctx cannot be done, and waits for the
+// connection to be unblocked otherwise.
+func (ad *Amqpx) unblocking(p PublishFunc) PublishFunc {
+	s := ad.blocking()
+	return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+		isBlocked, reason, unblocked := s.state()
+		if isBlocked {
+			if ctx.Done() == nil {
+				return fmt.Errorf("%w: %s", ErrConnectionBlocked, reason)
+			}
+			select {
+			case <-unblocked:
+			case <-ctx.Done():
+				return fmt.Errorf("%w: %s: %w", ErrConnectionBlocked, reason, ctx.Err())
+			}
+		}
+		return p(ctx, exchange, key, msg)
+	}
+}
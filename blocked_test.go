@@ -0,0 +1,59 @@
+package amqpx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionBlocked(t *testing.T) {
+	ad := &Amqpx{}
+	var events []string
+	ad.OnBlocked(func(reason string) { events = append(events, "blocked: "+reason) })
+	ad.OnUnblocked(func() { events = append(events, "unblocked") })
+	defer ad.OnBlocked(nil)
+	defer ad.OnUnblocked(nil)
+
+	var sent int
+	publish := ad.chain(func(context.Context, string, string, *amqp.Publishing) error {
+		sent++
+		return nil
+	})
+
+	notifications := make(chan amqp.Blocking, 2)
+	done := make(chan struct{})
+	go func() {
+		blocked.watch(notifications)
+		close(done)
+	}()
+	notifications <- amqp.Blocking{Active: true, Reason: "low on memory"}
+	require.Eventually(t, ad.IsBlocked, time.Second, time.Millisecond)
+
+	err := publish(context.Background(), "", "q", &amqp.Publishing{})
+	require.ErrorIs(t, err, ErrConnectionBlocked)
+	require.ErrorContains(t, err, "low on memory")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	err = publish(ctx, "", "q", &amqp.Publishing{})
+	require.ErrorIs(t, err, ErrConnectionBlocked)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Zero(t, sent)
+
+	result := make(chan error)
+	go func() { result <- publish(context.WithoutCancel(ctx), "", "q", &amqp.Publishing{}) }()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	go func() { result <- publish(waitCtx, "", "q", &amqp.Publishing{}) }()
+	require.ErrorIs(t, <-result, ErrConnectionBlocked, "cannot wait without a deadline")
+
+	close(notifications) // the connection is closed
+	<-done
+	require.NoError(t, <-result)
+	require.False(t, ad.IsBlocked())
+	require.Equal(t, 1, sent)
+	require.Equal(t, []string{"blocked: low on memory", "unblocked"}, events)
+}
@@ -0,0 +1,100 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Overflow is the behavior of a queue declared WithMaxLength or
+// WithMaxLengthBytes once it is full.
+type Overflow string
+
+// Overflow behaviors of a full queue.
+const (
+	OverflowDropHead         Overflow = "drop-head"          // discard or dead-letter the oldest messages, the default
+	OverflowRejectPublish    Overflow = "reject-publish"     // refuse new messages, nacking them with confirms
+	OverflowRejectPublishDLX Overflow = "reject-publish-dlx" // refuse new messages and dead-letter them
+)
+
+// WithMaxLength bounds the queue to n ready messages, beyond which it behaves
+// as set by WithOverflow.
+func WithMaxLength(n int) QueueOption {
+	return WithQueueArgs(amqp.Table{"x-max-length": int64(n)})
+}
+
+// WithMaxLengthBytes bounds the queue to n bytes of ready message bodies,
+// beyond which it behaves as set by WithOverflow.
+func WithMaxLengthBytes(n int) QueueOption {
+	return WithQueueArgs(amqp.Table{"x-max-length-bytes": int64(n)})
+}
+
+// WithOverflow sets what a queue bounded by WithMaxLength or WithMaxLengthBytes
+// does with the messages published once it is full. With OverflowRejectPublish
+// and OverflowRejectPublishDLX, the broker nacks them if publisher confirms are
+// enabled: PublishConfirm and PublishBatch then return an error matching both
+// ErrQueueFull and ErrPublishNacked for the messages published to the queue
+// through the default exchange or an exchange it was bound to through the
+// same Amqpx. Without confirms, the messages are silently dropped.
+func WithOverflow(o Overflow) QueueOption {
+	return WithQueueArgs(amqp.Table{"x-overflow": string(o)})
+}
+
+// checkOverflow checks that the x-overflow argument of a queue, if any, is a
+// known Overflow.
+func checkOverflow(args amqp.Table) error {
+	v, ok := args["x-overflow"]
+	if !ok {
+		return nil
+	}
+	switch Overflow(fmt.Sprint(v)) {
+	case OverflowDropHead, OverflowRejectPublish, OverflowRejectPublishDLX:
+		return nil
+	}
+	return fmt.Errorf("%w: x-overflow %q, expected drop-head, reject-publish or reject-publish-dlx", ErrIncompatibleQueueOption, v)
+}
+
+// rejects reports whether a queue declared with args refuses new messages when
+// full.
+func rejects(args amqp.Table) bool {
+	o := args["x-overflow"]
+	return o == string(OverflowRejectPublish) || o == string(OverflowRejectPublishDLX)
+}
+
+// route is the exchange and routing key of a publish; key is empty for an
+// exchange routing every key to the same queue.
+type route struct {
+	exchange, key string
+}
+
+// rejectOnFull records that publishing through r reaches the queue, which
+// refuses new messages when full.
+func (ad *Amqpx) rejectOnFull(r route, queue string) {
+	ad.fullMu.Lock()
+	defer ad.fullMu.Unlock()
+
+	if ad.fullRoutes == nil {
+		ad.fullRoutes = make(map[route]string)
+	}
+	ad.fullRoutes[r] = queue
+}
+
+// nacked translates the nack err of a message published to exchange with key
+// into ErrQueueFull if it was routed to a queue refusing messages when full.
+func (ad *Amqpx) nacked(exchange, key string, err error) error {
+	if !errors.Is(err, ErrPublishNacked) {
+		return err
+	}
+	r := route{exchange: exchange}
+	if exchange == DefaultExchange {
+		r.key = key
+	}
+	ad.fullMu.Lock()
+	queue, ok := ad.fullRoutes[r]
+	ad.fullMu.Unlock()
+	if !ok {
+		return err
+	}
+	return fmt.Errorf("%w: %s: %w", ErrQueueFull, queue, err)
+}
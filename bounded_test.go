@@ -0,0 +1,59 @@
+package amqpx
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundedQueueOptions(t *testing.T) {
+	spec := QueueSpec{}
+	for _, opt := range []QueueOption{WithMaxLength(10), WithMaxLengthBytes(1 << 20), WithOverflow(OverflowRejectPublish)} {
+		opt(&spec)
+	}
+	require.Equal(t, amqp.Table{"x-max-length": int64(10), "x-max-length-bytes": int64(1 << 20), "x-overflow": "reject-publish"}, spec.Args)
+	require.NoError(t, checkOverflow(spec.Args))
+	require.True(t, rejects(spec.Args))
+
+	WithOverflow(OverflowDropHead)(&spec)
+	require.NoError(t, checkOverflow(spec.Args))
+	require.False(t, rejects(spec.Args))
+	WithOverflow("reject")(&spec)
+	require.ErrorIs(t, checkOverflow(spec.Args), ErrIncompatibleQueueOption)
+}
+
+func TestNackedQueueFull(t *testing.T) {
+	ad := &Amqpx{}
+	ad.rejectOnFull(route{key: "orders"}, "orders")
+	ad.rejectOnFull(route{exchange: "events"}, "orders")
+
+	for _, r := range []route{{DefaultExchange, "orders"}, {"events", "any.key"}} {
+		err := ad.nacked(r.exchange, r.key, ErrPublishNacked)
+		require.ErrorIs(t, err, ErrQueueFull)
+		require.ErrorIs(t, err, ErrPublishNacked)
+		require.EqualError(t, err, "amqpx: queue full: orders: amqpx: publish nacked by the broker")
+	}
+	require.Equal(t, ErrPublishNacked, ad.nacked(DefaultExchange, "invoices", ErrPublishNacked))
+	require.Equal(t, context.Canceled, ad.nacked(DefaultExchange, "orders", context.Canceled))
+}
+
+func TestQueueFull(t *testing.T) {
+	const queue = "test_queue_full"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	require.NoError(t, cli.EnableConfirms())
+	_, _ = cli.QueueDelete(queue, false, false)
+	defer cli.QueueDelete(queue, false, false)
+
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithMaxLength(1), WithOverflow(OverflowRejectPublish))
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, cli.PublishConfirm(ctx, DefaultExchange, queue, []byte("first")))
+	err = cli.PublishConfirm(ctx, DefaultExchange, queue, []byte("second"))
+	require.ErrorIs(t, err, ErrQueueFull)
+	require.ErrorIs(t, err, ErrPublishNacked)
+}
@@ -0,0 +1,165 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// BreakerState is the state of the circuit breaker of an Amqpx.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every publish through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every publish with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen lets a single publish through to probe the broker.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// WithCircuitBreaker makes publishing fail fast with ErrCircuitOpen once
+// threshold consecutive publishes have failed because the channel or the
+// connection was lost. After coolDown, a single publish probes the broker: the
+// breaker closes if it succeeds and opens again otherwise. The breaker also
+// closes as soon as redial re-establishes the channel. If onChange is not nil
+// it is called on every change of state.
+//
+// New fails with ErrInvalidOption if threshold or coolDown is not positive.
+func WithCircuitBreaker(threshold int, coolDown time.Duration, onChange func(from, to BreakerState)) Option {
+	return func(ad *Amqpx) {
+		if threshold <= 0 || coolDown <= 0 {
+			ad.invalid = fmt.Errorf("%w: WithCircuitBreaker(%d, %s)", ErrInvalidOption, threshold, coolDown)
+			return
+		}
+		ad.breaker = &breaker{threshold: threshold, coolDown: coolDown, onChange: onChange, now: time.Now}
+	}
+}
+
+// BreakerState returns the state of the circuit breaker of ad, BreakerClosed
+// if it has none.
+func (ad *Amqpx) BreakerState() BreakerState {
+	if ad.breaker == nil {
+		return BreakerClosed
+	}
+	ad.breaker.mu.Lock()
+	defer ad.breaker.mu.Unlock()
+
+	return ad.breaker.state
+}
+
+// breaker is a circuit breaker around the publish path.
+type breaker struct {
+	threshold int
+	coolDown  time.Duration
+	onChange  func(from, to BreakerState)
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int               // consecutive failures
+	openedAt time.Time         // when the breaker last opened
+	probing  bool              // the probe of the half-open breaker is running
+	changes  [][2]BreakerState // to report to onChange, see unlock
+}
+
+// wrap returns p guarded by the breaker.
+func (b *breaker) wrap(p PublishFunc) PublishFunc {
+	return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+		if err := b.allow(); err != nil {
+			return err
+		}
+		err := p(ctx, exchange, key, msg)
+		b.record(err)
+		return err
+	}
+}
+
+// allow reports whether a publish may go through.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return nil
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.coolDown {
+			return ErrCircuitOpen
+		}
+		b.set(BreakerHalfOpen)
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+	}
+	b.probing = true
+	return nil
+}
+
+// record updates the breaker with the outcome of a publish.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.probing = false
+	switch {
+	case transientPublishError(err):
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+			b.openedAt = b.now()
+			b.set(BreakerOpen)
+		}
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// The caller gave up, which tells nothing about the broker.
+	default:
+		b.failures = 0
+		b.set(BreakerClosed)
+	}
+}
+
+// reset closes the breaker, when the channel has been re-established.
+func (b *breaker) reset() {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.set(BreakerClosed)
+}
+
+// set changes the state of the breaker. It is called with mu held.
+func (b *breaker) set(state BreakerState) {
+	if b.state != state {
+		b.changes = append(b.changes, [2]BreakerState{b.state, state})
+		b.state = state
+	}
+}
+
+// unlock releases mu, then reports the changes of state to onChange.
+func (b *breaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	if b.onChange != nil {
+		for _, c := range changes {
+			b.onChange(c[0], c[1])
+		}
+	}
+}
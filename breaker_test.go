@@ -0,0 +1,76 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var changes []string
+	ad := &Amqpx{}
+	WithCircuitBreaker(2, time.Second*10, func(from, to BreakerState) {
+		changes = append(changes, from.String()+" -> "+to.String())
+	})(ad)
+	now := time.Unix(0, 0)
+	ad.breaker.now = func() time.Time { return now }
+
+	var failure error
+	var calls int
+	send := func(context.Context, string, string, *amqp.Publishing) error {
+		calls++
+		return failure
+	}
+	publish := func() error {
+		return ad.chain(send)(context.Background(), "ex", "key", &amqp.Publishing{})
+	}
+
+	failure = errors.New("PRECONDITION_FAILED")
+	require.Error(t, publish())
+	require.Error(t, publish())
+	require.Equal(t, BreakerClosed, ad.BreakerState(), "only lost channels count")
+
+	failure = amqp.ErrClosed
+	require.ErrorIs(t, publish(), amqp.ErrClosed)
+	require.ErrorIs(t, publish(), amqp.ErrClosed)
+	require.Equal(t, BreakerOpen, ad.BreakerState())
+	calls = 0
+	require.ErrorIs(t, publish(), ErrCircuitOpen)
+	require.Zero(t, calls, "fails fast")
+
+	now = now.Add(time.Second * 10)
+	require.ErrorIs(t, publish(), amqp.ErrClosed, "probe")
+	require.Equal(t, BreakerOpen, ad.BreakerState())
+
+	now = now.Add(time.Second * 10)
+	failure = nil
+	require.NoError(t, publish())
+	require.Equal(t, BreakerClosed, ad.BreakerState())
+
+	failure = amqp.ErrClosed
+	require.Error(t, publish())
+	require.Error(t, publish())
+	ad.breaker.reset() // redial re-established the channel
+	require.Equal(t, BreakerClosed, ad.BreakerState())
+
+	require.Equal(t, []string{
+		"closed -> open",
+		"open -> half-open", "half-open -> open",
+		"open -> half-open", "half-open -> closed",
+		"closed -> open", "open -> closed",
+	}, changes)
+}
+
+func TestWithCircuitBreakerInvalid(t *testing.T) {
+	for _, c := range []struct {
+		threshold int
+		coolDown  time.Duration
+	}{{0, time.Second}, {-1, time.Second}, {3, 0}, {3, -time.Second}} {
+		_, err := New(WithCircuitBreaker(c.threshold, c.coolDown, nil))
+		require.ErrorIs(t, err, ErrInvalidOption, "%d, %s", c.threshold, c.coolDown)
+	}
+}
@@ -0,0 +1,250 @@
+package amqpx
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy tells a BufferedPublisher what to do with a message that does
+// not fit in its buffer.
+type OverflowPolicy int
+
+const (
+	// RejectNew fails the publish of the new message with ErrBufferFull.
+	RejectNew OverflowPolicy = iota
+	// DropOldest discards the oldest buffered messages to make room.
+	DropOldest
+)
+
+// BufferOption configures a BufferedPublisher.
+type BufferOption func(*BufferedPublisher)
+
+// WithOverflowPolicy sets what happens when the buffer is full, RejectNew by
+// default.
+func WithOverflowPolicy(p OverflowPolicy) BufferOption {
+	return func(b *BufferedPublisher) { b.overflow = p }
+}
+
+// BufferedPublisher publishes through an Amqpx, keeping messages in memory
+// while the channel is unavailable and publishing them in order once it has
+// been re-established. Buffered messages are lost if the process exits, so it
+// is meant for messages that may be lost but should not fail the caller.
+type BufferedPublisher struct {
+	cli         *Amqpx
+	maxMessages int
+	maxBytes    int
+	overflow    OverflowPolicy
+
+	mu      sync.Mutex
+	buf     []PublishedMessage
+	bytes   int
+	dropped uint64
+	sending bool          // a message taken from buf is being published
+	empty   chan struct{} // closed while buf is empty and nothing is being sent
+	closed  bool
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBufferedPublisher returns a BufferedPublisher publishing through cli and
+// buffering up to maxMessages messages whose bodies add up to maxBytes at most.
+// Close must be called to release it.
+func NewBufferedPublisher(cli *Amqpx, maxMessages int, maxBytes int, opts ...BufferOption) *BufferedPublisher {
+	b := &BufferedPublisher{
+		cli:         cli,
+		maxMessages: maxMessages,
+		maxBytes:    maxBytes,
+		empty:       make(chan struct{}),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	close(b.empty)
+	for _, opt := range opts {
+		opt(b)
+	}
+	go b.flusher()
+	return b
+}
+
+// Publish publishes a message right away if the channel is open and nothing is
+// buffered, and buffers it otherwise, or if publishing fails because the
+// channel was lost. Other errors are returned as is.
+func (b *BufferedPublisher) Publish(exchange, key string, body []byte, opts ...PublishOption) error {
+	msg := PublishedMessage{Exchange: exchange, Key: key, Publishing: *b.cli.newPublishing(body, opts)}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrPublisherClosed
+	}
+	direct := len(b.buf) == 0 && !b.sending && !b.cli.channel.IsClosed()
+	b.mu.Unlock()
+	if direct {
+		err := b.cli.publisher()(context.Background(), exchange, key, &msg.Publishing)
+		if err == nil || !transientPublishError(err) {
+			return err
+		}
+	}
+	return b.push(msg)
+}
+
+// push appends msg to the buffer, applying the overflow policy.
+func (b *BufferedPublisher) push(msg PublishedMessage) error {
+	size := len(msg.Publishing.Body)
+	if size > b.maxBytes {
+		return ErrBufferFull
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.buf) >= b.maxMessages || b.bytes+size > b.maxBytes {
+		if b.overflow != DropOldest || len(b.buf) == 0 {
+			return ErrBufferFull
+		}
+		b.bytes -= len(b.buf[0].Publishing.Body)
+		b.buf[0] = PublishedMessage{}
+		b.buf = b.buf[1:]
+		b.dropped++
+	}
+	if len(b.buf) == 0 && !b.sending {
+		b.empty = make(chan struct{})
+	}
+	b.buf = append(b.buf, msg)
+	b.bytes += size
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Buffered returns the number of messages waiting to be published, not counting
+// the one being published.
+func (b *BufferedPublisher) Buffered() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.buf)
+}
+
+// Dropped returns the number of messages discarded by the DropOldest policy or
+// because they were refused by the broker when flushed.
+func (b *BufferedPublisher) Dropped() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dropped
+}
+
+// Flush waits until every buffered message has been published or ctx is done.
+func (b *BufferedPublisher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	empty := b.empty
+	b.mu.Unlock()
+
+	select {
+	case <-empty:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops publishing buffered messages, which are discarded; call Flush
+// first to publish them. Publish fails with ErrPublisherClosed afterwards.
+func (b *BufferedPublisher) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	b.mu.Unlock()
+	close(b.stop)
+	<-b.done
+}
+
+// flusher publishes the buffered messages in order while the channel is open.
+func (b *BufferedPublisher) flusher() {
+	defer close(b.done)
+	for {
+		if b.Buffered() == 0 {
+			select {
+			case <-b.wake:
+				continue
+			case <-b.stop:
+				return
+			}
+		}
+		select {
+		case <-b.cli.channelReady():
+		case <-b.stop:
+			return
+		}
+		msg, ok := b.take()
+		if !ok {
+			continue
+		}
+		err := b.cli.publisher()(context.Background(), msg.Exchange, msg.Key, &msg.Publishing)
+		if err != nil && transientPublishError(err) {
+			// The channel is being re-established.
+			b.putBack(msg)
+			select {
+			case <-time.After(time.Second):
+			case <-b.stop:
+				return
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("amqpd-publish: drop buffered message to %q %q: %s\n", msg.Exchange, msg.Key, err)
+		}
+		b.sent(err != nil)
+	}
+}
+
+// take removes the oldest buffered message to publish it.
+func (b *BufferedPublisher) take() (PublishedMessage, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.buf) == 0 {
+		return PublishedMessage{}, false
+	}
+	msg := b.buf[0]
+	b.buf[0] = PublishedMessage{}
+	b.buf = b.buf[1:]
+	b.bytes -= len(msg.Publishing.Body)
+	b.sending = true
+	return msg, true
+}
+
+// putBack returns a message that could not be published to the front of the
+// buffer, even if this exceeds its limits.
+func (b *BufferedPublisher) putBack(msg PublishedMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append([]PublishedMessage{msg}, b.buf...)
+	b.bytes += len(msg.Publishing.Body)
+	b.sending = false
+}
+
+// sent records the end of the publish of a message taken from the buffer.
+func (b *BufferedPublisher) sent(dropped bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sending = false
+	if dropped {
+		b.dropped++
+	}
+	if len(b.buf) == 0 {
+		close(b.empty)
+	}
+}
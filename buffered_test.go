@@ -0,0 +1,83 @@
+package amqpx
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+// outage returns an Amqpx whose channel is being re-established, so publishing
+// fails, until up is called. It records the bodies of published messages.
+func outage() (ad *Amqpx, up func(), published func() []string) {
+	var (
+		down atomic.Bool
+		mu   sync.Mutex
+		sent []string
+	)
+	down.Store(true)
+	ad = &Amqpx{channel: &amqp.Channel{}, ready: make(chan struct{})}
+	ad.UsePublishInterceptor(func(PublishFunc) PublishFunc {
+		return func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+			if down.Load() {
+				return amqp.ErrClosed
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, string(msg.Body))
+			return nil
+		}
+	})
+	up = func() {
+		down.Store(false)
+		ad.setReady(true)
+	}
+	published = func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), sent...)
+	}
+	return ad, up, published
+}
+
+func TestBufferedPublisherDropOldest(t *testing.T) {
+	ad, up, published := outage()
+	b := NewBufferedPublisher(ad, 2, 100, WithOverflowPolicy(DropOldest))
+	defer b.Close()
+
+	for _, body := range []string{"a", "b", "c"} {
+		require.NoError(t, b.Publish("ex", "key", []byte(body)))
+	}
+	require.Equal(t, 2, b.Buffered())
+	require.EqualValues(t, 1, b.Dropped())
+
+	up()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, b.Flush(ctx))
+	require.Equal(t, []string{"b", "c"}, published())
+
+	require.NoError(t, b.Publish("ex", "key", []byte("d")))
+	require.Equal(t, []string{"b", "c", "d"}, published(), "published right away")
+}
+
+func TestBufferedPublisherRejectNew(t *testing.T) {
+	ad, _, _ := outage()
+	b := NewBufferedPublisher(ad, 10, 4)
+
+	require.NoError(t, b.Publish("ex", "key", []byte("abc")))
+	require.ErrorIs(t, b.Publish("ex", "key", []byte("de")), ErrBufferFull)
+	require.ErrorIs(t, b.Publish("ex", "key", []byte("too large")), ErrBufferFull)
+	require.Equal(t, 1, b.Buffered())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	require.ErrorIs(t, b.Flush(ctx), context.DeadlineExceeded)
+
+	b.Close()
+	require.ErrorIs(t, b.Publish("ex", "key", []byte("x")), ErrPublisherClosed)
+}
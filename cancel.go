@@ -0,0 +1,49 @@
+package amqpx
+
+import "log"
+
+// CancelPolicy selects how an entry reacts when the broker cancels its
+// consumer, which happens for instance when the queue is deleted or, for
+// mirrored and quorum queues, when the queue leader moves.
+type CancelPolicy int
+
+const (
+	// CancelResubscribe subscribes to the queue again right away. It is the default.
+	CancelResubscribe CancelPolicy = iota
+	// CancelRedeclare declares the queue (durable) again before subscribing,
+	// recreating it if it was deleted.
+	CancelRedeclare
+	// CancelFatal stops the entry, which reports StatusCancelled.
+	CancelFatal
+)
+
+// WithCancelPolicy sets how the entry reacts to a broker-side cancellation.
+func WithCancelPolicy(p CancelPolicy) EntryOption {
+	return func(e *entry) {
+		e.cancelPolicy = p
+	}
+}
+
+// brokerCancelled handles a basic.cancel received from the broker for the
+// consumer of e. It reports whether the entry should subscribe again.
+func (ac *AmqpxConsumer) brokerCancelled(csr string, e *entry) bool {
+	e.stats.brokerCancels.Add(1)
+	log.Printf("amqpd-consumer: consumer %s cancelled by the broker (queue %s)\n", csr, e.Queue)
+	ac.onCancel(e)
+
+	switch e.cancelPolicy {
+	case CancelFatal:
+		e.stats.setStatus(StatusCancelled)
+		return false
+	case CancelRedeclare:
+		cli, err := ac.client(e)
+		if err == nil {
+			_, err = cli.QueueDeclare(e.Queue)
+		}
+		if err != nil {
+			ac.channelError(e, "redeclare", err, nil)
+			e.stats.recordError(err)
+		}
+	}
+	return true
+}
@@ -0,0 +1,244 @@
+package amqpx
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Headers of the chunks published by PublishChunked. Only the last chunk
+// carries HeaderChunkTotal and HeaderChunkChecksum, the hex-encoded SHA-256 of
+// the whole payload, so that the payload can be streamed.
+const (
+	HeaderChunkID       = "x-chunk-id"
+	HeaderChunkIndex    = "x-chunk-index"
+	HeaderChunkTotal    = "x-chunk-total"
+	HeaderChunkChecksum = "x-chunk-checksum"
+)
+
+// PublishChunked publishes the payload read from r as messages of up to
+// chunkSize bytes, for payloads larger than the broker accepts. The chunks
+// share the properties set by opts, and are published with confirms if they
+// are enabled. Consumers reassemble them with a Reassembler.
+//
+// If PublishChunked fails, the chunks already published are discarded by the
+// Reassembler once it times out.
+func (ad *Amqpx) PublishChunked(ctx context.Context, exchange, key string, r io.Reader, chunkSize int, opts ...PublishOption) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("amqpx: invalid chunk size %d", chunkSize)
+	}
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return fmt.Errorf("amqpx: chunk id: %w", err)
+	}
+	sum := sha256.New()
+	chunk, err := readChunk(r, chunkSize)
+	for index := 0; err == nil; index++ {
+		var following []byte
+		if len(chunk) == chunkSize {
+			if following, err = readChunk(r, chunkSize); err != nil {
+				break
+			}
+		}
+		sum.Write(chunk)
+		headers := amqp.Table{HeaderChunkID: hex.EncodeToString(id[:]), HeaderChunkIndex: int64(index)}
+		last := len(following) == 0
+		if last {
+			headers[HeaderChunkTotal] = int64(index + 1)
+			headers[HeaderChunkChecksum] = hex.EncodeToString(sum.Sum(nil))
+		}
+		chunkOpts := append(opts[:len(opts):len(opts)], WithHeaders(headers))
+		if ad.confirms.Load() {
+			err = ad.PublishConfirm(ctx, exchange, key, chunk, chunkOpts...)
+		} else {
+			err = ad.PublishWithContext(ctx, exchange, key, chunk, chunkOpts...)
+		}
+		if err != nil {
+			return fmt.Errorf("amqpx: publish chunk %d: %w", index, err)
+		}
+		if last {
+			return nil
+		}
+		chunk = following
+	}
+	return fmt.Errorf("amqpx: read chunk: %w", err)
+}
+
+// readChunk reads up to size bytes from r, fewer only at the end of r.
+func readChunk(r io.Reader, size int) ([]byte, error) {
+	b := make([]byte, size)
+	n, err := io.ReadFull(r, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return b[:n], err
+}
+
+// Reassembler is a middleware, see Middleware, reassembling the payloads
+// published by PublishChunked. The chunks are acked as soon as they are
+// buffered in memory, so a payload whose chunks were not all received when
+// the process stops is lost. Deliveries without HeaderChunkID are passed on
+// as they are.
+type Reassembler struct {
+	timeout  time.Duration
+	maxBytes int
+	now      func() time.Time
+
+	mu       sync.Mutex
+	payloads map[string]*chunkedPayload
+	bytes    int
+}
+
+type chunkedPayload struct {
+	chunks  map[int64][]byte
+	bytes   int
+	total   int64 // 0 until the last chunk is received
+	sum     string
+	expires time.Time
+}
+
+// NewReassembler creates a Reassembler discarding the payloads not completed
+// within timeout of their first chunk, and buffering up to maxBytes bytes of
+// incomplete payloads.
+func NewReassembler(timeout time.Duration, maxBytes int) *Reassembler {
+	return &Reassembler{
+		timeout:  timeout,
+		maxBytes: maxBytes,
+		now:      time.Now,
+		payloads: make(map[string]*chunkedPayload),
+	}
+}
+
+// Middleware buffers the chunks and calls next with the last chunk once the
+// payload is complete, its body replaced by the payload and its chunk headers
+// removed. The chunks of a payload whose handler fails are kept until it
+// times out, so that the redelivered last chunk completes it again unless
+// the error was wrapped with Drop.
+//
+// Chunks that would exceed the buffer, and payloads whose checksum does not
+// match, are rejected without requeue and the payload is discarded.
+func (ra *Reassembler) Middleware(next Handler) Handler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		id, ok := d.Headers[HeaderChunkID].(string)
+		if !ok {
+			return next(ctx, d)
+		}
+		payload, err := ra.store(id, d)
+		if err != nil || payload == nil {
+			return err
+		}
+		d.Body = payload
+		d.Headers = stripChunkHeaders(d.Headers)
+		err = next(ctx, d)
+		if err == nil || !requeueOnError(err) {
+			ra.discard(id)
+		}
+		return err
+	}
+}
+
+// store buffers the chunk d of payload id, and returns the payload once it is
+// complete.
+func (ra *Reassembler) store(id string, d amqp.Delivery) ([]byte, error) {
+	index, ok := tableInt(d.Headers, HeaderChunkIndex)
+	if !ok || index < 0 {
+		return nil, Drop(fmt.Errorf("amqpx: chunk of %s without index", id))
+	}
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	ra.expire()
+	p := ra.payloads[id]
+	if p == nil {
+		p = &chunkedPayload{chunks: make(map[int64][]byte), expires: ra.now().Add(ra.timeout)}
+		ra.payloads[id] = p
+	}
+	if total, ok := tableInt(d.Headers, HeaderChunkTotal); ok {
+		p.total = total
+		p.sum, _ = d.Headers[HeaderChunkChecksum].(string)
+	}
+	grow := len(d.Body) - len(p.chunks[index]) // chunks may be redelivered
+	if ra.bytes+grow > ra.maxBytes {
+		ra.remove(id)
+		return nil, Drop(fmt.Errorf("%w: chunk %d of %s", ErrChunkBufferFull, index, id))
+	}
+	p.chunks[index] = d.Body
+	p.bytes += grow
+	ra.bytes += grow
+	if p.total == 0 || int64(len(p.chunks)) < p.total {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(p.bytes)
+	for i := int64(0); i < p.total; i++ {
+		chunk, ok := p.chunks[i]
+		if !ok {
+			// Chunks beyond the total, the publisher reused the id.
+			ra.remove(id)
+			return nil, Drop(fmt.Errorf("amqpx: chunks of %s do not match their total %d", id, p.total))
+		}
+		buf.Write(chunk)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	if hex.EncodeToString(sum[:]) != p.sum {
+		ra.remove(id)
+		return nil, Drop(fmt.Errorf("%w: %s", ErrChunkChecksum, id))
+	}
+	return buf.Bytes(), nil
+}
+
+// expire discards the payloads that timed out. The caller must hold mu.
+func (ra *Reassembler) expire() {
+	now := ra.now()
+	for id, p := range ra.payloads {
+		if now.After(p.expires) {
+			log.Printf("amqpd-consumer: discard chunked payload %s: %d chunks received after %s\n", id, len(p.chunks), ra.timeout)
+			ra.remove(id)
+		}
+	}
+}
+
+// remove discards payload id. The caller must hold mu.
+func (ra *Reassembler) remove(id string) {
+	if p := ra.payloads[id]; p != nil {
+		ra.bytes -= p.bytes
+		delete(ra.payloads, id)
+	}
+}
+
+func (ra *Reassembler) discard(id string) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	ra.remove(id)
+}
+
+// Buffered returns the number of bytes of incomplete payloads being buffered.
+func (ra *Reassembler) Buffered() int {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	return ra.bytes
+}
+
+func stripChunkHeaders(headers amqp.Table) amqp.Table {
+	stripped := make(amqp.Table, len(headers))
+	for k, v := range headers {
+		switch k {
+		case HeaderChunkID, HeaderChunkIndex, HeaderChunkTotal, HeaderChunkChecksum:
+		default:
+			stripped[k] = v
+		}
+	}
+	return stripped
+}
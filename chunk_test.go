@@ -0,0 +1,112 @@
+package amqpx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+// publishChunks publishes payload with PublishChunked and returns the chunks
+// as deliveries.
+func publishChunks(t *testing.T, payload []byte, chunkSize int) []amqp.Delivery {
+	ad := &Amqpx{}
+	var chunks []amqp.Delivery
+	ad.SetPublishInterceptors(func(PublishFunc) PublishFunc {
+		return func(_ context.Context, _, key string, msg *amqp.Publishing) error {
+			chunks = append(chunks, amqp.Delivery{RoutingKey: key, Headers: msg.Headers, Body: msg.Body, MessageId: msg.MessageId})
+			return nil
+		}
+	})
+	err := ad.PublishChunked(context.Background(), "", "q", bytes.NewReader(payload), chunkSize, WithMessageID("export"))
+	require.NoError(t, err)
+	return chunks
+}
+
+func TestPublishChunked(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 10)
+	chunks := publishChunks(t, payload, 30)
+	require.Len(t, chunks, 4)
+	for i, c := range chunks {
+		require.Equal(t, int64(i), c.Headers[HeaderChunkIndex])
+		require.Equal(t, chunks[0].Headers[HeaderChunkID], c.Headers[HeaderChunkID])
+		require.Equal(t, "export", c.MessageId)
+	}
+	require.Equal(t, int64(4), chunks[3].Headers[HeaderChunkTotal])
+	require.NotContains(t, chunks[2].Headers, HeaderChunkTotal)
+	require.Len(t, chunks[3].Body, 10)
+
+	require.Len(t, publishChunks(t, payload, 50), 2, "exact multiple")
+	require.Len(t, publishChunks(t, nil, 50), 1, "empty payload")
+
+	err := (&Amqpx{}).PublishChunked(context.Background(), "", "q", bytes.NewReader(payload), 0)
+	require.Error(t, err)
+}
+
+func TestReassembler(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 10)
+	ra := NewReassembler(time.Minute, 1000)
+	var got [][]byte
+	var failure error
+	h := ra.Middleware(func(_ context.Context, d amqp.Delivery) error {
+		require.NotContains(t, d.Headers, HeaderChunkID)
+		got = append(got, d.Body)
+		return failure
+	})
+	ctx := context.Background()
+
+	// Out of order, with a redelivered chunk.
+	chunks := publishChunks(t, payload, 30)
+	for _, i := range []int{1, 3, 1, 0} {
+		require.NoError(t, h(ctx, chunks[i]))
+	}
+	require.Empty(t, got)
+	require.Equal(t, 70, ra.Buffered())
+
+	// A failed handler leaves the chunks for the redelivery.
+	failure = errors.New("unavailable")
+	require.ErrorIs(t, h(ctx, chunks[2]), failure)
+	failure = nil
+	require.NoError(t, h(ctx, chunks[2]))
+	require.Equal(t, [][]byte{payload, payload}, got)
+	require.Zero(t, ra.Buffered())
+
+	require.NoError(t, h(ctx, amqp.Delivery{Body: []byte("plain")}))
+	require.Equal(t, []byte("plain"), got[2])
+
+	// Corrupted chunk.
+	chunks = publishChunks(t, payload, 30)
+	chunks[0].Body = append([]byte("X"), chunks[0].Body[1:]...)
+	for _, c := range chunks[:3] {
+		require.NoError(t, h(ctx, c))
+	}
+	err := h(ctx, chunks[3])
+	require.Len(t, got, 3)
+	require.ErrorIs(t, err, ErrChunkChecksum)
+	require.ErrorIs(t, err, ErrDropMessage)
+	require.Zero(t, ra.Buffered())
+}
+
+func TestReassemblerLimits(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 10)
+	ra := NewReassembler(time.Minute, 50)
+	now := time.Unix(0, 0)
+	ra.now = func() time.Time { return now }
+	h := ra.Middleware(func(context.Context, amqp.Delivery) error { return nil })
+	ctx := context.Background()
+
+	chunks := publishChunks(t, payload, 30)
+	require.NoError(t, h(ctx, chunks[0]))
+	require.ErrorIs(t, h(ctx, chunks[1]), ErrChunkBufferFull)
+	require.Zero(t, ra.Buffered(), "the payload cannot complete anymore")
+
+	require.NoError(t, h(ctx, chunks[0]))
+	now = now.Add(time.Minute * 2)
+	other := publishChunks(t, []byte("small"), 30)
+	require.NoError(t, h(ctx, other[0]))
+	require.Zero(t, ra.Buffered(), "timed out")
+}
@@ -0,0 +1,146 @@
+package amqpx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"reflect"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Codec converts between Go values and message bodies of a content type.
+type Codec interface {
+	// Marshal encodes v and returns the body together with its content type.
+	Marshal(v any) ([]byte, string, error)
+	// Unmarshal decodes data, published with contentType, into v.
+	Unmarshal(data []byte, contentType string, v any) error
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON.
+func (JSONCodec) Marshal(v any) ([]byte, string, error) {
+	body, err := json.Marshal(v)
+	return body, ContentTypeJSON, err
+}
+
+// Unmarshal decodes JSON data into v.
+func (JSONCodec) Unmarshal(data []byte, _ string, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// UnknownContentTypeError is returned when no codec is registered for the
+// content type of a message.
+type UnknownContentTypeError struct {
+	ContentType string
+}
+
+func (e *UnknownContentTypeError) Error() string {
+	return fmt.Sprintf("amqpx: no codec registered for content type %q", e.ContentType)
+}
+
+var (
+	// DefaultCodec is used by PublishValue and to decode deliveries without a content type.
+	DefaultCodec Codec = JSONCodec{}
+
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{ContentTypeJSON: JSONCodec{}}
+)
+
+// RegisterCodec registers c for the given content types, replacing any codec
+// previously registered for them. Parameters such as charset are ignored when
+// matching, so "application/json; charset=utf-8" uses the "application/json" codec.
+//
+//	amqpx.RegisterCodec(ProtoCodec{}, "application/x-protobuf")
+func RegisterCodec(c Codec, contentTypes ...string) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	for _, ct := range contentTypes {
+		codecs[mediaType(ct)] = c
+	}
+}
+
+// CodecFor returns the codec registered for contentType. An empty content type
+// resolves to DefaultCodec; an unregistered one yields an *UnknownContentTypeError.
+func CodecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		return DefaultCodec, nil
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[mediaType(contentType)]
+	if !ok {
+		return nil, &UnknownContentTypeError{ContentType: contentType}
+	}
+	return c, nil
+}
+
+// mediaType strips parameters from a content type.
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
+
+// PublishValue encodes v with DefaultCodec and publishes it to the specified
+// exchange with the given routing key and the codec's content type, which opts
+// cannot override.
+func (ad *Amqpx) PublishValue(exchange, key string, v any, opts ...PublishOption) error {
+	body, contentType, err := DefaultCodec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("amqpx: encode %s: %w", contentType, err)
+	}
+	return ad.Publish(exchange, key, body, append(opts, WithContentType(contentType))...)
+}
+
+// AddDecodedFunc adds a queue consumption configuration whose handler receives
+// the message body decoded into a T by the codec registered for the delivery's
+// content type. Deliveries with an unknown content type or a body that fails to
+// decode are rejected without requeue.
+func AddDecodedFunc[T any](ac *AmqpxConsumer, queue, consumer string, fn func(T) error, opts ...EntryOption) (string, error) {
+	if fn == nil {
+		return "", ErrNilHandler
+	}
+	return ac.AddDeliveryFunc(queue, consumer, func(d amqp.Delivery) error {
+		codec, err := CodecFor(d.ContentType)
+		if err != nil {
+			return Drop(err)
+		}
+		var msg T
+		if err := codec.Unmarshal(d.Body, d.ContentType, &msg); err != nil {
+			return Drop(fmt.Errorf("amqpx: decode %s: %w", d.ContentType, err))
+		}
+		return fn(msg)
+	}, opts...)
+}
+
+// PublishTyped encodes msg with DefaultCodec and publishes it to exchange with
+// routing key key and the content type of the codec, which opts may override.
+// When ad is in confirm mode, see EnableConfirms, it waits for the message to
+// be confirmed like PublishConfirm. Use WithType to tell consumers the type of
+// the message, e.g. WithType(TypeName[T]()).
+func PublishTyped[T any](ctx context.Context, ad *Amqpx, exchange, key string, msg T, opts ...PublishOption) error {
+	body, contentType, err := DefaultCodec.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("amqpx: encode %s: %w", contentType, err)
+	}
+	opts = append([]PublishOption{WithContentType(contentType)}, opts...)
+	if ad.confirms.Load() {
+		return ad.PublishConfirm(ctx, exchange, key, body, opts...)
+	}
+	return ad.PublishWithContext(ctx, exchange, key, body, opts...)
+}
+
+// TypeName returns the name of the Go type T, such as "orders.Created", to be
+// used as the type of messages carrying a T.
+func TypeName[T any]() string {
+	return reflect.TypeFor[T]().String()
+}
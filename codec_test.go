@@ -0,0 +1,71 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v any) ([]byte, string, error) {
+	return []byte(v.(string)), "text/x-upper", nil
+}
+
+func (upperCodec) Unmarshal(data []byte, _ string, v any) error {
+	*(v.(*string)) = string(data)
+	return nil
+}
+
+func TestCodecRegistry(t *testing.T) {
+	c, err := CodecFor("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultCodec, c)
+
+	c, err = CodecFor("application/json; charset=utf-8")
+	require.NoError(t, err)
+	require.IsType(t, JSONCodec{}, c)
+
+	_, err = CodecFor("text/x-upper")
+	var ue *UnknownContentTypeError
+	require.True(t, errors.As(err, &ue))
+	require.Equal(t, "text/x-upper", ue.ContentType)
+
+	RegisterCodec(upperCodec{}, "text/x-upper")
+	c, err = CodecFor("text/x-upper")
+	require.NoError(t, err)
+
+	var s string
+	require.NoError(t, c.Unmarshal([]byte("HELLO"), "text/x-upper", &s))
+	require.Equal(t, "HELLO", s)
+}
+
+type orderCreated struct {
+	ID string `json:"id"`
+}
+
+func TestPublishTyped(t *testing.T) {
+	var seen amqp.Publishing
+	ad := &Amqpx{}
+	ad.UsePublishInterceptor(func(PublishFunc) PublishFunc {
+		return func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+			seen = *msg
+			return nil
+		}
+	})
+
+	err := PublishTyped(context.Background(), ad, "ex", "key", orderCreated{ID: "42"},
+		WithType(TypeName[orderCreated]()), WithPersistent())
+	require.NoError(t, err)
+	require.Equal(t, amqp.Publishing{
+		ContentType:  ContentTypeJSON,
+		DeliveryMode: amqp.Persistent,
+		Type:         "amqpx.orderCreated",
+		Body:         []byte(`{"id":"42"}`),
+	}, seen)
+
+	require.Error(t, PublishTyped(context.Background(), ad, "ex", "key", func() {}))
+}
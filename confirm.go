@@ -0,0 +1,197 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// EnableConfirms puts the channel of ad in confirm mode, so that the broker
+// acknowledges every message it takes responsibility for, and PublishConfirm
+// can be used. Confirm mode is restored on the channels opened by redial.
+func (ad *Amqpx) EnableConfirms() error {
+	ad.confirms.Store(true)
+	tracker, err := ad.confirmMode(ad.channel)
+	if err != nil {
+		return fmt.Errorf("amqpd confirm mode err: %s", err)
+	}
+	ad.tracker.Store(tracker)
+	return nil
+}
+
+// confirmMode puts ch in confirm mode and starts tracking the confirmations of
+// the messages published on it by PublishAsync.
+func (ad *Amqpx) confirmMode(ch *amqp.Channel) (*confirmTracker, error) {
+	t := &confirmTracker{ch: ch, pending: make(map[uint64]PublishedMessage)}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 256))
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+	go ad.listenConfirms(t, confirms)
+	return t, nil
+}
+
+// PublishConfirm is like PublishWithContext but blocks until the broker
+// confirms the message. It returns ErrPublishNacked if the broker nacks it,
+// wrapped with ErrQueueFull if the queue is full, see WithOverflow, and
+// ctx.Err() if ctx is done first, in which case the outcome is unknown.
+func (ad *Amqpx) PublishConfirm(ctx context.Context, exchange, key string, body []byte, opts ...PublishOption) error {
+	msg := ad.newPublishing(body, opts)
+	return ad.chain(ad.sendConfirm)(ctx, exchange, key, msg)
+}
+
+// sendConfirm is the innermost PublishFunc of PublishConfirm, it writes msg to
+// the channel and waits for its confirmation.
+func (ad *Amqpx) sendConfirm(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+	_, err := ad.publishConfirmed(ctx, exchange, key, false, msg)
+	return err
+}
+
+// publishConfirmed writes msg to a channel and waits for its confirmation. It
+// returns the listener of the messages returned on the channel.
+func (ad *Amqpx) publishConfirmed(ctx context.Context, exchange, key string, mandatory bool, msg *amqp.Publishing) (*returnListener, error) {
+	if !ad.confirms.Load() {
+		return nil, ErrConfirmsDisabled
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pc, release, err := ad.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := *msg
+	var dc *amqp.DeferredConfirmation
+	err = abandonable(ctx, func() (err error) {
+		defer release()
+		dc, err = pc.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, false, m)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dc == nil {
+		// The channel was replaced by one that is not in confirm mode yet.
+		return nil, ErrConfirmsDisabled
+	}
+	if err := waitConfirm(ctx, pc.ch, dc); err != nil {
+		return nil, ad.nacked(exchange, key, err)
+	}
+	return pc.returns, nil
+}
+
+// waitConfirm waits for the confirmation dc of a message published on ch.
+func waitConfirm(ctx context.Context, ch *amqp.Channel, dc *amqp.DeferredConfirmation) error {
+	acked, err := dc.WaitContext(ctx)
+	switch {
+	case err != nil:
+		return err
+	case acked:
+		return nil
+	case ch.IsClosed():
+		// Outstanding confirmations are nacked when the channel closes.
+		return fmt.Errorf("amqpd confirm err: %w", amqp.ErrClosed)
+	default:
+		return ErrPublishNacked
+	}
+}
+
+// PublishedMessage is a message published by PublishAsync.
+type PublishedMessage struct {
+	Exchange   string
+	Key        string
+	Publishing amqp.Publishing
+}
+
+// confirmTracker holds the messages published by PublishAsync on a channel and
+// not confirmed yet, by delivery tag. pending is nil once the channel is closed.
+type confirmTracker struct {
+	ch      *amqp.Channel
+	mu      sync.Mutex
+	pending map[uint64]PublishedMessage
+}
+
+// OnConfirm registers the callback of PublishAsync. It is called once for
+// every message, with acked false if the broker nacked it or if the channel
+// was lost before the confirmation arrived, in which case the message may or
+// may not have been delivered and can be republished. Delivery tags start over
+// on the channel opened by redial. fn runs on the goroutine reading the
+// confirmations and must not block.
+func (ad *Amqpx) OnConfirm(fn func(tag uint64, acked bool, msg PublishedMessage)) {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	ad.onConfirm = fn
+}
+
+// PublishAsync publishes a message without waiting for its confirmation and
+// returns its delivery tag; the outcome is reported to the OnConfirm callback.
+// EnableConfirms must have been called.
+func (ad *Amqpx) PublishAsync(exchange, key string, body []byte, opts ...PublishOption) (uint64, error) {
+	msg := ad.newPublishing(body, opts)
+	var tag uint64
+	err := ad.chain(func(_ context.Context, exchange, key string, msg *amqp.Publishing) (err error) {
+		tag, err = ad.sendAsync(exchange, key, msg)
+		return err
+	})(context.Background(), exchange, key, msg)
+	return tag, err
+}
+
+// sendAsync writes msg to the channel and records it as pending confirmation.
+func (ad *Amqpx) sendAsync(exchange, key string, msg *amqp.Publishing) (uint64, error) {
+	t := ad.tracker.Load()
+	if !ad.confirms.Load() || t == nil {
+		return 0, ErrConfirmsDisabled
+	}
+	// Holding the lock while publishing keeps the confirmation from being
+	// processed before the message is recorded.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		return 0, fmt.Errorf("amqpd publish err: %w", amqp.ErrClosed)
+	}
+	dc, err := t.ch.PublishWithDeferredConfirm(exchange, key, false, false, *msg)
+	if err != nil {
+		return 0, err
+	}
+	t.pending[dc.DeliveryTag] = PublishedMessage{Exchange: exchange, Key: key, Publishing: *msg}
+	ad.publishing.add() // until listenConfirms reports the confirmation
+	return dc.DeliveryTag, nil
+}
+
+// listenConfirms reports the confirmations of the channel of t until it is
+// closed, then reports what is still pending as nacked. The library splits
+// multiple confirmations and delivers them in order of delivery tag.
+func (ad *Amqpx) listenConfirms(t *confirmTracker, confirms <-chan amqp.Confirmation) {
+	for c := range confirms {
+		t.mu.Lock()
+		msg, ok := t.pending[c.DeliveryTag]
+		delete(t.pending, c.DeliveryTag)
+		t.mu.Unlock()
+		if ok {
+			ad.confirmed(c.DeliveryTag, c.Ack, msg)
+			ad.publishing.done()
+		}
+	}
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	for tag, msg := range pending {
+		ad.confirmed(tag, false, msg)
+		ad.publishing.done()
+	}
+}
+
+// confirmed calls the OnConfirm callback, if any.
+func (ad *Amqpx) confirmed(tag uint64, acked bool, msg PublishedMessage) {
+	ad.publishMu.Lock()
+	fn := ad.onConfirm
+	ad.publishMu.Unlock()
+	if fn != nil {
+		fn(tag, acked, msg)
+	}
+}
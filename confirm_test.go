@@ -0,0 +1,96 @@
+package amqpx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishConfirmDisabled(t *testing.T) {
+	ad := &Amqpx{}
+	require.ErrorIs(t, ad.PublishConfirm(context.Background(), "", "q", []byte("body")), ErrConfirmsDisabled)
+}
+
+func TestListenConfirms(t *testing.T) {
+	ad := &Amqpx{}
+	got := map[uint64]bool{}
+	ad.OnConfirm(func(tag uint64, acked bool, msg PublishedMessage) {
+		require.Equal(t, "key", msg.Key)
+		got[tag] = acked
+	})
+	tracker := &confirmTracker{pending: map[uint64]PublishedMessage{}}
+	for tag := uint64(1); tag <= 4; tag++ {
+		tracker.pending[tag] = PublishedMessage{Key: "key"}
+	}
+
+	confirms := make(chan amqp.Confirmation, 4)
+	confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: false}
+	confirms <- amqp.Confirmation{DeliveryTag: 9, Ack: true} // published by PublishConfirm
+	close(confirms)
+	ad.listenConfirms(tracker, confirms)
+
+	require.Equal(t, map[uint64]bool{1: true, 2: false, 3: false, 4: false}, got)
+	require.Nil(t, tracker.pending)
+
+	_, err := (&Amqpx{}).PublishAsync("", "q", []byte("body"))
+	require.ErrorIs(t, err, ErrConfirmsDisabled)
+}
+
+func TestPublishAsync(t *testing.T) {
+	const queue = "test_publish_async_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, cli.EnableConfirms())
+
+	confirmed := make(chan uint64, 3)
+	cli.OnConfirm(func(tag uint64, acked bool, msg PublishedMessage) {
+		require.True(t, acked)
+		require.Equal(t, queue, msg.Key)
+		confirmed <- tag
+	})
+	var tags []uint64
+	for i := 0; i < 3; i++ {
+		tag, err := cli.PublishAsync(DefaultExchange, queue, []byte("async"))
+		require.NoError(t, err)
+		tags = append(tags, tag)
+	}
+	for range tags {
+		select {
+		case tag := <-confirmed:
+			require.Contains(t, tags, tag)
+		case <-time.After(time.Second * 2):
+			t.Fatal("missing confirmation")
+		}
+	}
+}
+
+func TestPublishConfirm(t *testing.T) {
+	const queue = "test_confirm_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, cli.EnableConfirms())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	require.NoError(t, cli.PublishConfirm(ctx, DefaultExchange, queue, []byte("confirmed")))
+
+	// Confirm mode survives the replacement of the channel.
+	require.NoError(t, cli.channel.Close())
+	require.Eventually(t, func() bool {
+		return cli.PublishConfirm(ctx, DefaultExchange, queue, []byte("after redial")) == nil
+	}, time.Second*2, time.Millisecond*50)
+}
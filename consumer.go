@@ -2,125 +2,879 @@ package amqpx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"runtime"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 var consumerSeq uint64
 
 type entry struct {
-	Queue   string
-	Handler func([]byte) error
+	Queue        string
+	tag          string // consumer tag, set by addEntry
+	group        string // name of the AddFuncMulti group, if any
+	Handler      Handler
+	BatchHandler func([]amqp.Delivery) error
+	middlewares  []Middleware
+
+	batchSize     int           // deliveries per BatchHandler call
+	flushInterval time.Duration // maximum time a partial batch is held
+
+	workers  int // number of goroutines processing deliveries concurrently
+	prefetch int // QoS prefetch count, raised to at least workers, batchSize and ackEvery
+
+	timeout time.Duration // maximum handler execution time, 0 means unlimited
+	limiter *tokenBucket  // shared by all workers, nil means unlimited
+
+	requeuePolicy RequeuePolicy // overrides the default requeue decision when set
+	errorHandler  ErrorHandler  // overrides the ErrorHandler of the AmqpxConsumer when set
+
+	ackEvery  int           // acks coalesced into one multiple ack, 0 disables batching
+	ackDelay  time.Duration // maximum time an ack is held back
+	manual    bool          // the handler settles deliveries itself
+	autoAck   bool          // consume in auto-ack mode, deliveries are never settled by the loop
+	args      amqp.Table    // basic.consume arguments, sent on every subscription
+	declare   *QueueSpec    // queue declared before every subscription, see WithDeclare
+	bindings  []BindingSpec // bindings declared after the queue
+	exclusive bool          // request exclusive consumption of the queue
+	single    bool          // single active consumer, active once it receives a delivery
+	onActive  func(active bool)
+	exclState atomic.Int32 // exclusiveActive or exclusiveStandby once known
+	cli       *Amqpx       // channel of the entry, opened on first use
+
+	streamOffset any   // x-stream-offset sent on every subscription, see WithStreamOffset
+	invalid      error // error of an option, returned by addEntry
+
+	cancelPolicy CancelPolicy  // reaction to a broker-side cancellation
+	cancelled    chan struct{} // signalled when the broker cancels the consumer
+
+	quit chan struct{}  // closed when the entry is removed
+	wg   sync.WaitGroup // tracks the run goroutine of the entry
+
+	mu      sync.Mutex
+	paused  bool
+	pauses  uint64        // number of Pause calls, lets run tell a pause from a channel drop
+	resumed chan struct{} // closed by Resume
+	unwait  func()        // interrupts the rate limiter waits of the subscription
+
+	stats entryStats
+
+	quarantine         bool   // publish deliveries whose handler panicked to the quarantine exchange
+	quarantineExchange string // exchange receiving quarantined deliveries
+	quarantineKey      string // routing key of quarantined deliveries
+
+	maxRetries  int             // deliveries allowed before dead-lettering, 0 means unlimited
+	dlExchange  string          // dead-letter exchange used once maxRetries is reached
+	dlKey       string          // dead-letter routing key used once maxRetries is reached
+	retryDelays []time.Duration // delays of the wait queues failed deliveries go through, empty means none
+	retryLadder bool            // dead-letter after the last of retryDelays instead of repeating it
+
+	dedupe           DedupeStore // nil disables deduplication
+	dedupeKey        func(amqp.Delivery) string
+	dedupeTTL        time.Duration
+	dedupeFailClosed bool // requeue instead of processing when the store fails
+}
+
+// autoAckMode reports whether e consumes in auto-ack mode.
+func (e *entry) autoAckMode() bool {
+	return e.autoAck && !e.manual && e.ackEvery == 0
+}
+
+// setActive records whether e holds its exclusive subscription, or is the
+// single active consumer of its queue, and notifies the WithExclusive or
+// WithSingleActive callback on changes.
+func (e *entry) setActive(active bool) {
+	state := exclusiveStandby
+	if active {
+		state = exclusiveActive
+	} else if e.exclusive {
+		e.stats.setStatus(StatusStandby)
+	}
+	if e.exclState.Swap(state) == state {
+		return
+	}
+	if e.onActive != nil {
+		e.onActive(active)
+	}
+}
+
+const (
+	exclusiveActive int32 = iota + 1
+	exclusiveStandby
+)
+
+// EntryOption configures a single queue consumption registered with AddFunc and friends.
+type EntryOption func(*entry)
+
+// WithWorkers processes the deliveries of a queue with n goroutines instead of
+// one. Each delivery is acked or rejected by the worker that handled it, and the
+// prefetch count is raised to at least n so no worker is starved.
+//
+// Message ordering is not preserved when n is greater than 1.
+func WithWorkers(n int) EntryOption {
+	return func(e *entry) {
+		e.workers = n
+	}
+}
+
+// WithHandlerTimeout bounds the execution time of the handler. The handler's
+// context carries a deadline of d; if the handler has not returned when it
+// expires, the delivery is nacked with requeue and the handler goroutine is
+// abandoned. Abandoned handlers are counted by AbandonedHandlers.
+func WithHandlerTimeout(d time.Duration) EntryOption {
+	return func(e *entry) {
+		e.timeout = d
+	}
+}
+
+// WithAutoAck consumes the queue in auto-ack mode: the broker considers a
+// message acknowledged as soon as it is delivered, saving the ack round trip at
+// the cost of losing messages whose handler fails. Handler errors are only
+// logged. It has no effect on entries added with AddManualAckFunc, nor in
+// combination with WithAckEvery.
+func WithAutoAck() EntryOption {
+	return func(e *entry) {
+		e.autoAck = true
+	}
+}
+
+// WithConsumeArgs sets the arguments sent with basic.consume, such as
+// x-priority or x-stream-offset. They are sent again every time the consumer
+// subscribes, including after the channel is re-established. If the broker
+// rejects them, the entry stops with a *ConsumeError instead of retrying.
+func WithConsumeArgs(args amqp.Table) EntryOption {
+	return func(e *entry) {
+		e.args = args
+	}
+}
+
+// WithExclusive requests exclusive consumption of the queue, so that only one
+// process consumes it at a time. While another consumer holds the queue, the
+// broker refuses the subscription; the entry then reports StatusStandby and
+// keeps retrying until it acquires the queue. If onActive is not nil it is
+// called with true when this instance becomes the active consumer and with
+// false when it becomes the standby. Each refusal closes the
+// entry's channel, which is reopened before the next attempt.
+func WithExclusive(onActive func(active bool)) EntryOption {
+	return func(e *entry) {
+		e.exclusive = true
+		e.onActive = onActive
+	}
+}
+
+// WithPrefetch sets the QoS prefetch count, the maximum number of unacknowledged
+// deliveries the broker sends to this consumer.
+func WithPrefetch(n int) EntryOption {
+	return func(e *entry) {
+		e.prefetch = n
+	}
 }
 
 // AmqpxConsumer is a struct for an AMQP consumer, used for asynchronously consuming messages from multiple queues.
 type AmqpxConsumer struct {
-	entries   map[string]*entry
-	cli       *Amqpx
-	running   bool
-	runningMu sync.Mutex
-	jobWaiter sync.WaitGroup
+	entries      map[string]*entry
+	cli          *Amqpx
+	running      atomic.Bool // written under runningMu, read without it by the run loops
+	runningMu    sync.Mutex
+	jobWaiter    sync.WaitGroup
+	ctx          context.Context
+	cancel       context.CancelFunc
+	stopped      chan struct{} // closed when Stop is called
+	stopOnce     sync.Once
+	stopDone     context.Context // cancelled once the shutdown is complete
+	stopErr      error
+	force        context.CancelFunc // makes the shutdown stop waiting for handlers
+	gracePeriod  time.Duration
+	backoff      Backoff
+	backoffReset time.Duration // subscription lifetime after which failures are forgotten
+	now          func() time.Time
+	after        func(time.Duration) <-chan time.Time
+	panicRequeue bool
+	abandoned    int64 // handler goroutines still running after their timeout
+	inflight     int64 // handler invocations that have not returned yet
+	middlewares  []Middleware
+	recoverer    Middleware
+	errorHandler ErrorHandler
+	hooks        Hooks
+	metrics      MetricsCollector // nil discards metrics
+
+	tagFunc            ConsumerTagFunc
+	watchdogInterval   time.Duration // 0 disables the watchdog
+	watchdogStaleAfter time.Duration
+	groups             map[string]*consumerGroup
+
+	outstanding      sync.WaitGroup // deliveries awaiting a manual acknowledgement
+	manualAckTimeout time.Duration
+
+	clientOpts []Option // set by WithClientOptions
+}
+
+// ConsumerOption configures an AmqpxConsumer created by NewAmqpxConsumer.
+type ConsumerOption func(*AmqpxConsumer)
+
+// WithGracePeriod sets how long Stop waits for in-flight handlers to finish on
+// their own before cancelling the context passed to them. By default the context
+// is cancelled as soon as the AMQP consumers have been cancelled.
+func WithGracePeriod(d time.Duration) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.gracePeriod = d
+	}
+}
+
+// WithPanicRequeue controls whether a delivery whose handler panicked is requeued.
+// It defaults to true, like any other handler error; set it to false so that a
+// poison message that crashes the handler is discarded (or dead-lettered) instead
+// of being redelivered forever.
+func WithPanicRequeue(requeue bool) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.panicRequeue = requeue
+	}
+}
+
+// WithClientOptions sets the options of the Amqpx instances the AmqpxConsumer
+// opens: the one it publishes retries and dead letters with, one per entry,
+// and the watchdog's. With WithURL or WithConfig, the consumer thus consumes
+// from another broker or vhost than the package Connection, on connections of
+// its own.
+func WithClientOptions(opts ...Option) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.clientOpts = append(ac.clientOpts, opts...)
+	}
+}
+
+// PanicError is returned for a delivery whose handler panicked.
+type PanicError struct {
+	Value any    // value passed to panic
+	Stack []byte // stack trace of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
 }
 
 // NewAmqpxConsumer creates a new AmqpxConsumer instance.
-func NewAmqpxConsumer() (*AmqpxConsumer, error) {
-	cli, err := New()
+func NewAmqpxConsumer(opts ...ConsumerOption) (*AmqpxConsumer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ac := &AmqpxConsumer{
+		entries:      make(map[string]*entry),
+		runningMu:    sync.Mutex{},
+		ctx:          ctx,
+		cancel:       cancel,
+		stopped:      make(chan struct{}),
+		backoff:      DefaultBackoff,
+		backoffReset: DefaultBackoffReset,
+		now:          time.Now,
+		after:        time.After,
+		panicRequeue: true,
+		recoverer:    Recover,
+
+		manualAckTimeout: DefaultManualAckTimeout,
+	}
+	for _, opt := range opts {
+		opt(ac)
+	}
+	cli, err := New(ac.clientOpts...)
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("amqpd connect err, %s", err)
 	}
-	return &AmqpxConsumer{
-		entries:   make(map[string]*entry),
-		cli:       cli,
-		running:   false,
-		runningMu: sync.Mutex{},
-	}, nil
+	// Retries, dead letters and quarantined messages are republished with
+	// confirms before their delivery is acked.
+	if err := cli.EnableConfirms(); err != nil {
+		cli.Close()
+		cancel()
+		return nil, err
+	}
+	if ac.metrics != nil {
+		cli.SetMetrics(ac.metrics)
+	}
+	ac.cli = cli
+	return ac, nil
 }
 
 // AddFunc adds a queue consumption configuration to the AmqpxConsumer.
-func (ac *AmqpxConsumer) AddFunc(queue, consumer string, fn func([]byte) error) {
+// It returns the consumer tag generated for the entry, which identifies it on
+// the broker and in the other methods of the AmqpxConsumer. If the
+// AmqpxConsumer is already running, consumption of the queue starts immediately.
+func (ac *AmqpxConsumer) AddFunc(queue, consumer string, fn func([]byte) error, opts ...EntryOption) (string, error) {
+	var h Handler
+	if fn != nil {
+		h = func(_ context.Context, d amqp.Delivery) error {
+			return fn(d.Body)
+		}
+	}
+	return ac.addEntry(consumer, &entry{Queue: queue, Handler: h}, opts)
+}
+
+// AddFuncCtx adds a queue consumption configuration whose handler receives a
+// context that is cancelled when Stop is called (after the grace period, if one
+// is configured). Long-running handlers should watch ctx and return early; a
+// message whose handler is interrupted this way is nacked with requeue.
+func (ac *AmqpxConsumer) AddFuncCtx(queue, consumer string, fn func(ctx context.Context, body []byte) error, opts ...EntryOption) (string, error) {
+	var h Handler
+	if fn != nil {
+		h = func(ctx context.Context, d amqp.Delivery) error {
+			return fn(ctx, d.Body)
+		}
+	}
+	return ac.addEntry(consumer, &entry{Queue: queue, Handler: h}, opts)
+}
+
+// AddDeliveryFunc adds a queue consumption configuration whose handler receives
+// the full amqp.Delivery, giving access to headers, routing key, redelivered flag
+// and the other message properties. The delivery is still acked or rejected by the
+// consumer loop according to the returned error.
+func (ac *AmqpxConsumer) AddDeliveryFunc(queue, consumer string, fn func(amqp.Delivery) error, opts ...EntryOption) (string, error) {
+	var h Handler
+	if fn != nil {
+		h = func(_ context.Context, d amqp.Delivery) error {
+			return fn(d)
+		}
+	}
+	return ac.addEntry(consumer, &entry{Queue: queue, Handler: h}, opts)
+}
+
+// addEntry validates e and registers it under a unique consumer tag derived
+// from consumer, which it returns.
+func (ac *AmqpxConsumer) addEntry(consumer string, e *entry, opts []EntryOption) (string, error) {
+	if e.Queue == "" {
+		return "", ErrEmptyQueue
+	}
+	if e.Handler == nil && e.BatchHandler == nil {
+		return "", ErrNilHandler
+	}
+
 	ac.runningMu.Lock()
 	defer ac.runningMu.Unlock()
 
-	suffix := "-" + strconv.FormatUint(atomic.AddUint64(&consumerSeq, 1), 10)
+	return ac.addEntryLocked(consumer, e, opts)
+}
 
-	ac.entries[consumer+suffix] = &entry{
-		Queue:   queue,
-		Handler: fn,
+// addEntryLocked is addEntry once e is validated, with ac.runningMu held.
+func (ac *AmqpxConsumer) addEntryLocked(consumer string, e *entry, opts []EntryOption) (string, error) {
+	tagFunc := ac.tagFunc
+	if tagFunc == nil {
+		tagFunc = DefaultConsumerTag
+	}
+	tag := tagFunc(consumer, atomic.AddUint64(&consumerSeq, 1))
+	if _, ok := ac.entries[tag]; ok {
+		return "", fmt.Errorf("%w: %s", ErrDuplicateConsumer, tag)
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.invalid != nil {
+		return "", e.invalid
+	}
+	if err := e.checkStream(); err != nil {
+		return "", err
+	}
+	e.tag = tag
+	e.quit = make(chan struct{})
+	e.cancelled = make(chan struct{}, 1)
+	ac.entries[tag] = e
+	if ac.running.Load() {
+		// Like a cron scheduler, a running consumer starts new entries right away.
+		ac.startEntry(tag, e)
+	}
+	return tag, nil
+}
+
+// Remove cancels the consumer identified by consumerTag, waits for its
+// in-flight deliveries to be handled and removes it from the AmqpxConsumer, so
+// that it is not restarted by a later Start. It returns an error wrapping
+// ErrConsumerNotFound if no such consumer is registered.
+func (ac *AmqpxConsumer) Remove(consumerTag string) error {
+	ac.runningMu.Lock()
+	e, ok := ac.entries[consumerTag]
+	if !ok {
+		ac.runningMu.Unlock()
+		return fmt.Errorf("%w: %s", ErrConsumerNotFound, consumerTag)
+	}
+	delete(ac.entries, consumerTag)
+	if g, ok := ac.groups[e.group]; ok {
+		delete(g.tags, e.Queue)
+	}
+	running := ac.running.Load()
+	ac.runningMu.Unlock()
+
+	close(e.quit)
+	e.stopWaiting()
+	var err error
+	cli := ac.openedClient(e)
+	if running && cli != nil {
+		err = cli.Cancel(consumerTag)
+	}
+	if cli != nil {
+		cli.onCancel(consumerTag, nil)
+	}
+	e.wg.Wait()
+	if cli != nil {
+		cli.Close()
+	}
+	return err
+}
+
+// removed reports whether e has been removed from its AmqpxConsumer.
+func (e *entry) removed() bool {
+	select {
+	case <-e.quit:
+		return true
+	default:
+		return false
 	}
-	return
 }
 
 // Start starts the AmqpxConsumer and begins asynchronous consumption of configured queues.
-func (ac *AmqpxConsumer) Start() {
+// It fails if no queue is configured, if the channel is closed and cannot be
+// re-established, or if the consumer has already been stopped. Starting a
+// running consumer is a no-op.
+func (ac *AmqpxConsumer) Start() error {
 	ac.runningMu.Lock()
 	defer ac.runningMu.Unlock()
 
-	if ac.running {
-		return
+	if ac.running.Load() {
+		return nil
+	}
+	select {
+	case <-ac.stopped:
+		return ErrConsumerStopped
+	default:
+	}
+	if len(ac.entries) == 0 {
+		return ErrNoEntries
+	}
+	if ac.cli.channel.IsClosed() {
+		if err := ac.cli.initChannel(); err != nil {
+			return fmt.Errorf("amqpd channel err: %w", err)
+		}
 	}
-	ac.running = true
+	ac.running.Store(true)
 
 	for k, v := range ac.entries {
-		ac.jobWaiter.Add(1)
+		ac.startEntry(k, v)
+	}
+	if ac.watchdogInterval > 0 {
+		go ac.watchdog()
+	}
+	return nil
+}
 
-		go func(c string, e *entry) {
-			defer ac.jobWaiter.Done()
-			ac.run(c, e)
-		}(k, v)
+// MustStart is like Start but panics if the consumer cannot be started.
+func (ac *AmqpxConsumer) MustStart() {
+	if err := ac.Start(); err != nil {
+		panic(err)
 	}
-	return
+}
+
+// Run starts the AmqpxConsumer and blocks until ctx is cancelled or Stop is
+// called, then waits for the graceful shutdown performed by Stop and returns
+// its errors.
+//
+// Example:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	if err := amqpdConsumer.Run(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+func (ac *AmqpxConsumer) Run(ctx context.Context) error {
+	if err := ac.Start(); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-ac.stopped:
+	}
+	return ac.StopContext(context.Background())
+}
+
+// startEntry launches the run goroutine of e. The caller must hold runningMu.
+func (ac *AmqpxConsumer) startEntry(csr string, e *entry) {
+	ac.jobWaiter.Add(1)
+	e.wg.Add(1)
+
+	go func() {
+		defer ac.jobWaiter.Done()
+		defer e.wg.Done()
+		ac.run(csr, e)
+	}()
 }
 
 // run starts an asynchronous consumer for a specified queue.
 func (ac *AmqpxConsumer) run(csr string, e *entry) {
-	for ac.running {
-		err := ac.consume(e.Queue, csr, e.Handler)
+	var retries retryState
+	for ac.running.Load() && !e.removed() {
+		if !ac.waitResumed(e) {
+			break
+		}
+		pauses := e.pauseCount()
+		e.stats.setStatus(StatusConnecting)
+		err := ac.consume(csr, e, &retries)
 		if err != nil {
-			log.Printf("amqpd-consumer: run error: %s\n", err)
-			time.Sleep(time.Second * 15)
+			ac.channelError(e, "consume", err, nil)
+			e.stats.recordError(err)
+			var ce *ConsumeError
+			if errors.As(err, &ce) && ce.Permanent() {
+				log.Printf("amqpd-consumer: giving up on consumer %s\n", csr)
+				e.stats.setStatus(StatusFailed)
+				return
+			}
+			if e.exclState.Load() != exclusiveStandby {
+				e.stats.setStatus(StatusRetrying)
+			}
+			if ac.sleep(e, ac.retryDelay(&retries)) && !ac.brokerCancelled(csr, e) {
+				return
+			}
 			continue
 		}
-		if !ac.running {
+		ac.unsubscribed(&retries)
+		if !ac.running.Load() || e.removed() {
 			break
 		}
-		time.Sleep(time.Second * 15)
+		if e.pauseCount() != pauses {
+			// The consumer was cancelled by Pause, not by a channel failure.
+			continue
+		}
+		// The deliveries channel was closed either by a broker-side cancellation
+		// or because the AMQP channel dropped; in the latter case subscribe again
+		// as soon as redial has re-established it.
+		e.stats.setStatus(StatusRetrying)
+		if ac.waitChannel(e) && !ac.brokerCancelled(csr, e) {
+			return
+		}
 	}
 	return
 }
 
-// consume connects to the specified queue and handles message consumption.
-func (ac *AmqpxConsumer) consume(queue, consumer string, handler func([]byte) error) error {
-	deliveries, err := ac.cli.Consume(queue, consumer)
+// waitChannel waits until the channel e consumes from is open. Like sleep, it
+// returns early if e is removed, the consumer stopped or the broker cancelled
+// the consumer of e, reporting true in the latter case.
+func (ac *AmqpxConsumer) waitChannel(e *entry) (cancelled bool) {
+	select {
+	case <-e.cancelled:
+		return true
+	default:
+	}
+	cli, err := ac.client(e)
 	if err != nil {
-		return fmt.Errorf("amqpd consume err: %s", err)
+		return ac.sleep(e, ac.backoff.NextDelay(1))
+	}
+	select {
+	case <-cli.channelReady():
+	case <-e.quit:
+	case <-ac.stopped:
+	case <-e.cancelled:
+		return true
+	}
+	return false
+}
+
+// sleep pauses for d, returning early if e is removed or the consumer stopped.
+// It also returns early, reporting true, if the broker cancelled the consumer
+// of e, so that it can subscribe again without delay.
+func (ac *AmqpxConsumer) sleep(e *entry, d time.Duration) (cancelled bool) {
+	select {
+	case <-ac.after(d):
+	case <-e.quit:
+	case <-ac.stopped:
+	case <-e.cancelled:
+		return true
 	}
-	for dely := range deliveries {
-		err := ac.runWithRecovery(handler, dely.Body)
+	return false
+}
+
+// client returns the Amqpx that e consumes from, opening its channel on first
+// use. Every entry consumes on a channel of its own, redialed independently, so
+// that a channel exception raised for one entry does not interrupt the others
+// nor publishing, and QoS applies to the entry only.
+func (ac *AmqpxConsumer) client(e *entry) (*Amqpx, error) {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	if e.cli == nil {
+		cli, err := New(ac.clientOpts...)
 		if err != nil {
-			dely.Reject(true)
-			continue
+			return nil, fmt.Errorf("amqpd open channel err: %s", err)
+		}
+		if ac.metrics != nil {
+			cli.SetMetrics(ac.metrics)
 		}
-		dely.Ack(false)
+		e.cli = cli
+	}
+	return e.cli, nil
+}
+
+// openedClient is like client but returns nil instead of opening the channel.
+func (ac *AmqpxConsumer) openedClient(e *entry) *Amqpx {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	return e.cli
+}
+
+// consume connects to the specified queue and handles message consumption.
+func (ac *AmqpxConsumer) consume(consumer string, e *entry, retries *retryState) error {
+	cli, err := ac.client(e)
+	if err != nil {
+		return err
+	}
+	workers := max(e.workers, 1)
+	if prefetch := max(e.prefetch, e.batchSize, e.ackEvery); prefetch > 0 || workers > 1 {
+		if err := cli.Qos(max(prefetch, workers)); err != nil {
+			return fmt.Errorf("amqpd qos err: %s", err)
+		}
+	}
+	if err := ac.declareTopology(cli, e); err != nil {
+		return fmt.Errorf("amqpd declare err: %s", err)
+	}
+	if err := ac.declareRetryTopology(cli, e); err != nil {
+		return fmt.Errorf("amqpd declare retry queues err: %s", err)
+	}
+	if e.declare == nil {
+		// Consuming from a missing queue would close the channel of the entry
+		// and have it redialed: check on a throwaway channel first.
+		if ok, err := cli.queueExists(e.Queue); err != nil {
+			return fmt.Errorf("amqpd check queue err: %s", err)
+		} else if !ok {
+			err := fmt.Errorf("%w: %s", ErrQueueNotFound, e.Queue)
+			ac.onSubscribe(e.Queue, consumer, err)
+			return err
+		}
+	}
+	deliveries, err := cli.ConsumeWithOptions(e.Queue, consumer, ConsumeOptions{
+		AutoAck:   e.autoAckMode(),
+		Exclusive: e.exclusive,
+		Args:      e.consumeArgs(),
+	})
+	if err != nil {
+		var ae *amqp.Error
+		if errors.As(err, &ae) {
+			if e.exclusive && ae.Code == amqp.AccessRefused {
+				e.setActive(false)
+			}
+			err = &ConsumeError{Queue: e.Queue, ConsumerTag: consumer, Code: ae.Code, Reason: ae.Reason}
+		} else {
+			err = fmt.Errorf("amqpd consume err: %s", err)
+		}
+		ac.onSubscribe(e.Queue, consumer, err)
+		return err
+	}
+	ac.onSubscribe(e.Queue, consumer, nil)
+	if !ac.running.Load() || e.removed() || e.isPaused() {
+		// Stop, Remove or Pause cancelled the consumers while this one was
+		// subscribing, possibly before the subscription reached the broker.
+		// Cancel it too, so that its deliveries channel is closed and drained.
+		if err := cli.Cancel(consumer); err != nil {
+			log.Printf("amqpd-consumer: cancel %s: %s\n", consumer, err)
+		}
+	}
+	if e.exclusive {
+		e.setActive(true)
+	}
+	cli.onCancel(consumer, func() {
+		select {
+		case e.cancelled <- struct{}{}:
+		default:
+		}
+	})
+	retries.subscribed = ac.now()
+	e.stats.setStatus(StatusRunning)
+	if e.single {
+		// The broker does not tell which consumer is the active one: the
+		// first delivery does.
+		e.setActive(false)
+	}
+	defer e.stats.setStatus(StatusConnecting)
+	if e.BatchHandler != nil {
+		ac.consumeBatch(e, deliveries)
+		return nil
+	}
+	if e.ackEvery > 0 && !e.autoAckMode() {
+		acks := newAckBatcher(cli.channel, e.ackEvery, e.ackDelay)
+		defer func() {
+			if err := acks.Flush(); err != nil {
+				ac.channelError(e, "ack", err, nil)
+			}
+		}()
+		tracked := make(chan amqp.Delivery)
+		go func(deliveries <-chan amqp.Delivery) {
+			defer close(tracked)
+			for dely := range deliveries {
+				acks.track(&dely)
+				tracked <- dely
+			}
+		}(deliveries)
+		deliveries = tracked
+	}
+	h := ac.handler(e)
+	// Waits for the rate limiter end with the subscription, not only with Stop,
+	// or they would hold up Remove, Pause and watchdog restarts until a token.
+	limitCtx := ac.ctx
+	if e.limiter != nil {
+		var cancel context.CancelFunc
+		limitCtx, cancel = context.WithCancel(ac.ctx)
+		defer cancel()
+		e.setUnwait(cancel)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dely := range deliveries {
+				stripReturnID(dely.Headers)
+				e.received()
+				ac.onMessage(e, dely)
+				if e.limiter != nil {
+					if err := e.limiter.Wait(limitCtx); err != nil {
+						if !e.autoAckMode() {
+							dely.Nack(false, true)
+						}
+						continue
+					}
+				}
+				if e.dedupe != nil && ac.duplicate(e, dely) {
+					continue
+				}
+				if e.manual {
+					ac.trackManual(&dely)
+				}
+				start := time.Now()
+				err := ac.invoke(e, h, dely)
+				if err != nil && e.dedupe != nil {
+					ac.forget(e, dely)
+				}
+				ac.settle(e, dely, err, time.Since(start))
+			}
+		}()
 	}
+	wg.Wait()
 	return nil
 }
 
-// runWithRecovery is a utility method for running a function 'f' with panic recovery.
-func (ac *AmqpxConsumer) runWithRecovery(f func([]byte) error, body []byte) error {
+// invoke runs h for dely, enforcing the handler timeout of e if one is set.
+func (ac *AmqpxConsumer) invoke(e *entry, h Handler, dely amqp.Delivery) error {
+	atomic.AddInt64(&ac.inflight, 1)
+	e.stats.inflight.Add(1)
 	defer func() {
-		if r := recover(); r != nil {
-			const size = 64 << 10
-			buf := make([]byte, size)
-			buf = buf[:runtime.Stack(buf, false)]
-			log.Printf("amqpd-consumer: panic running job: %v\n%s\n", r, buf)
-		}
+		atomic.AddInt64(&ac.inflight, -1)
+		e.stats.inflight.Add(-1)
 	}()
-	return f(body)
+
+	if e.timeout <= 0 {
+		return h(ac.ctx, dely)
+	}
+	ctx, cancel := context.WithTimeout(ac.ctx, e.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() (err error) {
+		defer func() { done <- err }()
+		// An abandoned handler must never crash the process, whatever recovery middleware is installed.
+		defer recoverPanic(&err)
+		return h(ctx, dely)
+	}()
+
+	timer := time.NewTimer(e.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		atomic.AddInt64(&ac.abandoned, 1)
+		go func() {
+			<-done
+			atomic.AddInt64(&ac.abandoned, -1)
+		}()
+		log.Printf("amqpd-consumer: handler for queue %s%s timed out after %s\n", e.Queue, messageSuffix(dely.MessageId), e.timeout)
+		return ErrHandlerTimeout
+	}
+}
+
+// AbandonedHandlers returns the number of handler goroutines that exceeded their
+// WithHandlerTimeout and are still running in the background.
+func (ac *AmqpxConsumer) AbandonedHandlers() int64 {
+	return atomic.LoadInt64(&ac.abandoned)
+}
+
+// settle acks or rejects dely according to the error returned by its handler,
+// which ran for elapsed.
+func (ac *AmqpxConsumer) settle(e *entry, dely amqp.Delivery, err error, elapsed time.Duration) {
+	e.stats.recordResult(err)
+	ac.observeHandler(e, err, elapsed)
+	if err != nil {
+		ac.handlerError(e, err, &dely)
+	}
+	if e.autoAckMode() {
+		return
+	}
+	if err == nil {
+		if !e.manual {
+			ac.ack(e, dely)
+			ac.onAck(e, dely, elapsed)
+		}
+		return
+	}
+	if m, ok := dely.Acknowledger.(*manualAcker); ok && m.settled.Load() {
+		// The handler settled the delivery itself before failing.
+		return
+	}
+	if ac.ctx.Err() != nil {
+		// The handler was interrupted by Stop, hand the message back to the broker.
+		dely.Nack(false, true)
+		ac.onReject(e, dely, err, true)
+		return
+	}
+	requeue := requeueOnError(err)
+	var pe *PanicError
+	switch {
+	case errors.As(err, &pe):
+		if e.quarantine {
+			ac.onReject(e, dely, err, ac.quarantine(e, dely, pe))
+			return
+		}
+		requeue = ac.panicRequeue
+	case e.requeuePolicy != nil:
+		requeue = e.requeuePolicy(dely, err)
+	}
+	if requeue && (e.maxRetries > 0 || len(e.retryDelays) > 0) {
+		requeue = ac.retry(e, dely, err)
+	} else {
+		ac.reject(e, dely, requeue)
+	}
+	ac.onReject(e, dely, err, requeue)
+}
+
+// ack acknowledges dely, reporting a failure to the ErrorHandler of e.
+func (ac *AmqpxConsumer) ack(e *entry, dely amqp.Delivery) {
+	if err := dely.Ack(false); err != nil {
+		ac.channelError(e, "ack", err, &dely)
+	}
+}
+
+// reject rejects dely, reporting a failure to the ErrorHandler of e.
+func (ac *AmqpxConsumer) reject(e *entry, dely amqp.Delivery, requeue bool) {
+	if err := dely.Reject(requeue); err != nil {
+		ac.channelError(e, "reject", err, &dely)
+	}
+}
+
+// recoverPanic must be deferred directly; it turns a panic into a *PanicError stored in err.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		const size = 64 << 10
+		buf := make([]byte, size)
+		buf = buf[:runtime.Stack(buf, false)]
+		*err = &PanicError{Value: r, Stack: buf}
+	}
 }
 
 // Stop stops the AmqpxConsumer, which includes canceling all active consumers,
@@ -129,31 +883,112 @@ func (ac *AmqpxConsumer) runWithRecovery(f func([]byte) error, body []byte) erro
 // completed its shutdown process. Once the channel is closed, this AmqpxConsumer
 // cannot be used for further operations.
 //
+// After the AMQP consumers are cancelled, the context handed to AddFuncCtx
+// handlers is cancelled, either immediately or once the grace period configured
+// with WithGracePeriod has elapsed.
+//
 // This method should be called when you want to gracefully shut down the AmqpxConsumer.
+// Use StopContext to bound the shutdown and get its errors.
 //
 // Example:
 //
 //	ctx := amqpdConsumer.Stop()
 //	<-ctx.Done() // Wait for the AmqpxConsumer to complete its shutdown.
 func (ac *AmqpxConsumer) Stop() context.Context {
+	ac.stopOnce.Do(func() {
+		force, cancelForce := context.WithCancel(context.Background())
+		done, cancel := context.WithCancel(context.Background())
+		ac.force, ac.stopDone = cancelForce, done
+
+		entries := ac.beginStop()
+		go func() {
+			ac.stopErr = ac.shutdown(force, entries)
+			cancelForce()
+			cancel() // Cancel the context once shutdown is complete
+		}()
+	})
+	return ac.stopDone
+}
+
+// StopContext performs the same graceful shutdown as Stop but blocks until it
+// is complete or ctx is done. In the latter case it stops waiting for the
+// running handlers and closes the AMQP channels anyway, so that unacknowledged
+// deliveries are returned to their queues.
+//
+// The returned error joins the failures to cancel the consumers or close the
+// channels and, if ctx expired, an ErrHandlersInFlight error reporting how many
+// handlers were still running. Stop and StopContext may be called several
+// times, concurrently: the shutdown happens once and every call returns its
+// outcome.
+func (ac *AmqpxConsumer) StopContext(ctx context.Context) error {
+	done := ac.Stop()
+	select {
+	case <-done.Done():
+	case <-ctx.Done():
+		ac.force()
+		<-done.Done()
+	}
+	return ac.stopErr
+}
+
+// beginStop marks the consumer as stopped and returns a snapshot of its entries.
+func (ac *AmqpxConsumer) beginStop() map[string]*entry {
 	ac.runningMu.Lock()
 	defer ac.runningMu.Unlock()
 
-	if ac.running {
-		ac.running = false
-	}
+	ac.running.Store(false)
+	close(ac.stopped)
 
-	// Create a new context and cancel function
-	ctx, cancel := context.WithCancel(context.Background())
+	entries := make(map[string]*entry, len(ac.entries))
+	for csr, e := range ac.entries {
+		entries[csr] = e
+	}
+	return entries
+}
 
-	// Start a goroutine to cancel all active consumers
-	go func() {
-		for csr := range ac.entries {
-			ac.cli.Cancel(csr)
+// shutdown cancels the consumers of entries, waits for their jobs to complete
+// until force is done, then closes the AMQP channels.
+func (ac *AmqpxConsumer) shutdown(force context.Context, entries map[string]*entry) error {
+	var errs []error
+	for csr, e := range entries {
+		if cli := ac.openedClient(e); cli != nil {
+			if err := cli.Cancel(csr); err != nil {
+				errs = append(errs, fmt.Errorf("cancel %s: %w", csr, err))
+			}
 		}
+	}
+	done := make(chan struct{})
+	go func() {
 		ac.jobWaiter.Wait() // Wait for consumer jobs to complete
-		ac.cli.Close()      // Close the AMQP channel
-		cancel()            // Cancel the context once shutdown is complete
+		close(done)
 	}()
-	return ctx
+	if ac.gracePeriod > 0 {
+		select {
+		case <-done:
+		case <-force.Done():
+		case <-time.After(ac.gracePeriod):
+		}
+	}
+	ac.cancel() // Interrupt handlers that are still running
+	select {
+	case <-done:
+		if !ac.waitOutstanding() {
+			log.Printf("amqpd-consumer: stop: manual acknowledgements still outstanding after %s\n", ac.manualAckTimeout)
+		}
+	case <-force.Done():
+		errs = append(errs, fmt.Errorf("%w: %d", ErrHandlersInFlight, atomic.LoadInt64(&ac.inflight)))
+	}
+	for csr, e := range entries {
+		if cli := ac.openedClient(e); cli != nil {
+			if err := cli.Close(); err != nil { // Close the channels of the entries
+				errs = append(errs, fmt.Errorf("close channel of %s: %w", csr, err))
+			}
+		}
+	}
+	// Wait for the messages republished by retries and quarantines, then close
+	// the AMQP channel.
+	if err := ac.cli.Drain(force); err != nil {
+		errs = append(errs, fmt.Errorf("close channel: %w", err))
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,593 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	h := Recover(func(context.Context, amqp.Delivery) error {
+		panic("bad payload")
+	})
+
+	err := h(context.Background(), amqp.Delivery{})
+
+	var pe *PanicError
+	require.True(t, errors.As(err, &pe))
+	require.Equal(t, "bad payload", pe.Value)
+	require.NotEmpty(t, pe.Stack)
+}
+
+func TestAmqpxConsumerPanicReject(t *testing.T) {
+	const queue = "test_panic_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("poison")))
+
+	var calls int32
+	ac, err := NewAmqpxConsumer(WithPanicRequeue(false))
+	require.NoError(t, err)
+	_, err = ac.AddFunc(queue, "test-panic-consumer", func([]byte) error {
+		atomic.AddInt32(&calls, 1)
+		panic("poison message")
+	})
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+
+	time.Sleep(time.Millisecond * 500)
+	<-ac.Stop().Done()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls), "panicking message must not be redelivered")
+
+	q, err := cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.Zero(t, q.Messages)
+}
+
+func TestAmqpxConsumerWorkers(t *testing.T) {
+	const (
+		queue   = "test_workers_queue"
+		total   = 20
+		workers = 10
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	for i := 0; i < total; i++ {
+		require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("job")))
+	}
+
+	var (
+		done     int32
+		inFlight int32
+		peak     int32
+	)
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddFunc(queue, "test-workers-consumer", func([]byte) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 100)
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&done, 1)
+		return nil
+	}, WithWorkers(workers))
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&done) == total
+	}, time.Second, time.Millisecond*10)
+	<-ac.Stop().Done()
+
+	require.Greater(t, atomic.LoadInt32(&peak), int32(1))
+}
+
+func TestInvokeHandlerTimeout(t *testing.T) {
+	ac := &AmqpxConsumer{ctx: context.Background()}
+	release := make(chan struct{})
+	e := &entry{
+		Queue:   "test_timeout_queue",
+		timeout: time.Millisecond * 50,
+		Handler: func(ctx context.Context, _ amqp.Delivery) error {
+			<-ctx.Done()
+			<-release
+			panic("late panic from abandoned handler")
+		},
+	}
+
+	err := ac.invoke(e, e.Handler, amqp.Delivery{})
+	require.ErrorIs(t, err, ErrHandlerTimeout)
+	require.Equal(t, int64(1), ac.AbandonedHandlers())
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return ac.AbandonedHandlers() == 0
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestAddFuncValidation(t *testing.T) {
+	ac := &AmqpxConsumer{entries: make(map[string]*entry)}
+	fn := func([]byte) error { return nil }
+
+	_, err := ac.AddFunc("", "c", fn)
+	require.ErrorIs(t, err, ErrEmptyQueue)
+
+	_, err = ac.AddFunc("q", "c", nil)
+	require.ErrorIs(t, err, ErrNilHandler)
+
+	tag, err := ac.AddFunc("q", "c", fn)
+	require.NoError(t, err)
+	require.Contains(t, ac.entries, tag)
+	require.Regexp(t, `^c-\d+$`, tag)
+}
+
+func TestRemove(t *testing.T) {
+	ac := &AmqpxConsumer{entries: make(map[string]*entry)}
+
+	err := ac.Remove("missing")
+	require.ErrorIs(t, err, ErrConsumerNotFound)
+
+	tag, err := ac.AddFunc("q", "c", func([]byte) error { return nil })
+	require.NoError(t, err)
+	require.NoError(t, ac.Remove(tag))
+	require.NotContains(t, ac.entries, tag)
+	require.ErrorIs(t, ac.Remove(tag), ErrConsumerNotFound)
+}
+
+func TestPauseResumeStatus(t *testing.T) {
+	ac := &AmqpxConsumer{entries: make(map[string]*entry)}
+	tag, err := ac.AddFunc("q", "c", func([]byte) error { return nil })
+	require.NoError(t, err)
+
+	status, err := ac.Status(tag)
+	require.NoError(t, err)
+	require.Equal(t, StatusIdle, status)
+
+	require.NoError(t, ac.Pause(tag))
+	status, _ = ac.Status(tag)
+	require.Equal(t, StatusPaused, status)
+
+	resumed := make(chan bool)
+	go func() { resumed <- ac.waitResumed(ac.entries[tag]) }()
+	require.NoError(t, ac.Resume(tag))
+	require.True(t, <-resumed)
+
+	status, _ = ac.Status(tag)
+	require.Equal(t, StatusIdle, status)
+
+	_, err = ac.Status("missing")
+	require.ErrorIs(t, err, ErrConsumerNotFound)
+	require.ErrorIs(t, ac.Pause("missing"), ErrConsumerNotFound)
+}
+
+func TestAmqpxConsumerAddAfterStart(t *testing.T) {
+	const queue = "test_add_after_start_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("late")))
+
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+
+	received := make(chan struct{}, 1)
+	_, err = ac.AddFunc(queue, "test-late-consumer", func([]byte) error {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	select {
+	case <-received:
+	case <-time.After(time.Second * 2):
+		t.Fatal("entry added after Start was not consumed")
+	}
+	<-ac.Stop().Done()
+}
+
+func TestExclusiveStandbyCallback(t *testing.T) {
+	var changes []bool
+	e := &entry{}
+	WithExclusive(func(active bool) { changes = append(changes, active) })(e)
+	require.True(t, e.exclusive)
+
+	e.setActive(false)
+	e.setActive(false)
+	require.Equal(t, StatusStandby, e.stats.status.Load())
+	e.setActive(true)
+	e.setActive(true)
+	e.setActive(false)
+
+	require.Equal(t, []bool{false, true, false}, changes)
+}
+
+func TestAmqpxConsumerBrokerCancel(t *testing.T) {
+	const queue = "test_broker_cancel_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	tag, err := ac.AddFunc(queue, "test-cancel-consumer", func([]byte) error { return nil },
+		WithCancelPolicy(CancelRedeclare))
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer func() { <-ac.Stop().Done() }()
+
+	require.Eventually(t, func() bool {
+		status, _ := ac.Status(tag)
+		return status == StatusRunning
+	}, time.Second*2, time.Millisecond*20)
+
+	_, err = cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		info := ac.Entries()[0]
+		return info.BrokerCancels == 1 && info.Status == StatusRunning
+	}, time.Second*2, time.Millisecond*20, "consumer must resubscribe without the retry delay")
+}
+
+func TestAmqpxConsumerQueueNotFound(t *testing.T) {
+	errs := make(chan error, 1)
+	ac, err := NewAmqpxConsumer(WithErrorHandler(func(_, _ string, err error, _ []byte) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+	require.NoError(t, err)
+	_, err = ac.AddFunc("test_missing_queue", "test-missing-consumer", func([]byte) error { return nil })
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer func() { <-ac.Stop().Done() }()
+
+	select {
+	case err := <-errs:
+		require.ErrorIs(t, err, ErrQueueNotFound)
+		require.Contains(t, err.Error(), "test_missing_queue")
+	case <-time.After(time.Second * 2):
+		t.Fatal("missing queue not reported")
+	}
+	require.False(t, ac.cli.channel.IsClosed(), "the shared channel must survive")
+}
+
+func TestAmqpxConsumerChannelPerEntry(t *testing.T) {
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	for _, q := range []string{"test_channel_a_queue", "test_channel_b_queue"} {
+		_, err = cli.QueueDeclare(q)
+		require.NoError(t, err)
+	}
+
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	a, err := ac.AddFunc("test_channel_a_queue", "test-channel-a", func([]byte) error { return nil })
+	require.NoError(t, err)
+	b, err := ac.AddFunc("test_channel_b_queue", "test-channel-b", func([]byte) error { return nil })
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer func() { <-ac.Stop().Done() }()
+
+	require.Eventually(t, func() bool {
+		sa, _ := ac.Status(a)
+		sb, _ := ac.Status(b)
+		return sa == StatusRunning && sb == StatusRunning
+	}, time.Second*2, time.Millisecond*20)
+
+	ca, cb := ac.openedClient(ac.entries[a]), ac.openedClient(ac.entries[b])
+	require.NotSame(t, ca, cb)
+	require.NotSame(t, ac.cli, ca)
+
+	// A channel exception on one entry leaves the other one and publishing alone.
+	require.NoError(t, ca.channel.Close())
+	require.False(t, cb.channel.IsClosed())
+	require.False(t, ac.cli.channel.IsClosed())
+}
+
+func TestAmqpxConsumerStartErrors(t *testing.T) {
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	require.ErrorIs(t, ac.Start(), ErrNoEntries)
+
+	_, err = ac.AddFunc("test_start_queue", "test-start-consumer", func([]byte) error { return nil })
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	require.NoError(t, ac.Start())
+	<-ac.Stop().Done()
+
+	require.ErrorIs(t, ac.Start(), ErrConsumerStopped)
+}
+
+func TestAmqpxConsumerRun(t *testing.T) {
+	const queue = "test_run_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("run")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddFunc(queue, "test-run-consumer", func([]byte) error {
+		cancel()
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, ac.Run(ctx))
+	require.ErrorIs(t, ac.Start(), ErrConsumerStopped)
+
+	q, err := cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.Zero(t, q.Messages)
+}
+
+func TestAmqpxConsumerStopContext(t *testing.T) {
+	const queue = "test_stop_context_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("stuck")))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddFunc(queue, "test-stop-context-consumer", func([]byte) error {
+		close(started)
+		<-release
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	err = ac.StopContext(ctx)
+	require.ErrorIs(t, err, ErrHandlersInFlight)
+	require.ErrorContains(t, err, ": 1")
+
+	// The unacknowledged delivery went back to the queue with the channel.
+	q, err := cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.Equal(t, 1, q.Messages)
+}
+
+func TestAddFuncCtxCancelledOnStop(t *testing.T) {
+	const queue = "test_func_ctx_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	_, err = cli.channel.QueuePurge(queue, false)
+	require.NoError(t, err)
+	require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("long")))
+
+	started, interrupted := make(chan struct{}), make(chan error, 1)
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddFuncCtx(queue, "test-func-ctx-consumer", func(ctx context.Context, _ []byte) error {
+		close(started)
+		<-ctx.Done()
+		interrupted <- ctx.Err()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	<-started
+
+	require.NoError(t, ac.StopContext(context.Background()))
+	require.ErrorIs(t, <-interrupted, context.Canceled)
+
+	// The interrupted delivery was nacked with requeue.
+	q, err := cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.Equal(t, 1, q.Messages)
+}
+
+func TestAddFuncCtxGracePeriod(t *testing.T) {
+	const (
+		queue = "test_func_ctx_grace_queue"
+		grace = time.Millisecond * 200
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	_, err = cli.channel.QueuePurge(queue, false)
+	require.NoError(t, err)
+	require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("stuck")))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	cancelled := make(chan time.Time, 1)
+	ac, err := NewAmqpxConsumer(WithGracePeriod(grace))
+	require.NoError(t, err)
+	_, err = ac.AddFuncCtx(queue, "test-func-ctx-grace-consumer", func(ctx context.Context, _ []byte) error {
+		close(started)
+		go func() {
+			<-ctx.Done()
+			cancelled <- time.Now()
+		}()
+		<-release // ignores ctx
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	<-started
+
+	stop := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), grace*3)
+	defer cancel()
+	err = ac.StopContext(ctx)
+	require.ErrorIs(t, err, ErrHandlersInFlight, "the handler is abandoned")
+	require.GreaterOrEqual(t, (<-cancelled).Sub(stop), grace, "cancelled once the grace period elapsed")
+
+	// The delivery of the abandoned handler went back to the queue.
+	q, err := cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.Equal(t, 1, q.Messages)
+}
+
+// TestAmqpxConsumerStopWhileSubscribing is meant to be run with -race: the run
+// loops read the running flag while Stop writes it, and a consumer subscribing
+// while Stop cancels the others must not keep the shutdown waiting.
+func TestAmqpxConsumerStopWhileSubscribing(t *testing.T) {
+	const queue = "test_stop_subscribing_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		ac, err := NewAmqpxConsumer()
+		require.NoError(t, err)
+		tags := make([]string, 0, 5)
+		for j := 0; j < 5; j++ {
+			tag, err := ac.AddFunc(queue, "test-stop-subscribing-consumer", func([]byte) error { return nil })
+			require.NoError(t, err)
+			tags = append(tags, tag)
+		}
+		require.NoError(t, ac.Start())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for _, tag := range tags {
+				_, _ = ac.Status(tag)
+			}
+			_ = ac.Entries()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		require.NoError(t, ac.StopContext(ctx))
+		cancel()
+		<-done
+	}
+}
+
+func TestAmqpxConsumerStopTwice(t *testing.T) {
+	const queue = "test_stop_twice_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddFunc(queue, "test-stop-twice-consumer", func([]byte) error { return nil })
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+
+	first := ac.Stop()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			require.Equal(t, first, ac.Stop())
+		}()
+		go func() {
+			defer wg.Done()
+			require.NoError(t, ac.StopContext(context.Background()))
+		}()
+	}
+	wg.Wait()
+	<-first.Done()
+	require.NoError(t, ac.cli.Close())
+}
+
+func TestAmqpxConsumerClientOptions(t *testing.T) {
+	const queue = "test_consumer_client_options"
+
+	cli, err := New(WithConfig(GlobalConfig))
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false))
+	require.NoError(t, err)
+	defer cli.QueueDelete(queue, false, false)
+
+	ac, err := NewAmqpxConsumer(WithClientOptions(WithConfig(GlobalConfig)))
+	require.NoError(t, err)
+	require.NotNil(t, ac.cli.conn)
+	require.NotSame(t, Connection, ac.cli.conn)
+
+	received := make(chan string, 1)
+	tag, err := ac.AddFunc(queue, "test-client-options", func(body []byte) error {
+		received <- string(body)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer func() { <-ac.Stop().Done() }()
+
+	require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("own connection")))
+	select {
+	case body := <-received:
+		require.Equal(t, "own connection", body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	e := ac.entries[tag]
+	entryCli := ac.openedClient(e)
+	require.NotNil(t, entryCli)
+	require.NotNil(t, entryCli.conn, "entries consume on connections of their own")
+	require.NotSame(t, Connection, entryCli.conn)
+}
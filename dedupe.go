@@ -0,0 +1,150 @@
+package amqpx
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DedupeStore remembers the keys of the deliveries already processed.
+type DedupeStore interface {
+	// Seen records key for ttl and reports whether it was already recorded.
+	Seen(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// DedupeForgetter is implemented by the DedupeStores able to forget a key. The
+// consumer forgets the key of a delivery whose handler failed, so that its
+// redelivery is processed again.
+type DedupeForgetter interface {
+	Forget(ctx context.Context, key string) error
+}
+
+// WithDeduplication skips the deliveries whose key, computed by keyFn, was
+// already seen by store in the last ttl: they are acked without calling the
+// handler. A nil keyFn uses the message id; deliveries with an empty key are
+// always processed. It does not apply to batch handlers.
+//
+// If the store fails, the delivery is processed anyway, unless
+// WithDedupeFailClosed is given too.
+func WithDeduplication(store DedupeStore, keyFn func(amqp.Delivery) string, ttl time.Duration) EntryOption {
+	return func(e *entry) {
+		if keyFn == nil {
+			keyFn = func(d amqp.Delivery) string { return d.MessageId }
+		}
+		e.dedupe = store
+		e.dedupeKey = keyFn
+		e.dedupeTTL = ttl
+	}
+}
+
+// WithDedupeFailClosed requeues the deliveries whose key cannot be checked
+// because the DedupeStore failed, instead of processing them.
+func WithDedupeFailClosed() EntryOption {
+	return func(e *entry) {
+		e.dedupeFailClosed = true
+	}
+}
+
+// duplicate reports whether dely must not be handled, either because it was
+// already processed, in which case it is acked, or because the DedupeStore of e
+// failed and e fails closed, in which case it is requeued.
+func (ac *AmqpxConsumer) duplicate(e *entry, dely amqp.Delivery) bool {
+	key := e.dedupeKey(dely)
+	if key == "" {
+		return false
+	}
+	seen, err := e.dedupe.Seen(ac.ctx, key, e.dedupeTTL)
+	if err != nil {
+		ac.channelError(e, "dedupe", err, &dely)
+		if !e.dedupeFailClosed {
+			return false
+		}
+		if !e.autoAckMode() {
+			if err := dely.Nack(false, true); err != nil {
+				ac.channelError(e, "reject", err, &dely)
+			}
+		}
+		return true
+	}
+	if seen && !e.autoAckMode() {
+		ac.ack(e, dely)
+	}
+	return seen
+}
+
+// forget removes the key of dely from the DedupeStore of e after its handler
+// failed, if the store supports it.
+func (ac *AmqpxConsumer) forget(e *entry, dely amqp.Delivery) {
+	f, ok := e.dedupe.(DedupeForgetter)
+	if !ok {
+		return
+	}
+	if key := e.dedupeKey(dely); key != "" {
+		if err := f.Forget(context.Background(), key); err != nil {
+			ac.channelError(e, "dedupe", err, &dely)
+		}
+	}
+}
+
+// MemoryDedupeStore is an in-memory DedupeStore holding up to a fixed number of
+// keys, evicting the least recently recorded ones first. It is only suitable
+// for a single consumer process.
+type MemoryDedupeStore struct {
+	mu       sync.Mutex
+	capacity int
+	keys     map[string]*list.Element
+	order    *list.List // of *dedupeKey, most recently recorded first
+	now      func() time.Time
+}
+
+type dedupeKey struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryDedupeStore creates a MemoryDedupeStore holding up to capacity keys.
+func NewMemoryDedupeStore(capacity int) *MemoryDedupeStore {
+	return &MemoryDedupeStore{
+		capacity: max(capacity, 1),
+		keys:     make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Seen implements DedupeStore.
+func (s *MemoryDedupeStore) Seen(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if el, ok := s.keys[key]; ok {
+		if k := el.Value.(*dedupeKey); now.Before(k.expires) {
+			return true, nil
+		}
+		s.order.Remove(el)
+		delete(s.keys, key)
+	}
+	for s.order.Len() >= s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(*dedupeKey).key)
+	}
+	s.keys[key] = s.order.PushFront(&dedupeKey{key: key, expires: now.Add(ttl)})
+	return false, nil
+}
+
+// Forget implements DedupeForgetter.
+func (s *MemoryDedupeStore) Forget(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.keys[key]; ok {
+		s.order.Remove(el)
+		delete(s.keys, key)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDedupeStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	s := NewMemoryDedupeStore(2)
+	s.now = func() time.Time { return now }
+
+	seen, err := s.Seen(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	require.False(t, seen)
+	seen, _ = s.Seen(ctx, "a", time.Minute)
+	require.True(t, seen)
+
+	// Expired keys are processed again.
+	now = now.Add(time.Minute)
+	seen, _ = s.Seen(ctx, "a", time.Minute)
+	require.False(t, seen)
+
+	// The least recently recorded key is evicted first.
+	s.Seen(ctx, "b", time.Minute)
+	s.Seen(ctx, "c", time.Minute)
+	seen, _ = s.Seen(ctx, "a", time.Minute)
+	require.False(t, seen)
+
+	require.NoError(t, s.Forget(ctx, "c"))
+	seen, _ = s.Seen(ctx, "c", time.Minute)
+	require.False(t, seen)
+}
+
+type failingDedupeStore struct{}
+
+func (failingDedupeStore) Seen(context.Context, string, time.Duration) (bool, error) {
+	return false, errors.New("store unavailable")
+}
+
+func TestDuplicate(t *testing.T) {
+	ac := &AmqpxConsumer{ctx: context.Background(), errorHandler: func(string, string, error, []byte) {}}
+	e := &entry{Queue: "orders"}
+	WithDeduplication(NewMemoryDedupeStore(10), nil, time.Minute)(e)
+	ch := &recordingAcknowledger{}
+
+	require.False(t, ac.duplicate(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1, MessageId: "m-1"}))
+	require.True(t, ac.duplicate(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 2, MessageId: "m-1"}))
+	require.False(t, ac.duplicate(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 3}), "deliveries without key are processed")
+	require.Equal(t, []string{"ack 2 false"}, ch.ops)
+
+	ac.forget(e, amqp.Delivery{MessageId: "m-1"})
+	require.False(t, ac.duplicate(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 4, MessageId: "m-1"}))
+
+	WithDeduplication(failingDedupeStore{}, nil, time.Minute)(e)
+	require.False(t, ac.duplicate(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 5, MessageId: "m-2"}), "fail open")
+	WithDedupeFailClosed()(e)
+	require.True(t, ac.duplicate(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 6, MessageId: "m-2"}))
+	require.Equal(t, []string{"ack 2 false", "nack 6 false true"}, ch.ops)
+}
@@ -0,0 +1,118 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ExchangeDelayed is the exchange type of the rabbitmq_delayed_message_exchange
+// plugin, which holds each message for the delay of its HeaderDelay header
+// before routing it.
+const ExchangeDelayed = "x-delayed-message"
+
+// HeaderDelay is the header holding the delay in milliseconds of a message
+// published to a delayed exchange.
+const HeaderDelay = "x-delay"
+
+// ExchangeDeclareDelayed declares a durable delayed exchange that routes
+// messages like an exchange of type kind once their delay has elapsed. Like
+// ExchangeDeclare, it can be called again, e.g. after a reconnect. It returns
+// ErrDelayedExchangeUnsupported if the plugin is not enabled on the broker,
+// which then closes the connection; it is re-established by redial.
+func (ad *Amqpx) ExchangeDeclareDelayed(name, kind string) error {
+	spec := ExchangeSpec{Name: name, Kind: ExchangeDelayed, Durable: true, Args: amqp.Table{"x-delayed-type": kind}, CustomKind: true}
+	err := ad.declareExchange(spec)
+	var ae *amqp.Error
+	if errors.As(err, &ae) && ae.Code == amqp.CommandInvalid {
+		return fmt.Errorf("%w: %s", ErrDelayedExchangeUnsupported, ae.Reason)
+	}
+	return err
+}
+
+// WithDelay sets the delay of a message published to a delayed exchange,
+// rounded down to the millisecond. Other exchanges ignore it.
+func WithDelay(d time.Duration) PublishOption {
+	return WithHeaders(amqp.Table{HeaderDelay: d.Milliseconds()})
+}
+
+// PublishWithDelay publishes a message to targetQueue once delay has elapsed,
+// without requiring the delayed message exchange plugin. The message goes to a
+// wait queue, "amqpx.delay.<delay>.<targetQueue>", whose messages expire after
+// delay and are then dead-lettered to targetQueue. The wait queue is declared
+// on first use. With SetDelayBuckets, delay is rounded up to a bucket to bound
+// the number of wait queues. The message must not set its own expiration.
+func (ad *Amqpx) PublishWithDelay(ctx context.Context, targetQueue string, body []byte, delay time.Duration, opts ...PublishOption) error {
+	if targetQueue == "" {
+		return ErrEmptyQueue
+	}
+	if delay = ad.delayBucket(delay); delay <= 0 {
+		return ad.PublishWithContext(ctx, DefaultExchange, targetQueue, body, opts...)
+	}
+	name := delayQueueName(targetQueue, delay)
+	if err := ad.declareDelayQueue(name, targetQueue, delay); err != nil {
+		return fmt.Errorf("amqpd declare delay queue err: %s", err)
+	}
+	return ad.PublishWithContext(ctx, DefaultExchange, name, body, opts...)
+}
+
+// SetDelayBuckets makes PublishWithDelay round delays up to the nearest of
+// buckets, or down to the largest one, so that a wait queue is declared per
+// bucket rather than per distinct delay.
+func (ad *Amqpx) SetDelayBuckets(buckets ...time.Duration) {
+	sorted := slices.Clone(buckets)
+	slices.Sort(sorted)
+
+	ad.delayMu.Lock()
+	defer ad.delayMu.Unlock()
+
+	ad.delayBuckets = sorted
+}
+
+// delayBucket returns the delay of the bucket of d.
+func (ad *Amqpx) delayBucket(d time.Duration) time.Duration {
+	ad.delayMu.Lock()
+	defer ad.delayMu.Unlock()
+
+	if len(ad.delayBuckets) == 0 || d <= 0 {
+		return d
+	}
+	for _, b := range ad.delayBuckets {
+		if b >= d {
+			return b
+		}
+	}
+	return ad.delayBuckets[len(ad.delayBuckets)-1]
+}
+
+// delayQueueName returns the name of the wait queue delaying messages to queue by d.
+func delayQueueName(queue string, d time.Duration) string {
+	return "amqpx.delay." + durationName(d) + "." + queue
+}
+
+// declareDelayQueue declares the wait queue name unless it already did.
+func (ad *Amqpx) declareDelayQueue(name, queue string, d time.Duration) error {
+	ad.delayMu.Lock()
+	defer ad.delayMu.Unlock()
+
+	if _, ok := ad.delayQueues[name]; ok {
+		return nil
+	}
+	_, err := ad.channel.QueueDeclare(name, true, false, false, false, amqp.Table{
+		"x-message-ttl":             d.Milliseconds(),
+		"x-dead-letter-exchange":    DefaultExchange,
+		"x-dead-letter-routing-key": queue,
+	})
+	if err != nil {
+		return ad.refused(declareError("queue", name, err))
+	}
+	if ad.delayQueues == nil {
+		ad.delayQueues = make(map[string]struct{})
+	}
+	ad.delayQueues[name] = struct{}{}
+	return nil
+}
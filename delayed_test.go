@@ -0,0 +1,81 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelayBucket(t *testing.T) {
+	ad := &Amqpx{}
+	require.Equal(t, time.Second*7, ad.delayBucket(time.Second*7))
+
+	ad.SetDelayBuckets(time.Minute, time.Second*10, time.Second)
+	require.Equal(t, time.Second, ad.delayBucket(time.Millisecond*200))
+	require.Equal(t, time.Second*10, ad.delayBucket(time.Second*7))
+	require.Equal(t, time.Second*10, ad.delayBucket(time.Second*10))
+	require.Equal(t, time.Minute, ad.delayBucket(time.Hour))
+	require.Equal(t, time.Duration(0), ad.delayBucket(0))
+
+	require.Equal(t, "amqpx.delay.10s.orders", delayQueueName("orders", time.Second*10))
+	require.ErrorIs(t, ad.PublishWithDelay(context.Background(), "", nil, time.Second), ErrEmptyQueue)
+}
+
+func TestPublishWithDelay(t *testing.T) {
+	const queue = "test_publish_delay_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+	defer cli.channel.QueueDelete(delayQueueName(queue, time.Millisecond*300), false, false, false)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, cli.PublishWithDelay(context.Background(), queue, []byte("later"), time.Millisecond*300))
+	}
+	require.Len(t, cli.delayQueues, 1)
+	_, ok, err := cli.channel.Get(queue, true)
+	require.NoError(t, err)
+	require.False(t, ok, "the message is held for its delay")
+	require.Eventually(t, func() bool {
+		q, err := cli.channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+		return err == nil && q.Messages == 2
+	}, time.Second*2, time.Millisecond*50)
+}
+
+func TestExchangeDeclareDelayed(t *testing.T) {
+	const (
+		exchange = "test_delayed_exchange"
+		queue    = "test_delayed_queue"
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	err = cli.ExchangeDeclareDelayed(exchange, ExchangeDirect)
+	if errors.Is(err, ErrDelayedExchangeUnsupported) {
+		t.Skip("delayed message exchange plugin not enabled")
+	}
+	require.NoError(t, err)
+	defer cli.channel.ExchangeDelete(exchange, false, false)
+	require.NoError(t, cli.ExchangeDeclareDelayed(exchange, ExchangeDirect), "declaring again is harmless")
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, cli.QueueBind(queue, queue, exchange))
+
+	require.NoError(t, cli.PublishWithContext(context.Background(), exchange, queue, []byte("later"), WithDelay(time.Millisecond*300)))
+	_, ok, err := cli.channel.Get(queue, true)
+	require.NoError(t, err)
+	require.False(t, ok, "the message is held for its delay")
+	require.Eventually(t, func() bool {
+		_, ok, _ := cli.channel.Get(queue, true)
+		return ok
+	}, time.Second*2, time.Millisecond*50)
+}
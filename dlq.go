@@ -0,0 +1,95 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RepublishError is returned by RepublishDLQ when some messages could not be
+// republished. They are left in the dead-letter queue.
+type RepublishError struct {
+	Moved   int
+	Skipped int
+	Failed  int
+	Errs    []error // publish errors of the failed messages
+}
+
+func (e *RepublishError) Error() string {
+	return fmt.Sprintf("amqpd republish err: moved %d, skipped %d, failed %d: %s", e.Moved, e.Skipped, e.Failed, errors.Join(e.Errs...))
+}
+
+func (e *RepublishError) Unwrap() []error { return e.Errs }
+
+// RepublishDLQ moves the messages of the dead-letter queue dlq to the exchange
+// targetExchange with the routing key targetKey, for instance back to their
+// original queue once the handler that failed them is fixed, and returns how
+// many were moved. It stops once the queue is empty, ctx is done or max
+// messages were examined if max is positive.
+//
+// Each message is republished with confirms, which are enabled on ad if they
+// are not, and removed from dlq only once the broker confirmed its copy. If
+// transform is not nil, it returns the body and headers to republish each
+// message with, or false to skip the message. Skipped messages and those that
+// could not be republished are left in dlq; the latter are reported by a
+// *RepublishError.
+func (ad *Amqpx) RepublishDLQ(ctx context.Context, dlq, targetExchange, targetKey string, max int, transform func(amqp.Delivery) ([]byte, amqp.Table, bool)) (int, error) {
+	if !ad.confirms.Load() {
+		if err := ad.EnableConfirms(); err != nil {
+			return 0, err
+		}
+	}
+	ch, err := ad.openChannel()
+	if err != nil {
+		return 0, fmt.Errorf("amqpd open channel err: %w", err)
+	}
+	// Closing the channel puts back the messages skipped or not republished.
+	defer ch.Close()
+
+	var (
+		report  RepublishError
+		publish = ad.chain(ad.sendConfirm)
+	)
+	for max <= 0 || report.Moved+report.Skipped+report.Failed < max {
+		if ctx.Err() != nil {
+			break
+		}
+		d, ok, err := ch.Get(dlq, false)
+		if missing(err) {
+			return report.Moved, fmt.Errorf("%w: %s", ErrQueueNotFound, dlq)
+		}
+		if err != nil {
+			return report.Moved, fmt.Errorf("amqpd get err: %w", err)
+		}
+		if !ok {
+			break
+		}
+		msg := deliveryToPublishing(d)
+		if transform != nil {
+			var keep bool
+			msg.Body, msg.Headers, keep = transform(d)
+			if !keep {
+				report.Skipped++
+				continue
+			}
+		}
+		if err := publish(ctx, targetExchange, targetKey, &msg); err != nil {
+			report.Failed++
+			report.Errs = append(report.Errs, err)
+			continue
+		}
+		if err := d.Ack(false); err != nil {
+			// The copy was published: the original may be moved again.
+			return report.Moved, fmt.Errorf("amqpd ack err: %w", err)
+		}
+		report.Moved++
+	}
+	log.Printf("amqpd-republish: %s: moved %d, skipped %d, failed %d\n", dlq, report.Moved, report.Skipped, report.Failed)
+	if report.Failed > 0 {
+		return report.Moved, &report
+	}
+	return report.Moved, nil
+}
@@ -0,0 +1,71 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepublishError(t *testing.T) {
+	err := error(&RepublishError{Moved: 3, Skipped: 1, Failed: 1, Errs: []error{ErrPublishNacked}})
+	require.ErrorIs(t, err, ErrPublishNacked)
+	require.EqualError(t, err, "amqpd republish err: moved 3, skipped 1, failed 1: amqpx: publish nacked by the broker")
+	require.False(t, errors.Is(err, ErrUnroutable))
+}
+
+func TestRepublishDLQ(t *testing.T) {
+	const (
+		dlq    = "test_republish_dlq"
+		target = "test_republish_target"
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	for _, q := range []string{dlq, target} {
+		_, _ = cli.QueueDelete(q, false, false)
+		defer cli.QueueDelete(q, false, false)
+		_, err = cli.QueueDeclareWithOptions(q, WithQueueDurable(false))
+		require.NoError(t, err)
+	}
+	require.NoError(t, cli.EnableConfirms())
+	ctx := context.Background()
+	for _, body := range []string{"a", "skip", "b", "c"} {
+		require.NoError(t, cli.PublishConfirm(ctx, DefaultExchange, dlq, []byte(body), WithHeaders(amqp.Table{"x-origin": "dlq"})))
+	}
+
+	transform := func(d amqp.Delivery) ([]byte, amqp.Table, bool) {
+		d.Headers["x-fixed"] = true
+		return d.Body, d.Headers, string(d.Body) != "skip"
+	}
+	moved, err := cli.RepublishDLQ(ctx, dlq, DefaultExchange, target, 2, transform)
+	require.NoError(t, err)
+	require.Equal(t, 1, moved, "max counts the skipped message")
+	moved, err = cli.RepublishDLQ(ctx, dlq, DefaultExchange, target, 0, transform)
+	require.NoError(t, err)
+	require.Equal(t, 2, moved)
+
+	require.Eventually(t, func() bool {
+		info, err := cli.QueueInspect(dlq)
+		return err == nil && info.Messages == 1
+	}, time.Second*5, time.Millisecond*50, "the skipped message stays in the DLQ")
+	var bodies []string
+	for {
+		d, ok, err := cli.GetAndAck(target)
+		require.NoError(t, err)
+		if !ok {
+			break
+		}
+		require.Equal(t, true, d.Headers["x-fixed"])
+		require.Equal(t, "dlq", d.Headers["x-origin"])
+		bodies = append(bodies, string(d.Body))
+	}
+	require.Equal(t, []string{"a", "b", "c"}, bodies)
+
+	_, err = cli.RepublishDLQ(ctx, "test_republish_missing", DefaultExchange, target, 0, nil)
+	require.ErrorIs(t, err, ErrQueueNotFound)
+}
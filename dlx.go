@@ -0,0 +1,58 @@
+package amqpx
+
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DLXTopology describes the queues, exchange and binding declared by
+// DeclareQueueWithDLX.
+type DLXTopology struct {
+	Queue           QueueSpec    // work queue, dead-lettering to Exchange
+	Exchange        ExchangeSpec // direct dead-letter exchange
+	DeadLetterQueue QueueSpec
+	Binding         BindingSpec // of DeadLetterQueue to Exchange
+}
+
+// String summarizes t for logging.
+func (t DLXTopology) String() string {
+	return fmt.Sprintf("queue %s dead-letters to exchange %s, routed with key %q to queue %s",
+		t.Queue.Name, t.Exchange.Name, t.Binding.Key, t.DeadLetterQueue.Name)
+}
+
+// DeclareQueueWithDLX declares the queue, configured by opts, whose rejected
+// and expired messages are dead-lettered with the routing key dlqRoutingKey to
+// the durable direct exchange dlx, bound to the durable queue dlq. Declaring
+// the same set again is harmless, so it can be called at every startup. It
+// returns what it declared, which is only partially declared on error. With
+// EnableTopologyRecovery, the whole set is declared again after a reconnect.
+func (ad *Amqpx) DeclareQueueWithDLX(queue, dlx, dlq, dlqRoutingKey string, opts ...QueueOption) (DLXTopology, error) {
+	t := DLXTopology{
+		Exchange:        ExchangeSpec{Name: dlx, Kind: ExchangeDirect, Durable: true},
+		DeadLetterQueue: QueueSpec{Name: dlq, Durable: true},
+		Binding:         BindingSpec{Queue: dlq, Exchange: dlx, Key: dlqRoutingKey},
+		Queue:           QueueSpec{Name: queue, Durable: true},
+	}
+	for _, opt := range opts {
+		opt(&t.Queue)
+	}
+	WithQueueArgs(amqp.Table{
+		"x-dead-letter-exchange":    dlx,
+		"x-dead-letter-routing-key": dlqRoutingKey,
+	})(&t.Queue)
+
+	if err := ad.declareExchange(t.Exchange); err != nil {
+		return t, fmt.Errorf("amqpd declare dead-letter exchange err: %w", err)
+	}
+	if _, err := ad.declareQueue(t.DeadLetterQueue); err != nil {
+		return t, fmt.Errorf("amqpd declare dead-letter queue err: %w", err)
+	}
+	if err := ad.bind(t.Binding); err != nil {
+		return t, fmt.Errorf("amqpd bind dead-letter queue err: %w", err)
+	}
+	if _, err := ad.declareQueue(t.Queue); err != nil {
+		return t, err
+	}
+	return t, nil
+}
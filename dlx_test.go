@@ -0,0 +1,44 @@
+package amqpx
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeclareQueueWithDLX(t *testing.T) {
+	const (
+		queue = "test_dlx_work"
+		dlx   = "test_dlx_exchange"
+		dlq   = "test_dlx_dead"
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	for _, q := range []string{queue, dlq} {
+		_, _ = cli.QueueDelete(q, false, false)
+		defer cli.QueueDelete(q, false, false)
+	}
+	defer cli.ExchangeDelete(dlx, false)
+
+	topo, err := cli.DeclareQueueWithDLX(queue, dlx, dlq, "dead", WithQueueArgs(amqp.Table{"x-message-ttl": int32(60000)}))
+	require.NoError(t, err)
+	require.Equal(t, `queue test_dlx_work dead-letters to exchange test_dlx_exchange, routed with key "dead" to queue test_dlx_dead`, topo.String())
+	require.Equal(t, dlx, topo.Queue.Args["x-dead-letter-exchange"])
+	require.Equal(t, int32(60000), topo.Queue.Args["x-message-ttl"])
+	_, err = cli.DeclareQueueWithDLX(queue, dlx, dlq, "dead", WithQueueArgs(amqp.Table{"x-message-ttl": int32(60000)}))
+	require.NoError(t, err, "declaring again")
+
+	require.NoError(t, cli.Publish("", queue, []byte("poison")))
+	require.Eventually(t, func() bool {
+		d, ok, err := cli.channel.Get(queue, false)
+		return err == nil && ok && d.Nack(false, false) == nil
+	}, time.Second*5, time.Millisecond*50)
+	require.Eventually(t, func() bool {
+		d, ok, err := cli.channel.Get(dlq, true)
+		return err == nil && ok && string(d.Body) == "poison"
+	}, time.Second*5, time.Millisecond*50)
+}
@@ -0,0 +1,88 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Drain shuts ad down gracefully: publishing fails with ErrDraining from then
+// on, and the channel is closed once the messages being published have been
+// written and, in confirm mode, confirmed, or when ctx is done. It then returns
+// ErrUnconfirmed wrapped with the number of messages left unconfirmed.
+func (ad *Amqpx) Drain(ctx context.Context) error {
+	ad.draining.Store(true)
+	waitErr := ad.publishing.wait(ctx)
+	closeErr := ad.Close()
+	if waitErr != nil {
+		return errors.Join(fmt.Errorf("%w: %d", ErrUnconfirmed, ad.publishing.count()), closeErr)
+	}
+	return closeErr
+}
+
+// tracked wraps p, the innermost PublishFunc, to refuse messages once ad is
+// draining and count those being published.
+func (ad *Amqpx) tracked(p PublishFunc) PublishFunc {
+	return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+		ad.publishing.add()
+		defer ad.publishing.done()
+		if ad.draining.Load() {
+			return ErrDraining
+		}
+		return p(ctx, exchange, key, msg)
+	}
+}
+
+// inFlight counts the messages being published or awaiting confirmation.
+type inFlight struct {
+	mu   sync.Mutex
+	n    int
+	zero chan struct{} // closed when n drops to 0, created by wait
+}
+
+func (f *inFlight) add() {
+	f.mu.Lock()
+	f.n++
+	f.mu.Unlock()
+}
+
+func (f *inFlight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.n--; f.n == 0 && f.zero != nil {
+		close(f.zero)
+		f.zero = nil
+	}
+}
+
+func (f *inFlight) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.n
+}
+
+// wait waits until n is 0 or ctx is done.
+func (f *inFlight) wait(ctx context.Context) error {
+	f.mu.Lock()
+	if f.n <= 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	if f.zero == nil {
+		f.zero = make(chan struct{})
+	}
+	zero := f.zero
+	f.mu.Unlock()
+
+	select {
+	case <-zero:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,68 @@
+package amqpx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainTracking(t *testing.T) {
+	ad := &Amqpx{}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	send := ad.chain(func(context.Context, string, string, *amqp.Publishing) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	done := make(chan error)
+	go func() { done <- send(context.Background(), "", "q", &amqp.Publishing{}) }()
+	<-started
+	require.Equal(t, 1, ad.publishing.count())
+
+	ad.draining.Store(true)
+	require.ErrorIs(t, send(context.Background(), "", "q", &amqp.Publishing{}), ErrDraining)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	require.ErrorIs(t, ad.publishing.wait(ctx), context.DeadlineExceeded)
+
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, ad.publishing.wait(context.Background()))
+	require.Zero(t, ad.publishing.count())
+}
+
+func TestAmqpxDrain(t *testing.T) {
+	const queue = "test_drain_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	_, err = cli.channel.QueuePurge(queue, false)
+	require.NoError(t, err)
+	require.NoError(t, cli.EnableConfirms())
+
+	for i := 0; i < 100; i++ {
+		_, err = cli.PublishAsync("", queue, []byte("body"))
+		require.NoError(t, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, cli.Drain(ctx))
+	require.ErrorIs(t, cli.Publish("", queue, []byte("body")), ErrDraining)
+
+	check, err := New()
+	require.NoError(t, err)
+	defer check.Close()
+	q, err := check.channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+	require.NoError(t, err)
+	require.Equal(t, 100, q.Messages)
+	_, err = check.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, err)
+}
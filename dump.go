@@ -0,0 +1,240 @@
+package amqpx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// dumpRecord is a message as written by DumpQueue, one JSON object per line.
+// The body is encoded in base64.
+type dumpRecord struct {
+	Exchange        string     `json:"exchange"`
+	RoutingKey      string     `json:"routing_key"`
+	Redelivered     bool       `json:"redelivered,omitempty"`
+	Headers         amqp.Table `json:"headers,omitempty"`
+	ContentType     string     `json:"content_type,omitempty"`
+	ContentEncoding string     `json:"content_encoding,omitempty"`
+	DeliveryMode    uint8      `json:"delivery_mode,omitempty"`
+	Priority        uint8      `json:"priority,omitempty"`
+	CorrelationID   string     `json:"correlation_id,omitempty"`
+	ReplyTo         string     `json:"reply_to,omitempty"`
+	Expiration      string     `json:"expiration,omitempty"`
+	MessageID       string     `json:"message_id,omitempty"`
+	Timestamp       *time.Time `json:"timestamp,omitempty"`
+	Type            string     `json:"type,omitempty"`
+	UserID          string     `json:"user_id,omitempty"`
+	AppID           string     `json:"app_id,omitempty"`
+	Body            []byte     `json:"body"`
+}
+
+// DumpQueue writes the messages of queue to w as newline-delimited JSON, one
+// object per message holding its properties, headers and base64 encoded body,
+// and returns how many were written. It stops once the queue is empty, ctx is
+// done or max messages were written if max is positive.
+//
+// Messages are got with manual acknowledgement on a channel of their own. If
+// ack is set, each message is acked once its line is written to w, removing it
+// from the queue; w should then be durable, not a buffer that could be lost.
+// Otherwise the messages are all requeued when DumpQueue returns, so the queue
+// is left as it was, but for the redelivered flag.
+//
+// Each line is written with a single call to w. If it fails, the message is
+// requeued and the error returned; the part of the line w may have written is
+// reported by ReplayDump.
+func (ad *Amqpx) DumpQueue(ctx context.Context, queue string, w io.Writer, max int, ack bool) (int, error) {
+	ch, err := ad.openChannel()
+	if err != nil {
+		return 0, fmt.Errorf("amqpd open channel err: %w", err)
+	}
+	// Closing the channel requeues the message that could not be written.
+	defer ch.Close()
+
+	var (
+		n    int
+		last uint64 // tag of the last message got
+		line bytes.Buffer
+		enc  = json.NewEncoder(&line)
+	)
+	if !ack {
+		// Requeued all at once: requeued one at a time, they would be got again.
+		defer func() {
+			if last > 0 {
+				ch.Nack(last, true, true)
+			}
+		}()
+	}
+	for max <= 0 || n < max {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		d, ok, err := ch.Get(queue, false)
+		if missing(err) {
+			return n, fmt.Errorf("%w: %s", ErrQueueNotFound, queue)
+		}
+		if err != nil {
+			return n, fmt.Errorf("amqpd get err: %w", err)
+		}
+		if !ok {
+			break
+		}
+		last = d.DeliveryTag
+
+		line.Reset()
+		if err := enc.Encode(newDumpRecord(d)); err != nil {
+			return n, fmt.Errorf("amqpd dump err: %w", err)
+		}
+		if written, err := w.Write(line.Bytes()); err != nil || written < line.Len() {
+			if err == nil {
+				err = io.ErrShortWrite
+			}
+			return n, fmt.Errorf("amqpd dump err: %w", err)
+		}
+		if ack {
+			if err := d.Ack(false); err != nil {
+				return n, fmt.Errorf("amqpd ack err: %w", err)
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+// newDumpRecord returns the record of d.
+func newDumpRecord(d amqp.Delivery) dumpRecord {
+	rec := dumpRecord{
+		Exchange:        d.Exchange,
+		RoutingKey:      d.RoutingKey,
+		Redelivered:     d.Redelivered,
+		Headers:         d.Headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationID:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageID:       d.MessageId,
+		Type:            d.Type,
+		UserID:          d.UserId,
+		AppID:           d.AppId,
+		Body:            d.Body,
+	}
+	if !d.Timestamp.IsZero() {
+		rec.Timestamp = &d.Timestamp
+	}
+	return rec
+}
+
+// publishing returns the message to publish again for rec.
+func (rec dumpRecord) publishing() amqp.Publishing {
+	msg := amqp.Publishing{
+		Headers:         rec.Headers,
+		ContentType:     rec.ContentType,
+		ContentEncoding: rec.ContentEncoding,
+		DeliveryMode:    rec.DeliveryMode,
+		Priority:        rec.Priority,
+		CorrelationId:   rec.CorrelationID,
+		ReplyTo:         rec.ReplyTo,
+		Expiration:      rec.Expiration,
+		MessageId:       rec.MessageID,
+		Type:            rec.Type,
+		UserId:          rec.UserID,
+		AppId:           rec.AppID,
+		Body:            rec.Body,
+	}
+	if rec.Timestamp != nil {
+		msg.Timestamp = *rec.Timestamp
+	}
+	return msg
+}
+
+// ReplayDump publishes to exchange with the routing key key the messages
+// written to r by DumpQueue, with their properties and headers, and returns
+// how many were published. If key is empty, each message is published with
+// the routing key it was dumped with. Header values come back as JSON
+// decodes them: integers as int64, other numbers as float64, and timestamps
+// and byte arrays as strings.
+//
+// Messages are published with confirms if they are enabled on ad. ReplayDump
+// stops at the first line that cannot be decoded, with an error matching
+// ErrInvalidDump, or published.
+func (ad *Amqpx) ReplayDump(ctx context.Context, r io.Reader, exchange, key string) (int, error) {
+	publish := ad.publisher()
+	if ad.confirms.Load() {
+		publish = ad.chain(ad.sendConfirm)
+	}
+	// Lines are read whole, however large the bodies, unlike with a Scanner.
+	br := bufio.NewReader(r)
+	n := 0
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return n, fmt.Errorf("amqpd replay err: %w", err)
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			rec, derr := decodeDumpRecord(data)
+			if derr != nil {
+				return n, fmt.Errorf("%w: line %d: %s", ErrInvalidDump, line, derr)
+			}
+			routingKey := key
+			if routingKey == "" {
+				routingKey = rec.RoutingKey
+			}
+			msg := rec.publishing()
+			if perr := publish(ctx, exchange, routingKey, &msg); perr != nil {
+				return n, fmt.Errorf("amqpd replay err: line %d: %w", line, perr)
+			}
+			n++
+		}
+		if err != nil {
+			return n, nil
+		}
+	}
+}
+
+// decodeDumpRecord decodes a line written by DumpQueue.
+func decodeDumpRecord(data []byte) (dumpRecord, error) {
+	var rec dumpRecord
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rec); err != nil {
+		return rec, err
+	}
+	for k, v := range rec.Headers {
+		rec.Headers[k] = headerValue(v)
+	}
+	return rec, nil
+}
+
+// headerValue converts the JSON value v of a header into a value the AMQP
+// encoder accepts.
+func headerValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		t := amqp.Table(v)
+		for k, e := range t {
+			t[k] = headerValue(e)
+		}
+		return t
+	case []any:
+		for i := range v {
+			v[i] = headerValue(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,90 @@
+package amqpx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpRecord(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := amqp.Delivery{
+		RoutingKey:  "orders",
+		ContentType: "application/octet-stream",
+		MessageId:   "m1",
+		Timestamp:   ts,
+		Headers:     amqp.Table{"x-death-count": int64(3), "ratio": 0.5, "nested": amqp.Table{"n": int32(1)}},
+		Body:        bytes.Repeat([]byte{0, 0xff, '\n'}, 100000),
+	}
+	data, err := json.Marshal(newDumpRecord(d))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "\n", "one line per message")
+
+	rec, err := decodeDumpRecord(data)
+	require.NoError(t, err)
+	msg := rec.publishing()
+	require.Equal(t, d.Body, msg.Body)
+	require.Equal(t, "m1", msg.MessageId)
+	require.True(t, ts.Equal(msg.Timestamp))
+	require.Equal(t, amqp.Table{"x-death-count": int64(3), "ratio": 0.5, "nested": amqp.Table{"n": int64(1)}}, msg.Headers)
+	require.NoError(t, msg.Headers.Validate())
+
+	_, err = decodeDumpRecord(data[:len(data)/2])
+	require.Error(t, err, "a line cut short is refused")
+}
+
+func TestDumpQueue(t *testing.T) {
+	const queue = "test_dump_queue"
+
+	ad, err := New()
+	require.NoError(t, err)
+	defer ad.Close()
+	_, _ = ad.QueueDelete(queue, false, false)
+	defer ad.QueueDelete(queue, false, false)
+	_, err = ad.QueueDeclareWithOptions(queue, WithQueueDurable(false))
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, ad.PublishWithContext(ctx, DefaultExchange, queue, []byte("body "+id), WithMessageID(id), WithHeaders(amqp.Table{"n": int64(1)})))
+	}
+	require.Eventually(t, func() bool {
+		info, err := ad.QueueInspect(queue)
+		return err == nil && info.Messages == 3
+	}, 5*time.Second, 50*time.Millisecond)
+
+	var dump bytes.Buffer
+	n, err := ad.DumpQueue(ctx, queue, &dump, 2, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 2, strings.Count(dump.String(), "\n"))
+	info, err := ad.QueueInspect(queue)
+	require.NoError(t, err)
+	require.Equal(t, 3, info.Messages, "messages are requeued without ack")
+
+	dump.Reset()
+	n, err = ad.DumpQueue(ctx, queue, &dump, 0, true)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	info, err = ad.QueueInspect(queue)
+	require.NoError(t, err)
+	require.Zero(t, info.Messages, "messages are removed with ack")
+
+	n, err = ad.ReplayDump(ctx, &dump, DefaultExchange, "")
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	d, ok, err := ad.GetAndAck(queue)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "body a", string(d.Body))
+	require.Equal(t, "a", d.MessageId)
+	require.Equal(t, int64(1), d.Headers["n"])
+
+	_, err = ad.ReplayDump(ctx, strings.NewReader(`{"routing_key":"`), DefaultExchange, "")
+	require.ErrorIs(t, err, ErrInvalidDump)
+}
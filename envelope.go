@@ -0,0 +1,77 @@
+package amqpx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Envelope holds the properties identifying a message for auditing, set by
+// DefaultsInterceptor when publishing.
+type Envelope struct {
+	MessageID     string
+	Type          string
+	AppID         string
+	CorrelationID string
+	Timestamp     time.Time
+}
+
+// EnvelopeOf returns the envelope of d, for the handlers given the delivery.
+func EnvelopeOf(d amqp.Delivery) Envelope {
+	return Envelope{
+		MessageID:     d.MessageId,
+		Type:          d.Type,
+		AppID:         d.AppId,
+		CorrelationID: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+	}
+}
+
+// SetAppID sets the application id of the messages published through ad that
+// do not set one with WithAppID.
+func (ad *Amqpx) SetAppID(id string) {
+	ad.appID.Store(id)
+}
+
+// WithAppID sets the id of the application publishing the message, overriding
+// the one set with SetAppID.
+func WithAppID(id string) PublishOption {
+	return func(msg *Publishing) { msg.AppId = id }
+}
+
+// stamp sets the envelope properties of msg that are unset: a random UUID as
+// message id, the current time and the application id of ad.
+func (ad *Amqpx) stamp(msg *amqp.Publishing) {
+	if msg.MessageId == "" {
+		msg.MessageId = newUUID()
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	if msg.AppId == "" {
+		msg.AppId, _ = ad.appID.Load().(string)
+	}
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	// crypto/rand.Read does not fail on supported platforms.
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
@@ -0,0 +1,70 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	var seen []amqp.Publishing
+	ad := &Amqpx{}
+	ad.SetPublishInterceptors(ad.DefaultsInterceptor(), func(PublishFunc) PublishFunc {
+		return func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+			seen = append(seen, *msg)
+			return nil
+		}
+	})
+
+	before := time.Now()
+	require.NoError(t, ad.Publish("ex", "key", []byte("anonymous")))
+	ad.SetAppID("billing")
+	require.NoError(t, ad.Publish("ex", "key", []byte("stamped"), WithType("invoice.paid")))
+	at := time.Unix(1700000000, 0)
+	require.NoError(t, ad.Publish("ex", "key", []byte("override"),
+		WithMessageID("m-1"), WithTimestamp(at), WithAppID("import")))
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	require.Regexp(t, uuid, seen[0].MessageId)
+	require.Regexp(t, uuid, seen[1].MessageId)
+	require.NotEqual(t, seen[0].MessageId, seen[1].MessageId)
+	require.False(t, seen[0].Timestamp.Before(before))
+	require.Empty(t, seen[0].AppId)
+	require.Equal(t, "billing", seen[1].AppId)
+
+	env := EnvelopeOf(amqp.Delivery{
+		MessageId: seen[1].MessageId,
+		Type:      seen[1].Type,
+		AppId:     seen[1].AppId,
+		Timestamp: seen[1].Timestamp,
+	})
+	require.Equal(t, Envelope{MessageID: seen[1].MessageId, Type: "invoice.paid", AppID: "billing", Timestamp: seen[1].Timestamp}, env)
+
+	require.Equal(t, "m-1", seen[2].MessageId)
+	require.Equal(t, at, seen[2].Timestamp)
+	require.Equal(t, "import", seen[2].AppId)
+}
+
+func TestErrorMessageID(t *testing.T) {
+	var got error
+	ac := &AmqpxConsumer{errorHandler: func(_, _ string, err error, body []byte) {
+		got = err
+		require.Equal(t, []byte("body"), body)
+	}}
+	e := &entry{Queue: "orders", tag: "ctag"}
+	dely := amqp.Delivery{MessageId: "m-1", Body: []byte("body")}
+
+	ac.handlerError(e, errors.New("boom"), &dely)
+	var herr *HandlerError
+	require.ErrorAs(t, got, &herr)
+	require.Equal(t, "m-1", herr.MessageID)
+	require.EqualError(t, got, "handler error on queue orders (message m-1): boom")
+
+	ac.channelError(e, "ack", errors.New("channel closed"), &dely)
+	require.EqualError(t, got, "ack error on queue orders (message m-1): channel closed")
+}
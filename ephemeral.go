@@ -0,0 +1,113 @@
+package amqpx
+
+import (
+	"log"
+	"slices"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ephemeralQueues records the queues declared by DeclareEphemeralQueue.
+type ephemeralQueues struct {
+	mu       sync.Mutex
+	names    []string
+	onChange func(oldName string, q amqp.Queue)
+}
+
+// ephemeralRename is a queue of DeclareEphemeralQueue replaced after a
+// reconnect.
+type ephemeralRename struct {
+	oldName string
+	queue   amqp.Queue
+}
+
+// DeclareEphemeralQueue declares a transient, exclusive and auto-deleted queue
+// named by the broker, such as the reply queue of a request/reply client or the
+// queue of a temporary fanout subscriber, and returns it with its generated
+// name. The queue is deleted when the connection closes, or when its last
+// consumer is cancelled.
+//
+// If the queue is gone when redial re-establishes the channel, a new one is
+// declared under a new name, the old name is forgotten along with the bindings
+// recorded for it by EnableTopologyRecovery, and the function set with
+// OnEphemeralQueueChange is called so that the owner can bind and consume the
+// new queue, and tell its peers the new name.
+func (ad *Amqpx) DeclareEphemeralQueue() (amqp.Queue, error) {
+	q, err := ad.declareQueue(ephemeralSpec())
+	if err != nil {
+		return q, err
+	}
+	ad.ephemeral.mu.Lock()
+	ad.ephemeral.names = append(ad.ephemeral.names, q.Name)
+	ad.ephemeral.mu.Unlock()
+	return q, nil
+}
+
+// OnEphemeralQueueChange sets the function called with the old name and the
+// new queue when a queue of DeclareEphemeralQueue is declared again after a
+// reconnect. It is called once the channel is re-established.
+func (ad *Amqpx) OnEphemeralQueueChange(fn func(oldName string, q amqp.Queue)) {
+	ad.ephemeral.mu.Lock()
+	defer ad.ephemeral.mu.Unlock()
+
+	ad.ephemeral.onChange = fn
+}
+
+// ephemeralSpec returns the spec of the queues of DeclareEphemeralQueue.
+func ephemeralSpec() QueueSpec {
+	return QueueSpec{Exclusive: true, AutoDelete: true}
+}
+
+// redeclareEphemeralQueues declares again the queues of DeclareEphemeralQueue
+// that are gone, after the channel was re-established, and returns them.
+func (ad *Amqpx) redeclareEphemeralQueues() []ephemeralRename {
+	ad.ephemeral.mu.Lock()
+	names := slices.Clone(ad.ephemeral.names)
+	ad.ephemeral.mu.Unlock()
+
+	var renames []ephemeralRename
+	for _, name := range names {
+		// Exclusive queues belong to the connection, not to the channel: they
+		// survive the channel unless they lost their consumers.
+		if ok, err := ad.queueExists(name); ok || err != nil {
+			continue
+		}
+		q, err := declareQueueOn(ad.channel, ephemeralSpec())
+		if err != nil {
+			log.Printf("amqpd-redial: ephemeral queue %s: %s", name, err)
+			continue
+		}
+		ad.forget(queueKey(name))
+		ad.ephemeral.mu.Lock()
+		if i := slices.Index(ad.ephemeral.names, name); i >= 0 {
+			ad.ephemeral.names[i] = q.Name
+		}
+		ad.ephemeral.mu.Unlock()
+		renames = append(renames, ephemeralRename{oldName: name, queue: q})
+	}
+	return renames
+}
+
+// ephemeralQueuesChanged calls the function set with OnEphemeralQueueChange
+// for renames.
+func (ad *Amqpx) ephemeralQueuesChanged(renames []ephemeralRename) {
+	ad.ephemeral.mu.Lock()
+	fn := ad.ephemeral.onChange
+	ad.ephemeral.mu.Unlock()
+
+	if fn == nil {
+		return
+	}
+	for _, r := range renames {
+		fn(r.oldName, r.queue)
+	}
+}
+
+// forgetEphemeralQueue stops redeclaring the queue name, once deleted.
+func (ad *Amqpx) forgetEphemeralQueue(name string) {
+	ad.ephemeral.mu.Lock()
+	defer ad.ephemeral.mu.Unlock()
+
+	ad.ephemeral.names = slices.DeleteFunc(ad.ephemeral.names, func(n string) bool { return n == name })
+}
@@ -0,0 +1,63 @@
+package amqpx
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralQueueChange(t *testing.T) {
+	ad := &Amqpx{}
+	ad.ephemeral.names = []string{"amq.gen-a", "amq.gen-b"}
+	ad.forgetEphemeralQueue("amq.gen-a")
+	require.Equal(t, []string{"amq.gen-b"}, ad.ephemeral.names)
+
+	ad.ephemeralQueuesChanged([]ephemeralRename{{oldName: "amq.gen-b"}}) // no callback
+	var got []string
+	ad.OnEphemeralQueueChange(func(oldName string, q amqp.Queue) { got = append(got, oldName+" "+q.Name) })
+	ad.ephemeralQueuesChanged([]ephemeralRename{{oldName: "amq.gen-b", queue: amqp.Queue{Name: "amq.gen-c"}}})
+	require.Equal(t, []string{"amq.gen-b amq.gen-c"}, got)
+}
+
+func TestDeclareEphemeralQueue(t *testing.T) {
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	cli.EnableTopologyRecovery()
+	changes := make(chan [2]string, 1)
+	cli.OnEphemeralQueueChange(func(oldName string, q amqp.Queue) { changes <- [2]string{oldName, q.Name} })
+
+	q, err := cli.DeclareEphemeralQueue()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(q.Name, "amq.gen-"), q.Name)
+	require.NoError(t, cli.QueueBind(q.Name, q.Name, "amq.direct"))
+
+	// The queue survives the channel, and is kept.
+	require.NoError(t, cli.channel.Close())
+	select {
+	case <-cli.channelReady():
+	case <-time.After(time.Second * 5):
+		t.Fatal("channel not re-established")
+	}
+	require.Equal(t, []string{q.Name}, cli.ephemeral.names)
+
+	// Once gone, it is declared again under a new name.
+	_, err = cli.channel.QueueDelete(q.Name, false, false, false)
+	require.NoError(t, err)
+	require.NoError(t, cli.channel.Close())
+	var change [2]string
+	select {
+	case change = <-changes:
+	case <-time.After(time.Second * 5):
+		t.Fatal("ephemeral queue not declared again")
+	}
+	require.Equal(t, q.Name, change[0])
+	require.NotEqual(t, q.Name, change[1])
+	require.Equal(t, []string{change[1]}, cli.ephemeral.names)
+	for _, d := range cli.recovery.decls {
+		require.NotContains(t, d.refs, queueKey(q.Name), "the bindings of the old queue are forgotten")
+	}
+}
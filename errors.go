@@ -0,0 +1,407 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// ErrDropMessage marks a handler error as permanent: the delivery is rejected
+	// without requeue, so it is discarded or dead-lettered by the broker.
+	ErrDropMessage = errors.New("amqpx: drop message")
+
+	// ErrRequeueMessage marks a handler error as transient: the delivery is
+	// rejected and requeued. This is also the behavior for plain errors.
+	ErrRequeueMessage = errors.New("amqpx: requeue message")
+
+	// ErrHandlerTimeout is the error recorded for a delivery whose handler did not
+	// return within the WithHandlerTimeout duration. The delivery is requeued.
+	ErrHandlerTimeout = errors.New("amqpx: handler timed out")
+
+	// ErrNotInitialized is returned by the package-level publish functions
+	// before Init created the Default instance.
+	ErrNotInitialized = errors.New("amqpx: default instance is not initialized")
+
+	// ErrEmptyQueue is returned when registering a consumer without a queue name.
+	ErrEmptyQueue = errors.New("amqpx: queue name is empty")
+
+	// ErrNilHandler is returned when registering a consumer without a handler.
+	ErrNilHandler = errors.New("amqpx: handler is nil")
+
+	// ErrDuplicateConsumer is returned when a consumer tag is already registered.
+	ErrDuplicateConsumer = errors.New("amqpx: duplicate consumer tag")
+
+	// ErrConsumerNotFound is returned when a consumer tag is not registered.
+	ErrConsumerNotFound = errors.New("amqpx: consumer not found")
+
+	// ErrNoEntries is returned by Start when no consumer has been registered.
+	ErrNoEntries = errors.New("amqpx: no consumers registered")
+
+	// ErrConsumerStopped is returned by Start once Stop has been called: a
+	// stopped AmqpxConsumer cannot be restarted, create a new one instead.
+	ErrConsumerStopped = errors.New("amqpx: consumer stopped")
+
+	// ErrHandlersInFlight is returned by StopContext when its context expires
+	// before the running handlers return. It is wrapped with their number.
+	ErrHandlersInFlight = errors.New("amqpx: handlers still in flight")
+
+	// ErrQueueNotFound is reported through the error handler when a consumer
+	// subscribes to a queue that does not exist. It is wrapped with the queue
+	// name; subscribing is retried with backoff until the queue shows up.
+	ErrQueueNotFound = errors.New("amqpx: queue not found")
+
+	// ErrConfirmsDisabled is returned by PublishConfirm when EnableConfirms
+	// has not been called.
+	ErrConfirmsDisabled = errors.New("amqpx: publisher confirms not enabled")
+
+	// ErrPublishNacked is returned by PublishConfirm when the broker nacks the
+	// message, meaning it could not take responsibility for it.
+	ErrPublishNacked = errors.New("amqpx: publish nacked by the broker")
+
+	// ErrUnroutable is returned by PublishMandatory when the broker returns the
+	// message because no queue is bound to its routing key. It is wrapped with
+	// the reply code and text of the return.
+	ErrUnroutable = errors.New("amqpx: message unroutable")
+
+	// ErrBufferFull is returned by BufferedPublisher.Publish when the message
+	// does not fit in the buffer.
+	ErrBufferFull = errors.New("amqpx: publish buffer full")
+
+	// ErrPublisherClosed is returned by BufferedPublisher.Publish after Close.
+	ErrPublisherClosed = errors.New("amqpx: publisher closed")
+
+	// ErrTxDone is returned by the methods of an AmqpxTx once it has been
+	// committed or rolled back.
+	ErrTxDone = errors.New("amqpx: transaction already finished")
+
+	// ErrDelayedExchangeUnsupported is returned by ExchangeDeclareDelayed when
+	// the rabbitmq_delayed_message_exchange plugin is not enabled.
+	ErrDelayedExchangeUnsupported = errors.New("amqpx: delayed message exchange plugin missing")
+
+	// ErrConsistentHashUnsupported is returned by DeclareConsistentHashPartitions
+	// when the rabbitmq_consistent_hash_exchange plugin is not enabled.
+	ErrConsistentHashUnsupported = errors.New("amqpx: consistent hash exchange plugin missing")
+
+	// ErrCircuitOpen is returned by the publish methods while the circuit
+	// breaker set by WithCircuitBreaker is open.
+	ErrCircuitOpen = errors.New("amqpx: circuit breaker open")
+
+	// ErrDraining is returned by the publish methods once Drain has been called.
+	ErrDraining = errors.New("amqpx: draining")
+
+	// ErrUnconfirmed is returned by Drain when its context expires before every
+	// message is confirmed. It is wrapped with the number of such messages.
+	ErrUnconfirmed = errors.New("amqpx: messages left unconfirmed")
+
+	// ErrConnectionBlocked is returned by the publish methods while the broker
+	// blocks the connection because of a resource alarm, right away if their
+	// context cannot be done and once it is otherwise.
+	ErrConnectionBlocked = errors.New("amqpx: connection blocked")
+
+	// ErrChunkBufferFull is returned by the Reassembler middleware for chunks
+	// that do not fit in its buffer.
+	ErrChunkBufferFull = errors.New("amqpx: chunk buffer full")
+
+	// ErrChunkChecksum is returned by the Reassembler middleware when a
+	// reassembled payload does not match its checksum.
+	ErrChunkChecksum = errors.New("amqpx: chunk checksum mismatch")
+
+	// ErrMessageTooLarge is returned by the publish methods for messages larger
+	// than the limit set by SetMaxMessageSize.
+	ErrMessageTooLarge = errors.New("amqpx: message too large")
+
+	// ErrUnknownExchangeKind is returned when declaring an exchange of a type
+	// that is neither standard nor explicitly allowed as a plugin type.
+	ErrUnknownExchangeKind = errors.New("amqpx: unknown exchange kind")
+
+	// ErrIncompatibleQueueOption is returned when declaring a queue of a type
+	// that does not support one of the options given, such as an exclusive
+	// quorum queue, or with an invalid option value.
+	ErrIncompatibleQueueOption = errors.New("amqpx: option not supported by the queue type")
+
+	// ErrInvalidStreamOffset is returned when adding an entry with an offset
+	// WithStreamOffset does not accept, or without the prefetch count streams
+	// require.
+	ErrInvalidStreamOffset = errors.New("amqpx: invalid stream offset")
+
+	// ErrTopologyDrift is matched by the errors of CheckTopology for the
+	// elements missing on the broker or existing there with other settings.
+	ErrTopologyDrift = errors.New("amqpx: topology drift")
+
+	// ErrInvalidTopology is matched by the errors of LoadTopology, which
+	// report the line of each problem found in the file.
+	ErrInvalidTopology = errors.New("amqpx: invalid topology")
+
+	// ErrQueueFull is returned, together with ErrPublishNacked, for a message
+	// nacked by a queue full with the OverflowRejectPublish behavior.
+	ErrQueueFull = errors.New("amqpx: queue full")
+
+	// ErrDeclareMismatch is matched by the *DeclareError returned when the
+	// broker refuses a declaration because the entity exists with other flags
+	// or arguments.
+	ErrDeclareMismatch = errors.New("amqpx: declaration mismatch")
+
+	// ErrInvalidDump is returned by ReplayDump for a line that is not a message
+	// written by DumpQueue, such as the last line of a dump cut short. It is
+	// wrapped with the line number.
+	ErrInvalidDump = errors.New("amqpx: invalid dump")
+
+	// ErrInvalidRoutingKey is returned by ValidateRoutingKey and
+	// ValidateTopicPattern, and in strict routing mode by the publish and bind
+	// methods. It is wrapped with the key and the problem found.
+	ErrInvalidRoutingKey = errors.New("amqpx: invalid routing key")
+
+	// ErrInvalidOption is returned by New, or when adding an entry, with an
+	// option or argument given a value it does not accept, such as a zero
+	// batch size. It is wrapped with the option and its value.
+	ErrInvalidOption = errors.New("amqpx: invalid option")
+)
+
+// dispositionError wraps a handler error together with the requeue decision.
+type dispositionError struct {
+	err     error
+	requeue bool
+}
+
+func (e *dispositionError) Error() string { return e.err.Error() }
+
+func (e *dispositionError) Unwrap() error { return e.err }
+
+func (e *dispositionError) Is(target error) bool {
+	if e.requeue {
+		return target == ErrRequeueMessage
+	}
+	return target == ErrDropMessage
+}
+
+// Drop wraps err so that the consumer rejects the delivery without requeue.
+// Use it for messages that can never be processed successfully.
+//
+//	if err := json.Unmarshal(body, &v); err != nil {
+//		return amqpx.Drop(err)
+//	}
+func Drop(err error) error {
+	if err == nil {
+		err = ErrDropMessage
+	}
+	return &dispositionError{err: err, requeue: false}
+}
+
+// Requeue wraps err so that the consumer rejects the delivery with requeue,
+// even if err itself wraps ErrDropMessage.
+func Requeue(err error) error {
+	if err == nil {
+		err = ErrRequeueMessage
+	}
+	return &dispositionError{err: err, requeue: true}
+}
+
+// requeueOnError reports whether a delivery whose handler returned err should be
+// requeued. The outermost Drop/Requeue wrapper wins; otherwise errors wrapping
+// ErrDropMessage are dropped and everything else is requeued.
+func requeueOnError(err error) bool {
+	var de *dispositionError
+	if errors.As(err, &de) {
+		return de.requeue
+	}
+	return !errors.Is(err, ErrDropMessage)
+}
+
+// RequeuePolicy decides whether a delivery whose handler returned err is
+// requeued (true) or rejected without requeue (false).
+type RequeuePolicy func(d amqp.Delivery, err error) bool
+
+// WithRequeuePolicy replaces the default requeue decision for an entry, which
+// requeues every error except those wrapped with Drop. It is not consulted for
+// handler panics, which WithPanicRequeue and WithPanicQuarantine decide on.
+func WithRequeuePolicy(p RequeuePolicy) EntryOption {
+	return func(e *entry) {
+		e.requeuePolicy = p
+	}
+}
+
+// WithRequeueOncePolicy requeues a failed delivery the first time only: once
+// the broker reports it as redelivered, a further failure rejects it without
+// requeue so it is discarded or dead-lettered.
+func WithRequeueOncePolicy() EntryOption {
+	return WithRequeuePolicy(RequeueOnce)
+}
+
+// RequeueOnce is the RequeuePolicy used by WithRequeueOncePolicy. Errors wrapped
+// with Drop are never requeued.
+func RequeueOnce(d amqp.Delivery, err error) bool {
+	return requeueOnError(err) && !d.Redelivered
+}
+
+// ConsumeError is returned when the broker refuses a basic.consume with a
+// channel exception, for instance because of invalid consumer arguments.
+type ConsumeError struct {
+	Queue       string
+	ConsumerTag string
+	Code        int    // AMQP reply code, e.g. 406 for PRECONDITION_FAILED
+	Reason      string // reply text sent by the broker
+}
+
+func (e *ConsumeError) Error() string {
+	return fmt.Sprintf("amqpd consume err: queue %s, consumer %s: Exception (%d) Reason: %q",
+		e.Queue, e.ConsumerTag, e.Code, e.Reason)
+}
+
+// Permanent reports whether subscribing again with the same settings is bound
+// to fail the same way, so retrying is pointless.
+func (e *ConsumeError) Permanent() bool {
+	return e.Code == amqp.PreconditionFailed || e.Code == amqp.NotImplemented || e.Code == amqp.SyntaxError
+}
+
+// Is makes a 404 NOT_FOUND refusal match ErrQueueNotFound.
+func (e *ConsumeError) Is(target error) bool {
+	return target == ErrQueueNotFound && e.Code == amqp.NotFound
+}
+
+// DeclareError is returned when the broker refuses to declare an entity with a
+// PRECONDITION_FAILED exception, typically because it already exists with
+// other flags or arguments. It matches ErrDeclareMismatch. The exception closes
+// the channel, which the declare methods of Amqpx wait to be re-established
+// before returning the error, so that the next calls do not fail with a
+// closed channel.
+type DeclareError struct {
+	Kind   string // "queue" or "exchange"
+	Name   string
+	Arg    string // argument the broker found inequivalent, if it named one
+	Code   int    // AMQP reply code, 406
+	Reason string // reply text sent by the broker
+}
+
+func (e *DeclareError) Error() string {
+	if e.Arg != "" {
+		return fmt.Sprintf("amqpd declare err: %s %s exists with a different %s: %s", e.Kind, e.Name, e.Arg, e.Reason)
+	}
+	return fmt.Sprintf("amqpd declare err: %s %s: %s", e.Kind, e.Name, e.Reason)
+}
+
+func (e *DeclareError) Is(target error) bool { return target == ErrDeclareMismatch }
+
+// TopologyError lists the elements of a Topology that ApplyTopology could not
+// declare, or that CheckTopology found to differ from the broker.
+type TopologyError struct {
+	Errors []error
+}
+
+func (e *TopologyError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("amqpd topology err: %s", strings.Join(msgs, "; "))
+}
+
+func (e *TopologyError) Unwrap() []error { return e.Errors }
+
+// HandlerError reports a failure of a handler: the error it returned, a
+// recovered panic (wrapping a *PanicError) or ErrHandlerTimeout.
+type HandlerError struct {
+	Queue       string
+	ConsumerTag string
+	MessageID   string // message id of the delivery, if any
+	Err         error
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("handler error on queue %s%s: %s", e.Queue, messageSuffix(e.MessageID), e.Err)
+}
+
+func (e *HandlerError) Unwrap() error { return e.Err }
+
+// ChannelError reports an infrastructure failure of a consumer, that is of an
+// AMQP operation performed on its behalf rather than of its handler.
+type ChannelError struct {
+	Queue       string
+	ConsumerTag string
+	Op          string // failed operation: "consume", "ack", "reject", "retry"...
+	MessageID   string // message id of the delivery, if the failure is tied to one
+	Err         error
+}
+
+func (e *ChannelError) Error() string {
+	return fmt.Sprintf("%s error on queue %s%s: %s", e.Op, e.Queue, messageSuffix(e.MessageID), e.Err)
+}
+
+func (e *ChannelError) Unwrap() error { return e.Err }
+
+// messageSuffix identifies the message of an error, if known.
+func messageSuffix(messageID string) string {
+	if messageID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (message %s)", messageID)
+}
+
+// ErrorHandler is called with the failures of a consumer, wrapped in a
+// *HandlerError or a *ChannelError, which carry the message id of the delivery
+// being handled. body is the body of that delivery, nil if the failure is not
+// tied to a single delivery.
+type ErrorHandler func(consumerTag, queue string, err error, body []byte)
+
+// WithErrorHandler sets the ErrorHandler of every entry of the AmqpxConsumer
+// that does not have its own. The default is LogErrors.
+func WithErrorHandler(h ErrorHandler) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.errorHandler = h
+	}
+}
+
+// WithEntryErrorHandler sets the ErrorHandler of an entry, overriding the one
+// set with WithErrorHandler.
+func WithEntryErrorHandler(h ErrorHandler) EntryOption {
+	return func(e *entry) {
+		e.errorHandler = h
+	}
+}
+
+// LogErrors is the default ErrorHandler, it writes errors to the standard logger.
+func LogErrors(consumerTag, queue string, err error, body []byte) {
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		log.Printf("amqpd-consumer: panic running job: %v\n%s\n", pe.Value, pe.Stack)
+		return
+	}
+	log.Printf("amqpd-consumer: %s\n", err)
+}
+
+// handlerError reports a failure of the handler of e for dely, nil for a batch.
+func (ac *AmqpxConsumer) handlerError(e *entry, err error, dely *amqp.Delivery) {
+	herr := &HandlerError{Queue: e.Queue, ConsumerTag: e.tag, Err: err}
+	if dely != nil {
+		herr.MessageID = dely.MessageId
+	}
+	ac.reportError(e, herr, dely)
+}
+
+// channelError reports a failure of op performed for e, and for dely if the
+// failure is tied to a delivery.
+func (ac *AmqpxConsumer) channelError(e *entry, op string, err error, dely *amqp.Delivery) {
+	cerr := &ChannelError{Queue: e.Queue, ConsumerTag: e.tag, Op: op, Err: err}
+	if dely != nil {
+		cerr.MessageID = dely.MessageId
+	}
+	ac.reportError(e, cerr, dely)
+}
+
+func (ac *AmqpxConsumer) reportError(e *entry, err error, dely *amqp.Delivery) {
+	var body []byte
+	if dely != nil {
+		body = dely.Body
+	}
+	h := e.errorHandler
+	if h == nil {
+		h = ac.errorHandler
+	}
+	if h == nil {
+		h = LogErrors
+	}
+	h(e.tag, e.Queue, err, body)
+}
@@ -0,0 +1,113 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequeueOnError(t *testing.T) {
+	base := errors.New("downstream unavailable")
+
+	tests := []struct {
+		name    string
+		err     error
+		requeue bool
+	}{
+		{"plain", base, true},
+		{"drop", Drop(base), false},
+		{"drop nil", Drop(nil), false},
+		{"requeue", Requeue(base), true},
+		{"sentinel", ErrDropMessage, false},
+		{"wrapped sentinel", fmt.Errorf("decode: %w", ErrDropMessage), false},
+		{"wrapped drop", fmt.Errorf("handler: %w", Drop(base)), false},
+		{"requeue wraps drop", Requeue(Drop(base)), true},
+		{"drop wraps requeue", fmt.Errorf("outer: %w", Drop(Requeue(base))), false},
+		{"requeue wraps sentinel", Requeue(fmt.Errorf("x: %w", ErrDropMessage)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.requeue, requeueOnError(tt.err))
+		})
+	}
+
+	require.ErrorIs(t, Drop(base), base)
+	require.ErrorIs(t, Drop(base), ErrDropMessage)
+	require.ErrorIs(t, Requeue(base), ErrRequeueMessage)
+	require.Equal(t, base.Error(), Drop(base).Error())
+}
+
+func TestRequeueOnce(t *testing.T) {
+	err := errors.New("transient")
+
+	require.True(t, RequeueOnce(amqp.Delivery{}, err))
+	require.False(t, RequeueOnce(amqp.Delivery{Redelivered: true}, err))
+	require.False(t, RequeueOnce(amqp.Delivery{}, Drop(err)))
+}
+
+func TestRequeuePolicyIgnoresPanics(t *testing.T) {
+	ac := &AmqpxConsumer{ctx: context.Background(), errorHandler: func(string, string, error, []byte) {}}
+	WithPanicRequeue(false)(ac)
+	e := &entry{Queue: "q", tag: "q-1"}
+	WithRequeuePolicy(func(amqp.Delivery, error) bool { return true })(e)
+	ch := &recordingAcknowledger{}
+
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1}, errors.New("boom"), 0)
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 2}, &PanicError{Value: "nil map"}, 0)
+	require.Equal(t, []string{"reject 1 true", "reject 2 false"}, ch.ops, "WithPanicRequeue wins for panics")
+}
+
+func TestConsumeErrorQueueNotFound(t *testing.T) {
+	require.ErrorIs(t, &ConsumeError{Code: amqp.NotFound}, ErrQueueNotFound)
+	require.NotErrorIs(t, &ConsumeError{Code: amqp.AccessRefused}, ErrQueueNotFound)
+
+	err := &ChannelError{Op: "consume", Err: fmt.Errorf("%w: %s", ErrQueueNotFound, "missing")}
+	require.ErrorIs(t, err, ErrQueueNotFound)
+	require.Contains(t, err.Error(), "missing")
+}
+
+func TestConsumeErrorPermanent(t *testing.T) {
+	require.True(t, (&ConsumeError{Code: amqp.PreconditionFailed}).Permanent())
+	require.False(t, (&ConsumeError{Code: amqp.NotFound}).Permanent())
+	require.False(t, (&ConsumeError{Code: amqp.AccessRefused}).Permanent())
+}
+
+func TestErrorHandler(t *testing.T) {
+	type report struct {
+		tag, queue string
+		err        error
+		body       []byte
+	}
+	var global, local []report
+	ac := &AmqpxConsumer{ctx: context.Background()}
+	WithErrorHandler(func(tag, queue string, err error, body []byte) {
+		global = append(global, report{tag, queue, err, body})
+	})(ac)
+
+	ch := &recordingAcknowledger{}
+	e := &entry{Queue: "q", tag: "q-1"}
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1, Body: []byte("a")}, errors.New("boom"), 0)
+	require.Len(t, global, 1)
+	require.Equal(t, "q-1", global[0].tag)
+	require.Equal(t, "q", global[0].queue)
+	require.Equal(t, []byte("a"), global[0].body)
+	var he *HandlerError
+	require.ErrorAs(t, global[0].err, &he)
+	require.EqualError(t, he.Err, "boom")
+	require.Equal(t, []string{"reject 1 true"}, ch.ops)
+
+	WithEntryErrorHandler(func(tag, queue string, err error, body []byte) {
+		local = append(local, report{tag, queue, err, body})
+	})(e)
+	ac.channelError(e, "consume", errors.New("channel closed"), nil)
+	require.Len(t, global, 1)
+	require.Len(t, local, 1)
+	var ce *ChannelError
+	require.ErrorAs(t, local[0].err, &ce)
+	require.Equal(t, "consume", ce.Op)
+	require.False(t, errors.As(local[0].err, &he))
+}
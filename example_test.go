@@ -0,0 +1,66 @@
+package amqpx_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"amqpx"
+)
+
+// fakePublisher records the messages published through it.
+type fakePublisher struct {
+	published []string
+}
+
+func (p *fakePublisher) Publish(exchange, key string, body []byte, opts ...amqpx.PublishOption) error {
+	return p.PublishWithContext(context.Background(), exchange, key, body, opts...)
+}
+
+func (p *fakePublisher) PublishWithContext(_ context.Context, exchange, key string, body []byte, _ ...amqpx.PublishOption) error {
+	p.published = append(p.published, fmt.Sprintf("%s/%s: %s", exchange, key, body))
+	return nil
+}
+
+// OrderService depends on a Publisher rather than on *amqpx.Amqpx.
+type OrderService struct {
+	Events amqpx.Publisher
+}
+
+func (s *OrderService) Ship(ctx context.Context, orderID string) error {
+	return s.Events.PublishWithContext(ctx, "orders", "order.shipped", []byte(orderID))
+}
+
+func ExamplePublisher() {
+	events := &fakePublisher{}
+	svc := &OrderService{Events: events} // amqpx.Default in production
+	if err := svc.Ship(context.Background(), "42"); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(events.published)
+	// Output: [orders/order.shipped: 42]
+}
+
+// registerHandlers depends on a ConsumerRegistry rather than on
+// *amqpx.AmqpxConsumer, so that a fake can record the registrations.
+func registerHandlers(r amqpx.ConsumerRegistry) error {
+	_, err := r.AddFuncCtx("orders", "shipping", func(ctx context.Context, body []byte) error {
+		log.Printf("ship order %s", body)
+		return nil
+	})
+	return err
+}
+
+func ExampleConsumerRegistry() {
+	ac, err := amqpx.NewAmqpxConsumer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := registerHandlers(ac); err != nil {
+		log.Fatal(err)
+	}
+	if err := ac.Start(); err != nil {
+		log.Fatal(err)
+	}
+	defer ac.StopContext(context.Background())
+}
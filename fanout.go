@@ -0,0 +1,110 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FanoutReport tells which of the exchange and queues declared by
+// DeclareFanout already existed.
+type FanoutReport struct {
+	Exchange        string
+	ExchangeCreated bool
+	Created         []string // queues declared by DeclareFanout
+	Existing        []string // queues that already existed
+	Failed          []string // queues that could not be declared or bound
+}
+
+// String summarizes r for startup logs.
+func (r FanoutReport) String() string {
+	state := "existing"
+	if r.ExchangeCreated {
+		state = "created"
+	}
+	s := fmt.Sprintf("fanout exchange %s (%s): created [%s], existing [%s]",
+		r.Exchange, state, strings.Join(r.Created, " "), strings.Join(r.Existing, " "))
+	if len(r.Failed) > 0 {
+		s += fmt.Sprintf(", failed [%s]", strings.Join(r.Failed, " "))
+	}
+	return s
+}
+
+// DeclareFanout declares the durable fanout exchange and, configured by opts,
+// the queues bound to it, so that every queue gets a copy of each message
+// published to exchange, typically one queue per service. Declaring the same
+// set again is harmless, so it can be called at every startup, and with
+// EnableTopologyRecovery the set is declared again after a reconnect.
+//
+// A queue that cannot be declared or bound does not prevent the others from
+// being declared: the errors of all such queues are joined in the error
+// returned. The report tells which elements already existed and which were
+// created.
+func (ad *Amqpx) DeclareFanout(exchange string, queues []string, opts ...QueueOption) (FanoutReport, error) {
+	report := FanoutReport{Exchange: exchange}
+	// Elements are declared on a channel of their own, reopened after a
+	// refusal, so that a refused queue does not fail the next ones.
+	a := &applier{ad: ad}
+	defer a.close()
+
+	ch, err := a.channel()
+	if err != nil {
+		return report, fmt.Errorf("amqpd open channel err: %w", err)
+	}
+	err = ch.ExchangeDeclarePassive(exchange, ExchangeFanout, true, false, false, false, nil)
+	report.ExchangeCreated = missing(err)
+	if ch, err = a.channel(); err != nil {
+		return report, fmt.Errorf("amqpd open channel err: %w", err)
+	}
+	spec := ExchangeSpec{Name: exchange, Kind: ExchangeFanout, Durable: true}
+	if err := declareExchangeOn(ch, spec); err != nil {
+		return report, fmt.Errorf("amqpd declare fanout exchange err: %w", err)
+	}
+	ad.remember(exchangeDeclaration(spec))
+
+	var errs []error
+	for _, queue := range queues {
+		created, err := ad.declareFanoutQueue(a, exchange, queue, opts)
+		switch {
+		case err != nil:
+			report.Failed = append(report.Failed, queue)
+			errs = append(errs, fmt.Errorf("amqpd fanout queue %s err: %w", queue, err))
+		case created:
+			report.Created = append(report.Created, queue)
+		default:
+			report.Existing = append(report.Existing, queue)
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// declareFanoutQueue declares queue and binds it to the fanout exchange on the
+// channel of a. It reports whether the queue was created.
+func (ad *Amqpx) declareFanoutQueue(a *applier, exchange, queue string, opts []QueueOption) (bool, error) {
+	if queue == "" {
+		return false, ErrEmptyQueue
+	}
+	spec := QueueSpec{Name: queue, Durable: true}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	ch, err := a.channel()
+	if err != nil {
+		return false, err
+	}
+	_, err = ch.QueueDeclarePassive(queue, false, false, false, false, nil)
+	created := missing(err)
+	if err != nil && !created {
+		return false, err
+	}
+	if ch, err = a.channel(); err != nil {
+		return false, err
+	}
+	if _, err := ad.declareQueueWith(ch, spec); err != nil {
+		return false, err
+	}
+	if err := ad.bindWith(ch, BindingSpec{Queue: queue, Exchange: exchange}); err != nil {
+		return false, err
+	}
+	return created, nil
+}
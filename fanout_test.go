@@ -0,0 +1,55 @@
+package amqpx
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanoutReportString(t *testing.T) {
+	r := FanoutReport{Exchange: "events", Created: []string{"a", "b"}, Existing: []string{"c"}}
+	require.Equal(t, "fanout exchange events (existing): created [a b], existing [c]", r.String())
+	r.ExchangeCreated, r.Failed = true, []string{"d"}
+	require.Equal(t, "fanout exchange events (created): created [a b], existing [c], failed [d]", r.String())
+}
+
+func TestDeclareFanout(t *testing.T) {
+	const exchange = "test_fanout"
+	queues := []string{"test_fanout_billing", "test_fanout_audit"}
+
+	ad, err := New()
+	require.NoError(t, err)
+	defer ad.Close()
+	defer ad.ExchangeDelete(exchange, false)
+	for _, q := range append(queues, "test_fanout_conflict") {
+		_, _ = ad.QueueDelete(q, false, false)
+		defer ad.QueueDelete(q, false, false)
+	}
+	_ = ad.ExchangeDelete(exchange, false)
+
+	report, err := ad.DeclareFanout(exchange, queues, WithQueueDurable(false))
+	require.NoError(t, err)
+	require.True(t, report.ExchangeCreated)
+	require.Equal(t, queues, report.Created)
+
+	// The conflicting queue exists as durable: declaring it transient fails,
+	// without preventing the queue after it from being bound.
+	_, err = ad.QueueDeclareWithOptions("test_fanout_conflict")
+	require.NoError(t, err)
+	report, err = ad.DeclareFanout(exchange, []string{"test_fanout_conflict", queues[0]}, WithQueueDurable(false))
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "test_fanout_conflict"))
+	require.False(t, report.ExchangeCreated)
+	require.Equal(t, []string{"test_fanout_conflict"}, report.Failed)
+	require.Equal(t, queues[:1], report.Existing)
+
+	require.NoError(t, ad.Publish(exchange, "", []byte("broadcast")))
+	for _, q := range queues {
+		require.Eventually(t, func() bool {
+			info, err := ad.QueueInspect(q)
+			return err == nil && info.Messages == 1
+		}, 5*time.Second, 50*time.Millisecond, q)
+	}
+}
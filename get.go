@@ -0,0 +1,75 @@
+package amqpx
+
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Get retrieves a message from queue with basic.get, reporting false if the
+// queue is empty. It runs on a short-lived channel, so that a get on a missing
+// queue, reported as an error matching ErrQueueNotFound, does not close the
+// channel shared with consumers and publishers.
+//
+// Without autoAck, the delivery must be acked, nacked or rejected, which
+// closes its channel; until then the message is held unacknowledged and the
+// channel stays open. See GetAndAck and GetAndRequeue for the common cases.
+func (ad *Amqpx) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	ch, err := ad.openChannel()
+	if err != nil {
+		return amqp.Delivery{}, false, fmt.Errorf("amqpd open channel err: %w", err)
+	}
+	d, ok, err := ch.Get(queue, autoAck)
+	if err != nil || !ok || autoAck {
+		ch.Close()
+		if missing(err) {
+			err = fmt.Errorf("%w: %s", ErrQueueNotFound, queue)
+		}
+		return d, ok, err
+	}
+	d.Acknowledger = closingAcknowledger{ch}
+	return d, true, nil
+}
+
+// GetAndAck retrieves and removes a message from queue, reporting false if the
+// queue is empty. Unlike Get with autoAck, it returns an error if the broker
+// could not be told the message was handled.
+func (ad *Amqpx) GetAndAck(queue string) (amqp.Delivery, bool, error) {
+	d, ok, err := ad.Get(queue, false)
+	if err != nil || !ok {
+		return d, ok, err
+	}
+	return d, true, d.Ack(false)
+}
+
+// GetAndRequeue returns a copy of a message of queue and puts it back, to
+// peek at the queue; it is then redelivered with the Redelivered flag. It
+// reports false if the queue is empty.
+func (ad *Amqpx) GetAndRequeue(queue string) (amqp.Delivery, bool, error) {
+	d, ok, err := ad.Get(queue, false)
+	if err != nil || !ok {
+		return d, ok, err
+	}
+	return d, true, d.Nack(false, true)
+}
+
+// closingAcknowledger settles a delivery obtained by Get on its short-lived
+// channel, then closes it.
+type closingAcknowledger struct {
+	ch *amqp.Channel
+}
+
+func (a closingAcknowledger) Ack(tag uint64, multiple bool) error {
+	defer a.ch.Close()
+	return a.ch.Ack(tag, multiple)
+}
+
+func (a closingAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	defer a.ch.Close()
+	return a.ch.Nack(tag, multiple, requeue)
+}
+
+func (a closingAcknowledger) Reject(tag uint64, requeue bool) error {
+	defer a.ch.Close()
+	return a.ch.Reject(tag, requeue)
+}
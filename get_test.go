@@ -0,0 +1,51 @@
+package amqpx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	const queue = "test_get_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, _ = cli.QueueDelete(queue, false, false)
+	defer cli.QueueDelete(queue, false, false)
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false))
+	require.NoError(t, err)
+
+	_, ok, err := cli.Get(queue, true)
+	require.NoError(t, err)
+	require.False(t, ok, "empty queue")
+	_, _, err = cli.Get("test_get_missing", true)
+	require.ErrorIs(t, err, ErrQueueNotFound)
+	require.False(t, cli.channel.IsClosed(), "gets must not close the shared channel")
+
+	require.NoError(t, cli.EnableConfirms())
+	for _, body := range []string{"first", "second"} {
+		require.NoError(t, cli.PublishConfirm(context.Background(), DefaultExchange, queue, []byte(body)))
+	}
+
+	d, ok, err := cli.GetAndRequeue(queue)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "first", string(d.Body))
+	d, ok, err = cli.GetAndAck(queue)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "first", string(d.Body), "peeked message put back")
+	require.True(t, d.Redelivered)
+
+	d, ok, err = cli.Get(queue, false)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "second", string(d.Body))
+	require.NoError(t, d.Reject(false))
+	info, err := cli.QueueInspect(queue)
+	require.NoError(t, err)
+	require.Zero(t, info.Messages)
+}
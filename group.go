@@ -0,0 +1,163 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// consumerGroup is a set of entries sharing one handler, one per queue.
+type consumerGroup struct {
+	fn   func(queue string, body []byte) error
+	opts []EntryOption
+	tags map[string]string // queue name to consumer tag
+}
+
+// AddFuncMulti registers fn on every queue in queues under the group name
+// consumerPrefix, which it returns. One entry is created per queue, and the
+// handler receives the name of the queue each message was consumed from. The
+// group can be managed as a whole with PauseGroup, ResumeGroup and RemoveGroup,
+// grown or shrunk with AddQueueToGroup and RemoveQueueFromGroup, and its
+// entries carry the group name in Entries.
+//
+// If a queue cannot be added, the entries added for the previous ones are
+// removed along with the group, and the error is returned.
+func (ac *AmqpxConsumer) AddFuncMulti(queues []string, consumerPrefix string, fn func(queue string, body []byte) error, opts ...EntryOption) (string, error) {
+	if fn == nil {
+		return "", ErrNilHandler
+	}
+	ac.runningMu.Lock()
+	if _, ok := ac.groups[consumerPrefix]; ok {
+		ac.runningMu.Unlock()
+		return "", fmt.Errorf("%w: group %s", ErrDuplicateConsumer, consumerPrefix)
+	}
+	if ac.groups == nil {
+		ac.groups = make(map[string]*consumerGroup)
+	}
+	g := &consumerGroup{fn: fn, opts: opts, tags: make(map[string]string)}
+	ac.groups[consumerPrefix] = g
+
+	var added []string
+	for _, queue := range queues {
+		tag, err := ac.addToGroupLocked(g, consumerPrefix, queue)
+		if err != nil {
+			delete(ac.groups, consumerPrefix)
+			ac.runningMu.Unlock()
+			for _, tag := range added {
+				ac.Remove(tag)
+			}
+			return "", err
+		}
+		added = append(added, tag)
+	}
+	ac.runningMu.Unlock()
+	return consumerPrefix, nil
+}
+
+// AddQueueToGroup starts consuming queue with the handler of group and returns
+// the consumer tag of the new entry.
+func (ac *AmqpxConsumer) AddQueueToGroup(group, queue string) (string, error) {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	g, ok := ac.groups[group]
+	if !ok {
+		return "", fmt.Errorf("%w: group %s", ErrConsumerNotFound, group)
+	}
+	return ac.addToGroupLocked(g, group, queue)
+}
+
+// addToGroupLocked adds the entry of queue to the group g named group, with
+// ac.runningMu held so that two entries cannot be added for the same queue.
+func (ac *AmqpxConsumer) addToGroupLocked(g *consumerGroup, group, queue string) (string, error) {
+	if queue == "" {
+		return "", ErrEmptyQueue
+	}
+	if _, dup := g.tags[queue]; dup {
+		return "", fmt.Errorf("%w: queue %s in group %s", ErrDuplicateConsumer, queue, group)
+	}
+	e := &entry{
+		Queue: queue,
+		group: group,
+		Handler: func(_ context.Context, d amqp.Delivery) error {
+			return g.fn(queue, d.Body)
+		},
+	}
+	tag, err := ac.addEntryLocked(group, e, g.opts)
+	if err != nil {
+		return "", err
+	}
+	g.tags[queue] = tag
+	return tag, nil
+}
+
+// RemoveQueueFromGroup stops consuming queue for group, like Remove.
+func (ac *AmqpxConsumer) RemoveQueueFromGroup(group, queue string) error {
+	g, err := ac.group(group)
+	if err != nil {
+		return err
+	}
+	ac.runningMu.Lock()
+	tag, ok := g.tags[queue]
+	ac.runningMu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: queue %s in group %s", ErrConsumerNotFound, queue, group)
+	}
+	return ac.Remove(tag)
+}
+
+// PauseGroup pauses every entry of group.
+func (ac *AmqpxConsumer) PauseGroup(group string) error {
+	return ac.eachInGroup(group, ac.Pause)
+}
+
+// ResumeGroup resumes every entry of group.
+func (ac *AmqpxConsumer) ResumeGroup(group string) error {
+	return ac.eachInGroup(group, ac.Resume)
+}
+
+// RemoveGroup removes every entry of group and the group itself.
+func (ac *AmqpxConsumer) RemoveGroup(group string) error {
+	err := ac.eachInGroup(group, ac.Remove)
+
+	ac.runningMu.Lock()
+	delete(ac.groups, group)
+	ac.runningMu.Unlock()
+	return err
+}
+
+// group returns the group registered under name.
+func (ac *AmqpxConsumer) group(name string) (*consumerGroup, error) {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	g, ok := ac.groups[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: group %s", ErrConsumerNotFound, name)
+	}
+	return g, nil
+}
+
+// eachInGroup calls fn with the consumer tag of every entry of group and joins the errors.
+func (ac *AmqpxConsumer) eachInGroup(group string, fn func(consumerTag string) error) error {
+	g, err := ac.group(group)
+	if err != nil {
+		return err
+	}
+	ac.runningMu.Lock()
+	tags := make([]string, 0, len(g.tags))
+	for _, tag := range g.tags {
+		tags = append(tags, tag)
+	}
+	ac.runningMu.Unlock()
+
+	var errs []error
+	for _, tag := range tags {
+		if err := fn(tag); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,61 @@
+package amqpx
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddFuncMulti(t *testing.T) {
+	ac := &AmqpxConsumer{entries: make(map[string]*entry)}
+	var got []string
+	group, err := ac.AddFuncMulti([]string{"orders.eu", "orders.us"}, "orders", func(queue string, _ []byte) error {
+		got = append(got, queue)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "orders", group)
+	require.Len(t, ac.Entries(), 2)
+
+	for _, e := range ac.entries {
+		require.NoError(t, e.Handler(context.Background(), amqp.Delivery{}))
+	}
+	require.ElementsMatch(t, []string{"orders.eu", "orders.us"}, got)
+
+	_, err = ac.AddQueueToGroup("orders", "orders.ap")
+	require.NoError(t, err)
+	_, err = ac.AddQueueToGroup("orders", "orders.ap")
+	require.ErrorIs(t, err, ErrDuplicateConsumer)
+	require.NoError(t, ac.RemoveQueueFromGroup("orders", "orders.eu"))
+	require.Len(t, ac.Entries(), 2)
+
+	require.NoError(t, ac.PauseGroup("orders"))
+	for _, info := range ac.Entries() {
+		require.Equal(t, StatusPaused, info.Status)
+		require.Equal(t, "orders", info.Group)
+	}
+
+	require.NoError(t, ac.RemoveGroup("orders"))
+	require.Empty(t, ac.Entries())
+	require.ErrorIs(t, ac.PauseGroup("orders"), ErrConsumerNotFound)
+}
+
+func TestAddFuncMultiRollback(t *testing.T) {
+	ac := &AmqpxConsumer{entries: make(map[string]*entry)}
+	noop := func(string, []byte) error { return nil }
+
+	_, err := ac.AddFuncMulti([]string{"orders.eu", "orders.us", "orders.eu"}, "orders", noop)
+	require.ErrorIs(t, err, ErrDuplicateConsumer)
+	require.Empty(t, ac.Entries(), "the entries added are removed")
+	require.ErrorIs(t, ac.PauseGroup("orders"), ErrConsumerNotFound)
+
+	_, err = ac.AddFuncMulti([]string{"orders.eu", ""}, "orders", noop)
+	require.ErrorIs(t, err, ErrEmptyQueue)
+	require.Empty(t, ac.Entries())
+
+	_, err = ac.AddFuncMulti([]string{"orders.eu", "orders.us"}, "orders", noop)
+	require.NoError(t, err, "the group name is free again")
+	require.Len(t, ac.Entries(), 2)
+}
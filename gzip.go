@@ -0,0 +1,67 @@
+package amqpx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// EncodingGzip is the content encoding of messages compressed by WithGzip.
+const EncodingGzip = "gzip"
+
+// WithGzip compresses the body of the message with the default compression
+// level if it is larger than minSize bytes, and sets its content encoding to
+// EncodingGzip. Messages that already have a content encoding are left alone.
+// Consumers decompress such messages with the Gunzip middleware.
+func WithGzip(minSize int) PublishOption {
+	return WithGzipLevel(minSize, gzip.DefaultCompression)
+}
+
+// WithGzipLevel is like WithGzip with a compression level of the compress/gzip
+// package, from gzip.BestSpeed to gzip.BestCompression. Invalid levels fall
+// back to the default one.
+func WithGzipLevel(minSize, level int) PublishOption {
+	return func(msg *Publishing) {
+		if len(msg.Body) <= minSize || msg.ContentEncoding != "" {
+			return
+		}
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			w = gzip.NewWriter(&buf)
+		}
+		// Writing to a bytes.Buffer does not fail.
+		w.Write(msg.Body)
+		w.Close()
+		msg.Body = buf.Bytes()
+		msg.ContentEncoding = EncodingGzip
+	}
+}
+
+// Gunzip is a middleware decompressing the deliveries whose content encoding is
+// EncodingGzip before calling the handler, which sees the original body and an
+// empty content encoding. Deliveries that fail to decompress are rejected
+// without requeue, as retrying them cannot help. Register it with Use or
+// WithMiddleware.
+func Gunzip(next Handler) Handler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		if d.ContentEncoding != EncodingGzip {
+			return next(ctx, d)
+		}
+		r, err := gzip.NewReader(bytes.NewReader(d.Body))
+		if err != nil {
+			return Drop(fmt.Errorf("amqpx: gunzip: %w", err))
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return Drop(fmt.Errorf("amqpx: gunzip: %w", err))
+		}
+		d.Body = body
+		d.ContentEncoding = ""
+		return next(ctx, d)
+	}
+}
@@ -0,0 +1,39 @@
+package amqpx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzip(t *testing.T) {
+	ad := &Amqpx{}
+	large := bytes.Repeat([]byte(`{"key":"value"}`), 100)
+
+	small := ad.newPublishing([]byte("small"), []PublishOption{WithGzip(64)})
+	require.Equal(t, []byte("small"), small.Body)
+	require.Empty(t, small.ContentEncoding)
+
+	msg := ad.newPublishing(large, []PublishOption{WithGzipLevel(64, gzip.BestCompression)})
+	require.Equal(t, EncodingGzip, msg.ContentEncoding)
+	require.Less(t, len(msg.Body), len(large))
+
+	var got amqp.Delivery
+	h := Gunzip(func(_ context.Context, d amqp.Delivery) error {
+		got = d
+		return nil
+	})
+	require.NoError(t, h(context.Background(), amqp.Delivery{ContentEncoding: msg.ContentEncoding, Body: msg.Body}))
+	require.Equal(t, large, got.Body)
+	require.Empty(t, got.ContentEncoding)
+
+	require.NoError(t, h(context.Background(), amqp.Delivery{Body: []byte("plain")}))
+	require.Equal(t, []byte("plain"), got.Body)
+
+	err := h(context.Background(), amqp.Delivery{ContentEncoding: EncodingGzip, Body: []byte("corrupt")})
+	require.ErrorIs(t, err, ErrDropMessage)
+}
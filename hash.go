@@ -0,0 +1,80 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ExchangeConsistentHash is the exchange type of the
+// rabbitmq_consistent_hash_exchange plugin, which routes each message to one
+// of its bound queues by hashing the message, in proportion to the weights of
+// the bindings.
+const ExchangeConsistentHash = "x-consistent-hash"
+
+// HeaderHashKey is the header hashed by the exchanges declared by
+// DeclareConsistentHashPartitions, set by WithHashKey.
+const HeaderHashKey = "x-hash-key"
+
+// PartitionQueue returns the name of the queue of partition i declared by
+// DeclareConsistentHashPartitions.
+func PartitionQueue(queuePrefix string, i int) string {
+	return fmt.Sprintf("%s.%d", queuePrefix, i)
+}
+
+// DeclareConsistentHashPartitions declares the durable consistent-hash
+// exchange and the durable queues PartitionQueue(queuePrefix, 0) to
+// PartitionQueue(queuePrefix, partitions-1), bound to it with equal weights,
+// and returns the names of the queues. Messages published with the same
+// WithHashKey go to the same queue, so that each queue can be consumed by a
+// single consumer to process them in order.
+//
+// The exchange hashes the HeaderHashKey header rather than the routing key,
+// which is then free for other uses. Declaring the same set again is
+// harmless, and with EnableTopologyRecovery it is declared again after a
+// reconnect. ErrConsistentHashUnsupported is returned if the plugin is not
+// enabled on the broker, which then closes the connection; it is
+// re-established by redial.
+func (ad *Amqpx) DeclareConsistentHashPartitions(exchange string, partitions int, queuePrefix string) ([]string, error) {
+	if partitions <= 0 {
+		return nil, fmt.Errorf("amqpd declare partitions err: %d partitions", partitions)
+	}
+	spec := ExchangeSpec{
+		Name:       exchange,
+		Kind:       ExchangeConsistentHash,
+		Durable:    true,
+		Args:       amqp.Table{"hash-header": HeaderHashKey},
+		CustomKind: true,
+	}
+	err := ad.declareExchange(spec)
+	var ae *amqp.Error
+	if errors.As(err, &ae) && ae.Code == amqp.CommandInvalid {
+		return nil, fmt.Errorf("%w: %s", ErrConsistentHashUnsupported, ae.Reason)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]string, partitions)
+	for i := range queues {
+		queues[i] = PartitionQueue(queuePrefix, i)
+		if _, err := ad.declareQueue(QueueSpec{Name: queues[i], Durable: true}); err != nil {
+			return nil, err
+		}
+		// The routing key of a binding is its weight.
+		if err := ad.bind(BindingSpec{Queue: queues[i], Exchange: exchange, Key: "1"}); err != nil {
+			return nil, fmt.Errorf("amqpd bind partition %s err: %w", queues[i], err)
+		}
+	}
+	return queues, nil
+}
+
+// WithHashKey sets the key hashed by the exchanges declared by
+// DeclareConsistentHashPartitions to pick the queue of the message, in the
+// HeaderHashKey header. For a consistent-hash exchange declared without the
+// hash-header argument, the routing key is hashed instead: publish with the
+// key as routing key.
+func WithHashKey(key string) PublishOption {
+	return WithHeaders(amqp.Table{HeaderHashKey: key})
+}
@@ -0,0 +1,60 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithHashKey(t *testing.T) {
+	msg := &Publishing{}
+	WithHashKey("customer-42")(msg)
+	require.Equal(t, amqp.Table{HeaderHashKey: "customer-42"}, msg.Headers)
+	require.Equal(t, "work.3", PartitionQueue("work", 3))
+
+	_, err := (&Amqpx{}).DeclareConsistentHashPartitions("work", 0, "work")
+	require.Error(t, err)
+}
+
+func TestDeclareConsistentHashPartitions(t *testing.T) {
+	const exchange = "test_hash"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	queues, err := cli.DeclareConsistentHashPartitions(exchange, 3, "test_hash")
+	if errors.Is(err, ErrConsistentHashUnsupported) {
+		t.Skip("consistent hash exchange plugin not enabled")
+	}
+	require.NoError(t, err)
+	defer cli.ExchangeDelete(exchange, false)
+	for _, q := range queues {
+		defer cli.QueueDelete(q, false, false)
+		_, err := cli.QueuePurge(q)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"test_hash.0", "test_hash.1", "test_hash.2"}, queues)
+
+	_, err = cli.DeclareConsistentHashPartitions(exchange, 3, "test_hash")
+	require.NoError(t, err, "declaring again is harmless")
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, cli.Publish(exchange, fmt.Sprint(i), []byte("same key"), WithHashKey("customer-42")))
+	}
+	require.Eventually(t, func() bool {
+		var counts []int
+		for _, q := range queues {
+			info, err := cli.QueueInspect(q)
+			if err != nil {
+				return false
+			}
+			counts = append(counts, info.Messages)
+		}
+		return counts[0]+counts[1]+counts[2] == 10 && (counts[0] == 10 || counts[1] == 10 || counts[2] == 10)
+	}, 5*time.Second, 50*time.Millisecond, "messages with the same hash key go to the same partition")
+}
@@ -0,0 +1,112 @@
+package amqpx
+
+import (
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Hooks are optional callbacks invoked synchronously by the consume loops of
+// an AmqpxConsumer. They must return quickly since they hold up the delivery
+// they are called for; a panic in a hook is logged and otherwise ignored.
+type Hooks struct {
+	// OnMessage is called when a delivery is received, before its handler runs.
+	OnMessage func(d amqp.Delivery)
+	// OnAck is called when a delivery is settled for acking after its handler
+	// succeeded in dur. With WithAckEvery the ack may still be held back, and
+	// the delivery is redelivered if the channel closes before it is flushed.
+	OnAck func(d amqp.Delivery, dur time.Duration)
+	// OnReject is called when a delivery whose handler failed with err has been
+	// rejected, or republished for a retry, requeue telling whether it will be
+	// delivered again.
+	OnReject func(d amqp.Delivery, err error, requeue bool)
+	// OnSubscribe is called each time a consumer (re)subscribes to its queue.
+	OnSubscribe func(queue, tag string)
+	// OnSubscribeError is called when subscribing to a queue fails.
+	OnSubscribeError func(queue, tag string, err error)
+	// OnRestart is called when the watchdog restarts a stuck consumer, see
+	// WithWatchdog.
+	OnRestart func(queue, tag string)
+	// OnCancel is called when the broker cancels a consumer, for instance
+	// because its queue was deleted, see WithCancelPolicy.
+	OnCancel func(queue, tag string)
+}
+
+// WithHooks sets the Hooks of the AmqpxConsumer.
+func WithHooks(h Hooks) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.hooks = h
+	}
+}
+
+// recoverHook must be deferred directly; it keeps a panicking hook from taking
+// down the consume loop.
+func recoverHook(name string) {
+	if r := recover(); r != nil {
+		log.Printf("amqpd-consumer: panic in %s hook: %v\n", name, r)
+	}
+}
+
+// onMessage reports a delivery received by e to the MetricsCollector and the
+// OnMessage hook, and so on for the functions below, which also update the
+// counters of e.
+func (ac *AmqpxConsumer) onMessage(e *entry, d amqp.Delivery) {
+	if ac.metrics != nil {
+		ac.metrics.IncConsumed(e.Queue, e.tag)
+	}
+	if ac.hooks.OnMessage != nil {
+		defer recoverHook("OnMessage")
+		ac.hooks.OnMessage(d)
+	}
+}
+
+func (ac *AmqpxConsumer) onAck(e *entry, d amqp.Delivery, dur time.Duration) {
+	e.stats.acked.Add(1)
+	if ac.metrics != nil {
+		ac.metrics.IncAcked(e.Queue, e.tag)
+	}
+	if ac.hooks.OnAck != nil {
+		defer recoverHook("OnAck")
+		ac.hooks.OnAck(d, dur)
+	}
+}
+
+func (ac *AmqpxConsumer) onReject(e *entry, d amqp.Delivery, err error, requeue bool) {
+	e.stats.rejected.Add(1)
+	if ac.metrics != nil {
+		ac.metrics.IncRejected(e.Queue, e.tag, requeue)
+	}
+	if ac.hooks.OnReject != nil {
+		defer recoverHook("OnReject")
+		ac.hooks.OnReject(d, err, requeue)
+	}
+}
+
+func (ac *AmqpxConsumer) onSubscribe(queue, tag string, err error) {
+	if err == nil && ac.hooks.OnSubscribe != nil {
+		defer recoverHook("OnSubscribe")
+		ac.hooks.OnSubscribe(queue, tag)
+	}
+	if err != nil && ac.hooks.OnSubscribeError != nil {
+		defer recoverHook("OnSubscribeError")
+		ac.hooks.OnSubscribeError(queue, tag, err)
+	}
+}
+
+func (ac *AmqpxConsumer) onRestart(e *entry) {
+	if ac.metrics != nil {
+		ac.metrics.IncWatchdogRestart(e.Queue, e.tag)
+	}
+	if ac.hooks.OnRestart != nil {
+		defer recoverHook("OnRestart")
+		ac.hooks.OnRestart(e.Queue, e.tag)
+	}
+}
+
+func (ac *AmqpxConsumer) onCancel(e *entry) {
+	if ac.hooks.OnCancel != nil {
+		defer recoverHook("OnCancel")
+		ac.hooks.OnCancel(e.Queue, e.tag)
+	}
+}
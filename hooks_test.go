@@ -0,0 +1,39 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	var events []string
+	ac := &AmqpxConsumer{ctx: context.Background(), errorHandler: func(string, string, error, []byte) {}}
+	WithHooks(Hooks{
+		OnAck: func(d amqp.Delivery, dur time.Duration) {
+			require.Equal(t, time.Millisecond, dur)
+			events = append(events, "ack")
+		},
+		OnReject: func(d amqp.Delivery, err error, requeue bool) {
+			events = append(events, "reject")
+			require.False(t, requeue)
+			panic("broken hook")
+		},
+	})(ac)
+
+	ch := &recordingAcknowledger{}
+	e := &entry{Queue: "q", tag: "q-1"}
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1}, nil, time.Millisecond)
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 2}, Drop(errors.New("bad")), time.Millisecond)
+
+	// Hooks without a callback are skipped.
+	ac.onMessage(e, amqp.Delivery{})
+	ac.onSubscribe("q", "q-1", nil)
+
+	require.Equal(t, []string{"ack", "reject"}, events)
+	require.Equal(t, []string{"ack 1 false", "reject 2 false"}, ch.ops)
+}
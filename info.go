@@ -0,0 +1,169 @@
+package amqpx
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// EntryInfo is a snapshot of the state of a registered consumer.
+type EntryInfo struct {
+	Queue             string
+	ConsumerTag       string
+	Group             string // group name given to AddFuncMulti, empty otherwise
+	Status            ConsumerStatus
+	Processed         uint64    // deliveries handled, successfully or not
+	BrokerCancels     uint64    // times the broker cancelled the consumer
+	LastError         string    // last handler or subscription error, if any
+	LastMessageAt     time.Time // when the last delivery was received, zero if none
+	DisconnectedSince time.Time // when the consumer lost its subscription, zero while subscribed
+	Standby           bool      // WithSingleActive entry that has received nothing since subscribing
+}
+
+// Degraded reports whether the consumer has been running without a broker
+// subscription for longer than d, for instance to fail a health check.
+func (i EntryInfo) Degraded(d time.Duration) bool {
+	if i.Status == StatusIdle || i.Status == StatusPaused || i.DisconnectedSince.IsZero() {
+		return false
+	}
+	return time.Since(i.DisconnectedSince) > d
+}
+
+// ConsumerStats holds the counters of a registered consumer, see Stats.
+type ConsumerStats struct {
+	Consumed      uint64    // deliveries received
+	Acked         uint64    // deliveries acknowledged after their handler succeeded
+	Rejected      uint64    // deliveries rejected or retried after their handler failed
+	Panics        uint64    // handlers that panicked
+	InFlight      int64     // handlers running right now
+	LastError     string    // last handler or subscription error, if any
+	LastMessageAt time.Time // when the last delivery was received, zero if none
+	Connected     bool      // whether the consumer is subscribed to its queue
+	Reconnects    uint64    // subscriptions after the first one
+}
+
+// entryStats holds the counters of an entry, updated atomically by the consume loop.
+type entryStats struct {
+	status            atomic.Value // ConsumerStatus while the AmqpxConsumer runs
+	processed         atomic.Uint64
+	consumed          atomic.Uint64
+	acked             atomic.Uint64
+	rejected          atomic.Uint64
+	panics            atomic.Uint64
+	inflight          atomic.Int64
+	subscriptions     atomic.Uint64
+	subscribedAt      atomic.Int64 // unix nanoseconds of the last subscription
+	brokerCancels     atomic.Uint64
+	lastError         atomic.Value // string
+	lastMessageAt     atomic.Int64 // unix nanoseconds
+	disconnectedSince atomic.Int64 // unix nanoseconds
+}
+
+func (s *entryStats) setStatus(status ConsumerStatus) {
+	s.status.Store(status)
+	if status == StatusRunning {
+		s.subscriptions.Add(1)
+		s.subscribedAt.Store(time.Now().UnixNano())
+		s.disconnectedSince.Store(0)
+	} else {
+		s.disconnectedSince.CompareAndSwap(0, time.Now().UnixNano())
+	}
+}
+
+func (s *entryStats) recordDelivery() {
+	s.consumed.Add(1)
+	s.lastMessageAt.Store(time.Now().UnixNano())
+}
+
+func (s *entryStats) recordResult(err error) {
+	s.processed.Add(1)
+	if err != nil {
+		s.recordError(err)
+		var pe *PanicError
+		if errors.As(err, &pe) {
+			s.panics.Add(1)
+		}
+	}
+}
+
+func (s *entryStats) recordError(err error) {
+	s.lastError.Store(err.Error())
+}
+
+// Entries returns a snapshot of every registered consumer.
+func (ac *AmqpxConsumer) Entries() []EntryInfo {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	infos := make([]EntryInfo, 0, len(ac.entries))
+	for tag, e := range ac.entries {
+		infos = append(infos, ac.entryInfo(tag, e))
+	}
+	return infos
+}
+
+// Stats returns the counters of every registered consumer, by consumer tag.
+func (ac *AmqpxConsumer) Stats() map[string]ConsumerStats {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	stats := make(map[string]ConsumerStats, len(ac.entries))
+	for tag, e := range ac.entries {
+		s := ConsumerStats{
+			Consumed:  e.stats.consumed.Load(),
+			Acked:     e.stats.acked.Load(),
+			Rejected:  e.stats.rejected.Load(),
+			Panics:    e.stats.panics.Load(),
+			InFlight:  e.stats.inflight.Load(),
+			Connected: ac.entryStatus(e) == StatusRunning,
+		}
+		if n := e.stats.subscriptions.Load(); n > 1 {
+			s.Reconnects = n - 1
+		}
+		if err, ok := e.stats.lastError.Load().(string); ok {
+			s.LastError = err
+		}
+		if ns := e.stats.lastMessageAt.Load(); ns != 0 {
+			s.LastMessageAt = time.Unix(0, ns)
+		}
+		stats[tag] = s
+	}
+	return stats
+}
+
+// entryInfo builds the snapshot of e. The caller must hold runningMu.
+func (ac *AmqpxConsumer) entryInfo(tag string, e *entry) EntryInfo {
+	info := EntryInfo{
+		Queue:         e.Queue,
+		ConsumerTag:   tag,
+		Group:         e.group,
+		Status:        ac.entryStatus(e),
+		Processed:     e.stats.processed.Load(),
+		BrokerCancels: e.stats.brokerCancels.Load(),
+		Standby:       e.single && e.exclState.Load() != exclusiveActive,
+	}
+	if err, ok := e.stats.lastError.Load().(string); ok {
+		info.LastError = err
+	}
+	if ns := e.stats.lastMessageAt.Load(); ns != 0 {
+		info.LastMessageAt = time.Unix(0, ns)
+	}
+	if ns := e.stats.disconnectedSince.Load(); ns != 0 {
+		info.DisconnectedSince = time.Unix(0, ns)
+	}
+	return info
+}
+
+// entryStatus returns the status of e. The caller must hold runningMu.
+func (ac *AmqpxConsumer) entryStatus(e *entry) ConsumerStatus {
+	if e.isPaused() {
+		return StatusPaused
+	}
+	if !ac.running.Load() {
+		return StatusIdle
+	}
+	if status, ok := e.stats.status.Load().(ConsumerStatus); ok {
+		return status
+	}
+	return StatusConnecting
+}
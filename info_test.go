@@ -0,0 +1,72 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntries(t *testing.T) {
+	ac := &AmqpxConsumer{entries: make(map[string]*entry)}
+	tag, err := ac.AddFunc("orders", "c", func([]byte) error { return nil })
+	require.NoError(t, err)
+
+	e := ac.entries[tag]
+	e.stats.recordDelivery()
+	e.stats.recordResult(nil)
+	e.stats.recordResult(errors.New("boom"))
+
+	infos := ac.Entries()
+	require.Len(t, infos, 1)
+	info := infos[0]
+	require.Equal(t, "orders", info.Queue)
+	require.Equal(t, tag, info.ConsumerTag)
+	require.Equal(t, StatusIdle, info.Status)
+	require.Equal(t, uint64(2), info.Processed)
+	require.Equal(t, "boom", info.LastError)
+	require.False(t, info.LastMessageAt.IsZero())
+}
+
+func TestEntryInfoDegraded(t *testing.T) {
+	info := EntryInfo{Status: StatusRetrying, DisconnectedSince: time.Now().Add(-2 * time.Minute)}
+	require.True(t, info.Degraded(time.Minute))
+
+	info.DisconnectedSince = time.Now()
+	require.False(t, info.Degraded(time.Minute))
+
+	require.False(t, EntryInfo{Status: StatusRunning}.Degraded(time.Minute))
+	require.False(t, EntryInfo{Status: StatusIdle, DisconnectedSince: time.Unix(0, 0)}.Degraded(time.Minute))
+}
+
+func TestStats(t *testing.T) {
+	ac := &AmqpxConsumer{entries: make(map[string]*entry), ctx: context.Background(), errorHandler: func(string, string, error, []byte) {}}
+	tag, err := ac.AddFunc("orders", "c", func([]byte) error { return nil })
+	require.NoError(t, err)
+	e := ac.entries[tag]
+	ch := &recordingAcknowledger{}
+
+	e.stats.setStatus(StatusRunning)
+	e.stats.setStatus(StatusRetrying)
+	e.stats.setStatus(StatusRunning)
+	for i := 0; i < 3; i++ {
+		e.stats.recordDelivery()
+	}
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1}, nil, 0)
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 2}, errors.New("boom"), 0)
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 3}, &PanicError{Value: "bad"}, 0)
+
+	s := ac.Stats()[tag]
+	require.Equal(t, uint64(3), s.Consumed)
+	require.Equal(t, uint64(1), s.Acked)
+	require.Equal(t, uint64(2), s.Rejected)
+	require.Equal(t, uint64(1), s.Panics)
+	require.Equal(t, uint64(1), s.Reconnects)
+	require.Zero(t, s.InFlight)
+	require.False(t, s.Connected, "a consumer that is not started is not connected")
+	require.Contains(t, s.LastError, "bad")
+	require.False(t, s.LastMessageAt.IsZero())
+}
@@ -0,0 +1,40 @@
+package amqpx
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher publishes messages. It is implemented by *Amqpx, and lets the code
+// that only publishes be tested without a broker.
+type Publisher interface {
+	Publish(exchange, key string, body []byte, opts ...PublishOption) error
+	PublishWithContext(ctx context.Context, exchange, key string, body []byte, opts ...PublishOption) error
+}
+
+// QueueDeclarer declares the exchanges and queues of an application and binds
+// them. It is implemented by *Amqpx.
+type QueueDeclarer interface {
+	ExchangeDeclare(name, kind string) error
+	QueueDeclare(name string) (amqp.Queue, error)
+	QueueBind(name, key, exchange string) error
+}
+
+// ConsumerRegistry registers the handlers of the queues an application
+// consumes and runs them. It is implemented by *AmqpxConsumer.
+type ConsumerRegistry interface {
+	AddFunc(queue, consumer string, fn func([]byte) error, opts ...EntryOption) (string, error)
+	AddFuncCtx(queue, consumer string, fn func(ctx context.Context, body []byte) error, opts ...EntryOption) (string, error)
+	AddDeliveryFunc(queue, consumer string, fn func(amqp.Delivery) error, opts ...EntryOption) (string, error)
+	Remove(consumerTag string) error
+	Start() error
+	Stop() context.Context
+	StopContext(ctx context.Context) error
+}
+
+var (
+	_ Publisher        = (*Amqpx)(nil)
+	_ QueueDeclarer    = (*Amqpx)(nil)
+	_ ConsumerRegistry = (*AmqpxConsumer)(nil)
+)
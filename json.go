@@ -0,0 +1,57 @@
+package amqpx
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ContentTypeJSON is the content type set by PublishJSON and expected by AddJSONFunc.
+const ContentTypeJSON = "application/json"
+
+// AddJSONFunc adds a queue consumption configuration whose handler receives the
+// message body decoded from JSON into a T. Deliveries that carry a non-JSON
+// content type or that fail to decode are rejected without requeue, since they
+// would never succeed.
+func AddJSONFunc[T any](ac *AmqpxConsumer, queue, consumer string, fn func(T) error, opts ...EntryOption) (string, error) {
+	if fn == nil {
+		return "", ErrNilHandler
+	}
+	return ac.AddDeliveryFunc(queue, consumer, func(d amqp.Delivery) error {
+		if !isJSONContentType(d.ContentType) {
+			return Drop(fmt.Errorf("amqpx: unsupported content type %q, expected %s", d.ContentType, ContentTypeJSON))
+		}
+		var msg T
+		if err := json.Unmarshal(d.Body, &msg); err != nil {
+			return Drop(fmt.Errorf("amqpx: decode json: %w", err))
+		}
+		return fn(msg)
+	}, opts...)
+}
+
+// PublishJSON encodes v as JSON and publishes it to the specified exchange with
+// the given routing key and the application/json content type, which opts
+// cannot override.
+func (ad *Amqpx) PublishJSON(exchange, key string, v any, opts ...PublishOption) error {
+	body, _, err := JSONCodec{}.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("amqpx: encode json: %w", err)
+	}
+	return ad.Publish(exchange, key, body, append(opts, WithContentType(ContentTypeJSON))...)
+}
+
+// isJSONContentType reports whether contentType denotes JSON. An empty content
+// type is accepted for compatibility with publishers that do not set one.
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == ContentTypeJSON || strings.HasSuffix(mt, "+json")
+}
@@ -0,0 +1,16 @@
+package amqpx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsJSONContentType(t *testing.T) {
+	require.True(t, isJSONContentType(""))
+	require.True(t, isJSONContentType("application/json"))
+	require.True(t, isJSONContentType("application/json; charset=utf-8"))
+	require.True(t, isJSONContentType("application/vnd.orders+json"))
+	require.False(t, isJSONContentType("text/plain"))
+	require.False(t, isJSONContentType("application/x-protobuf"))
+}
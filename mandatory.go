@@ -0,0 +1,128 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// returnListener receives the messages returned by the broker on a channel.
+type returnListener struct {
+	flush chan chan struct{} // closes the sent channel once earlier returns are handled
+	done  chan struct{}      // closed when the channel is closed
+}
+
+// OnReturn registers fn to be called with every message returned by the
+// broker, that is published with the mandatory flag but routed to no queue,
+// including those of PublishMandatory. fn runs on the goroutine reading the
+// channel and must not block.
+func (ad *Amqpx) OnReturn(fn func(amqp.Return)) {
+	ad.returnMu.Lock()
+	defer ad.returnMu.Unlock()
+
+	ad.returnHook = fn
+}
+
+// PublishMandatory is like PublishConfirm but sets the mandatory flag, so that
+// the broker returns the message instead of dropping it when no queue is bound
+// to key; PublishMandatory then fails with ErrUnroutable. EnableConfirms must
+// have been called: the confirmation tells that no return is coming. The
+// message carries a HeaderReturnID header.
+func (ad *Amqpx) PublishMandatory(ctx context.Context, exchange, key string, body []byte, opts ...PublishOption) error {
+	msg := ad.newPublishing(body, opts)
+	return ad.chain(ad.sendMandatory)(ctx, exchange, key, msg)
+}
+
+// sendMandatory is the innermost PublishFunc of PublishMandatory.
+func (ad *Amqpx) sendMandatory(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+	id := strconv.FormatUint(ad.returnSeq.Add(1), 10)
+	m := *msg
+	m.Headers = make(amqp.Table, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		m.Headers[k] = v
+	}
+	m.Headers[HeaderReturnID] = id
+
+	returned := make(chan amqp.Return, 1)
+	ad.returnMu.Lock()
+	if ad.returnWaits == nil {
+		ad.returnWaits = make(map[string]chan amqp.Return)
+	}
+	ad.returnWaits[id] = returned
+	ad.returnMu.Unlock()
+	defer func() {
+		ad.returnMu.Lock()
+		delete(ad.returnWaits, id)
+		ad.returnMu.Unlock()
+	}()
+
+	rl, err := ad.publishConfirmed(ctx, exchange, key, true, &m)
+	if err != nil {
+		return err
+	}
+	// The broker sends the return before the confirmation, but the listener
+	// may not have handled it yet.
+	if rl != nil {
+		reply := make(chan struct{})
+		select {
+		case rl.flush <- reply:
+			<-reply
+		case <-rl.done:
+		}
+	}
+	select {
+	case r := <-returned:
+		return fmt.Errorf("%w: %d %s", ErrUnroutable, r.ReplyCode, r.ReplyText)
+	default:
+		return nil
+	}
+}
+
+// stripReturnID removes the HeaderReturnID header PublishMandatory set on a
+// message from headers: it only means something to the publishing client.
+func stripReturnID(headers amqp.Table) {
+	delete(headers, HeaderReturnID)
+}
+
+// listenReturns starts listening to the messages returned on ch. The
+// notification channel is unbuffered so that a return is received before the
+// confirmation that follows it is processed.
+func (ad *Amqpx) listenReturns(ch *amqp.Channel) *returnListener {
+	rl := &returnListener{flush: make(chan chan struct{}), done: make(chan struct{})}
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+	go func() {
+		defer close(rl.done)
+		for {
+			select {
+			case r, ok := <-returns:
+				if !ok {
+					return
+				}
+				ad.returned(r)
+			case reply := <-rl.flush:
+				close(reply)
+			}
+		}
+	}()
+	return rl
+}
+
+// returned hands r over to the PublishMandatory call that published it, if
+// any, and to the OnReturn callback.
+func (ad *Amqpx) returned(r amqp.Return) {
+	ad.returnMu.Lock()
+	id, _ := r.Headers[HeaderReturnID].(string)
+	if waiter, ok := ad.returnWaits[id]; ok {
+		select {
+		case waiter <- r:
+		default:
+		}
+	}
+	fn := ad.returnHook
+	ad.returnMu.Unlock()
+	if fn != nil {
+		fn(r)
+	}
+}
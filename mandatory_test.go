@@ -0,0 +1,63 @@
+package amqpx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReturned(t *testing.T) {
+	var hooked []string
+	ad := &Amqpx{returnWaits: map[string]chan amqp.Return{"1": make(chan amqp.Return, 1)}}
+	ad.OnReturn(func(r amqp.Return) { hooked = append(hooked, r.RoutingKey) })
+
+	ad.returned(amqp.Return{RoutingKey: "fire-and-forget"})
+	ad.returned(amqp.Return{RoutingKey: "mandatory", Headers: amqp.Table{HeaderReturnID: "1"}})
+
+	require.Equal(t, []string{"fire-and-forget", "mandatory"}, hooked)
+	require.Equal(t, "mandatory", (<-ad.returnWaits["1"]).RoutingKey)
+}
+
+func TestPublishMandatory(t *testing.T) {
+	const queue = "test_mandatory_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, cli.EnableConfirms())
+	returns := make(chan amqp.Return, 1)
+	cli.OnReturn(func(r amqp.Return) { returns <- r })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	require.NoError(t, cli.PublishMandatory(ctx, DefaultExchange, queue, []byte("routed")))
+
+	err = cli.PublishMandatory(ctx, DefaultExchange, "test_mandatory_nowhere", []byte("unroutable"))
+	require.ErrorIs(t, err, ErrUnroutable)
+	require.Contains(t, err.Error(), "NO_ROUTE")
+	require.Equal(t, "test_mandatory_nowhere", (<-returns).RoutingKey)
+
+	// Handlers do not see the return id of the routed message.
+	headers := make(chan amqp.Table, 1)
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddDeliveryFunc(queue, "test-mandatory-consumer", func(d amqp.Delivery) error {
+		headers <- d.Headers
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer ac.Stop()
+	select {
+	case h := <-headers:
+		require.NotContains(t, h, HeaderReturnID)
+	case <-time.After(time.Second * 2):
+		t.Fatal("routed message not delivered")
+	}
+}
@@ -0,0 +1,103 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrAlreadyAcknowledged is returned when a delivery consumed in manual
+// acknowledgement mode is acked, nacked or rejected more than once.
+var ErrAlreadyAcknowledged = errors.New("amqpx: delivery already acknowledged")
+
+// DefaultManualAckTimeout is how long Stop waits for outstanding manual
+// acknowledgements unless changed with WithManualAckTimeout.
+const DefaultManualAckTimeout = 30 * time.Second
+
+// AddManualAckFunc adds a queue consumption configuration in manual
+// acknowledgement mode: the consumer loop does not ack a delivery when the
+// handler returns nil, and the handler (or anything it hands the delivery to)
+// must eventually call d.Ack, d.Nack or d.Reject, from any goroutine.
+// Settling a delivery twice is harmless and returns ErrAlreadyAcknowledged.
+//
+// If the handler returns an error before settling the delivery, it is rejected
+// like in automatic mode. Stop waits for outstanding deliveries to be settled,
+// bounded by the timeout set with WithManualAckTimeout, before closing the channel.
+func (ac *AmqpxConsumer) AddManualAckFunc(queue, consumer string, fn func(ctx context.Context, d amqp.Delivery) error, opts ...EntryOption) (string, error) {
+	return ac.addEntry(consumer, &entry{
+		Queue:   queue,
+		Handler: fn,
+		manual:  true,
+	}, opts)
+}
+
+// WithManualAckTimeout sets how long Stop waits for deliveries consumed in
+// manual acknowledgement mode to be settled. It defaults to DefaultManualAckTimeout.
+func WithManualAckTimeout(d time.Duration) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.manualAckTimeout = d
+	}
+}
+
+// manualAcker wraps the acknowledger of a delivery consumed in manual mode so
+// that it is settled at most once and counted as outstanding until then.
+type manualAcker struct {
+	amqp.Acknowledger
+	settled atomic.Bool
+	wg      *sync.WaitGroup
+}
+
+// trackManual routes the acknowledgements of dely through a manualAcker.
+func (ac *AmqpxConsumer) trackManual(dely *amqp.Delivery) {
+	ac.outstanding.Add(1)
+	dely.Acknowledger = &manualAcker{Acknowledger: dely.Acknowledger, wg: &ac.outstanding}
+}
+
+func (m *manualAcker) settle() bool {
+	if !m.settled.CompareAndSwap(false, true) {
+		return false
+	}
+	m.wg.Done()
+	return true
+}
+
+func (m *manualAcker) Ack(tag uint64, multiple bool) error {
+	if !m.settle() {
+		return ErrAlreadyAcknowledged
+	}
+	return m.Acknowledger.Ack(tag, multiple)
+}
+
+func (m *manualAcker) Nack(tag uint64, multiple bool, requeue bool) error {
+	if !m.settle() {
+		return ErrAlreadyAcknowledged
+	}
+	return m.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (m *manualAcker) Reject(tag uint64, requeue bool) error {
+	if !m.settle() {
+		return ErrAlreadyAcknowledged
+	}
+	return m.Acknowledger.Reject(tag, requeue)
+}
+
+// waitOutstanding waits for outstanding manual acknowledgements, giving up
+// after the manual ack timeout.
+func (ac *AmqpxConsumer) waitOutstanding() bool {
+	done := make(chan struct{})
+	go func() {
+		ac.outstanding.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(ac.manualAckTimeout):
+		return false
+	}
+}
@@ -0,0 +1,24 @@
+package amqpx
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManualAckerDoubleAck(t *testing.T) {
+	ch := &recordingAcknowledger{}
+	ac := &AmqpxConsumer{manualAckTimeout: time.Millisecond * 50}
+
+	d := amqp.Delivery{Acknowledger: ch, DeliveryTag: 1}
+	ac.trackManual(&d)
+	require.False(t, ac.waitOutstanding(), "delivery is still outstanding")
+
+	require.NoError(t, d.Ack(false))
+	require.ErrorIs(t, d.Ack(false), ErrAlreadyAcknowledged)
+	require.ErrorIs(t, d.Reject(true), ErrAlreadyAcknowledged)
+	require.Equal(t, []string{"ack 1 false"}, ch.ops)
+	require.True(t, ac.waitOutstanding())
+}
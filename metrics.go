@@ -0,0 +1,77 @@
+package amqpx
+
+import (
+	"errors"
+	"time"
+)
+
+// MetricsCollector receives the metrics of an AmqpxConsumer and of its Amqpx
+// channels, labelled by queue and consumer tag. Its methods are called from
+// the consume loops and must be safe for concurrent use. See the amqpxprom
+// package for a Prometheus implementation.
+type MetricsCollector interface {
+	// IncConsumed counts a delivery received by a consumer.
+	IncConsumed(queue, tag string)
+	// IncAcked counts a delivery acknowledged after its handler succeeded.
+	IncAcked(queue, tag string)
+	// IncRejected counts a delivery rejected, or republished for a retry,
+	// after its handler failed.
+	IncRejected(queue, tag string, requeue bool)
+	// IncPanics counts a handler that panicked.
+	IncPanics(queue, tag string)
+	// ObserveHandlerDuration records how long a handler ran and its error.
+	ObserveHandlerDuration(queue, tag string, d time.Duration, err error)
+	// IncReconnect counts a channel re-established after it was closed.
+	IncReconnect()
+	// IncWatchdogRestart counts a stuck consumer restarted by the watchdog.
+	IncWatchdogRestart(queue, tag string)
+}
+
+// NopMetrics is a MetricsCollector that discards everything. It can be
+// embedded to implement only part of the interface.
+type NopMetrics struct{}
+
+func (NopMetrics) IncConsumed(queue, tag string)                                        {}
+func (NopMetrics) IncAcked(queue, tag string)                                           {}
+func (NopMetrics) IncRejected(queue, tag string, requeue bool)                          {}
+func (NopMetrics) IncPanics(queue, tag string)                                          {}
+func (NopMetrics) ObserveHandlerDuration(queue, tag string, d time.Duration, err error) {}
+func (NopMetrics) IncReconnect()                                                        {}
+func (NopMetrics) IncWatchdogRestart(queue, tag string)                                 {}
+
+// WithMetrics sets the MetricsCollector of the AmqpxConsumer and of the
+// channels it consumes from. By default metrics are discarded.
+func WithMetrics(m MetricsCollector) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.metrics = m
+	}
+}
+
+// metricsHolder gives the values stored in Amqpx.metrics a single concrete type.
+type metricsHolder struct{ MetricsCollector }
+
+// SetMetrics sets the MetricsCollector notified when the channel of ad is
+// re-established.
+func (ad *Amqpx) SetMetrics(m MetricsCollector) {
+	ad.metrics.Store(metricsHolder{m})
+}
+
+// collector returns the MetricsCollector of ad, NopMetrics if there is none.
+func (ad *Amqpx) collector() MetricsCollector {
+	if h, ok := ad.metrics.Load().(metricsHolder); ok && h.MetricsCollector != nil {
+		return h.MetricsCollector
+	}
+	return NopMetrics{}
+}
+
+// observeHandler records the outcome of a handler of e that ran for elapsed.
+func (ac *AmqpxConsumer) observeHandler(e *entry, err error, elapsed time.Duration) {
+	if ac.metrics == nil {
+		return
+	}
+	ac.metrics.ObserveHandlerDuration(e.Queue, e.tag, elapsed, err)
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		ac.metrics.IncPanics(e.Queue, e.tag)
+	}
+}
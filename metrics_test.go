@@ -0,0 +1,50 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMetrics struct {
+	NopMetrics
+	events []string
+}
+
+func (m *recordingMetrics) IncAcked(queue, tag string) {
+	m.events = append(m.events, "acked "+queue+" "+tag)
+}
+
+func (m *recordingMetrics) IncRejected(queue, tag string, requeue bool) {
+	m.events = append(m.events, fmt.Sprintf("rejected %s %s %t", queue, tag, requeue))
+}
+
+func (m *recordingMetrics) IncPanics(queue, tag string) {
+	m.events = append(m.events, "panic "+queue+" "+tag)
+}
+
+func (m *recordingMetrics) ObserveHandlerDuration(queue, tag string, d time.Duration, err error) {
+	m.events = append(m.events, fmt.Sprintf("duration %s %s %s %t", queue, tag, d, err != nil))
+}
+
+func TestMetrics(t *testing.T) {
+	m := &recordingMetrics{}
+	ac := &AmqpxConsumer{ctx: context.Background(), metrics: m, errorHandler: func(string, string, error, []byte) {}}
+	e := &entry{Queue: "q", tag: "q-1"}
+	ch := &recordingAcknowledger{}
+
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1}, nil, time.Second)
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 2}, &PanicError{Value: "boom"}, time.Second)
+
+	require.Equal(t, []string{
+		"duration q q-1 1s false",
+		"acked q q-1",
+		"duration q q-1 1s true",
+		"panic q q-1",
+		"rejected q q-1 false",
+	}, m.events)
+}
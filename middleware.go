@@ -0,0 +1,72 @@
+package amqpx
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Handler processes a single delivery. A nil error acks the delivery, any other
+// error rejects it.
+type Handler func(ctx context.Context, d amqp.Delivery) error
+
+// Middleware wraps a Handler with additional behavior. A middleware may inspect
+// or modify the delivery, observe the returned error, or return an error without
+// calling next to short-circuit the chain.
+type Middleware func(next Handler) Handler
+
+// Use appends middleware applied to the handlers of every entry. Middleware runs
+// in registration order: the first registered is the outermost. Global middleware
+// wraps the per-entry middleware set with WithMiddleware. Middleware does not
+// apply to batch handlers.
+func (ac *AmqpxConsumer) Use(mw ...Middleware) {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	ac.middlewares = append(ac.middlewares, mw...)
+}
+
+// WithMiddleware adds middleware applied only to this entry's handler, inside
+// the global middleware registered with Use.
+func WithMiddleware(mw ...Middleware) EntryOption {
+	return func(e *entry) {
+		e.middlewares = append(e.middlewares, mw...)
+	}
+}
+
+// WithRecoverer replaces the built-in Recover middleware, which always runs
+// innermost, directly around the handler. Passing nil removes panic recovery,
+// letting handler panics crash the process.
+func WithRecoverer(mw Middleware) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.recoverer = mw
+	}
+}
+
+// Recover is the built-in innermost middleware. It recovers a panic raised by
+// the handler, logs it with its stack trace and returns it as a *PanicError so
+// the delivery is rejected instead of acked.
+func Recover(next Handler) Handler {
+	return func(ctx context.Context, d amqp.Delivery) (err error) {
+		defer recoverPanic(&err)
+		return next(ctx, d)
+	}
+}
+
+// handler builds the middleware chain around the handler of e.
+func (ac *AmqpxConsumer) handler(e *entry) Handler {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	h := e.Handler
+	if ac.recoverer != nil {
+		h = ac.recoverer(h)
+	}
+	for i := len(e.middlewares) - 1; i >= 0; i-- {
+		h = e.middlewares[i](h)
+	}
+	for i := len(ac.middlewares) - 1; i >= 0; i-- {
+		h = ac.middlewares[i](h)
+	}
+	return h
+}
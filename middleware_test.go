@@ -0,0 +1,57 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, d amqp.Delivery) error {
+				calls = append(calls, name)
+				return next(ctx, d)
+			}
+		}
+	}
+
+	ac := &AmqpxConsumer{recoverer: Recover}
+	ac.Use(trace("global-1"), trace("global-2"))
+	e := &entry{Handler: func(context.Context, amqp.Delivery) error {
+		calls = append(calls, "handler")
+		panic("boom")
+	}}
+	WithMiddleware(trace("entry"))(e)
+
+	err := ac.handler(e)(context.Background(), amqp.Delivery{})
+	var pe *PanicError
+	require.True(t, errors.As(err, &pe))
+	require.Equal(t, []string{"global-1", "global-2", "entry", "handler"}, calls)
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	denied := errors.New("denied")
+	ac := &AmqpxConsumer{recoverer: Recover}
+	ac.Use(func(next Handler) Handler {
+		return func(ctx context.Context, d amqp.Delivery) error {
+			if d.Headers["tenant"] == nil {
+				return Drop(denied)
+			}
+			return next(ctx, d)
+		}
+	})
+	called := false
+	e := &entry{Handler: func(context.Context, amqp.Delivery) error {
+		called = true
+		return nil
+	}}
+
+	err := ac.handler(e)(context.Background(), amqp.Delivery{})
+	require.ErrorIs(t, err, denied)
+	require.False(t, called)
+}
@@ -0,0 +1,145 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HeaderMovedFrom is set by MoveMessages with MoveOptions.StampSource to the
+// queue a message was moved from.
+const HeaderMovedFrom = "x-moved-from"
+
+// Consumer retrieves the messages of a queue one at a time. It is implemented
+// by *Amqpx.
+type Consumer interface {
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+}
+
+// ConfirmPublisher is a Publisher whose publishes can wait for the broker to
+// confirm them. It is implemented by *Amqpx once EnableConfirms was called.
+type ConfirmPublisher interface {
+	Publisher
+	PublishConfirm(ctx context.Context, exchange, key string, body []byte, opts ...PublishOption) error
+}
+
+// MoveOptions configures MoveMessages.
+type MoveOptions struct {
+	Queue    string // queue the messages are moved from
+	Exchange string // exchange the messages are published to
+	Key      string // routing key the messages are published with
+
+	Max                int     // messages to move at most, 0 for all
+	Rate               float64 // messages moved per second at most, 0 for unlimited
+	StampSource        bool    // set HeaderMovedFrom to Queue
+	PreserveProperties bool    // publish with the properties and headers of the original
+
+	ProgressEvery int              // messages between two calls of Progress, 1000 by default
+	Progress      func(MoveReport) // called during long moves, may be nil
+}
+
+// MoveReport is the progress of MoveMessages.
+type MoveReport struct {
+	Moved   int
+	Elapsed time.Duration
+}
+
+// MoveMessages moves the messages of opts.Queue from src to dst, which may be
+// *Amqpx instances connected to different vhosts or brokers, until the queue
+// is empty, ctx is done or opts.Max messages were moved. dst must implement
+// ConfirmPublisher: each message is removed from the source only once its copy
+// is confirmed by the destination, so that a failure cannot lose messages but
+// may duplicate the one being moved. MoveMessages stops at the first message
+// that cannot be moved, which is put back in the queue, and returns the error
+// with the report of the messages moved until then.
+func MoveMessages(ctx context.Context, src Consumer, dst Publisher, opts MoveOptions) (MoveReport, error) {
+	var report MoveReport
+	confirmed, ok := dst.(ConfirmPublisher)
+	if !ok {
+		return report, fmt.Errorf("%w: %T does not confirm publishes", ErrConfirmsDisabled, dst)
+	}
+	get, done, err := getter(src, opts.Queue)
+	if err != nil {
+		return report, err
+	}
+	defer done()
+
+	var limiter *tokenBucket
+	if opts.Rate > 0 {
+		limiter = newTokenBucket(opts.Rate, 1)
+	}
+	every := opts.ProgressEvery
+	if every <= 0 {
+		every = 1000
+	}
+	start := time.Now()
+	for opts.Max <= 0 || report.Moved < opts.Max {
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				return report, err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		d, ok, err := get()
+		if err != nil {
+			return report, err
+		}
+		if !ok {
+			break
+		}
+		if err := confirmed.PublishConfirm(ctx, opts.Exchange, opts.Key, d.Body, moveOptions(d, opts)); err != nil {
+			d.Nack(false, true)
+			return report, fmt.Errorf("amqpd move err: %w", err)
+		}
+		if err := d.Ack(false); err != nil {
+			return report, fmt.Errorf("amqpd move ack err: %w", err)
+		}
+		report.Moved++
+		report.Elapsed = time.Since(start)
+		if opts.Progress != nil && report.Moved%every == 0 {
+			opts.Progress(report)
+		}
+	}
+	report.Elapsed = time.Since(start)
+	return report, nil
+}
+
+// moveOptions returns the PublishOption copying d as set by opts.
+func moveOptions(d amqp.Delivery, opts MoveOptions) PublishOption {
+	return func(msg *Publishing) {
+		if opts.PreserveProperties {
+			msg.Publishing = deliveryToPublishing(d)
+		}
+		if opts.StampSource {
+			if msg.Headers == nil {
+				msg.Headers = amqp.Table{}
+			}
+			msg.Headers[HeaderMovedFrom] = opts.Queue
+		}
+	}
+}
+
+// getter returns a function getting the messages of queue from src without
+// acknowledging them, and a function to call when done. For an *Amqpx, the
+// messages are got on a single channel rather than one per message.
+func getter(src Consumer, queue string) (get func() (amqp.Delivery, bool, error), done func(), err error) {
+	ad, ok := src.(*Amqpx)
+	if !ok {
+		return func() (amqp.Delivery, bool, error) { return src.Get(queue, false) }, func() {}, nil
+	}
+	ch, err := ad.openChannel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("amqpd open channel err: %w", err)
+	}
+	get = func() (amqp.Delivery, bool, error) {
+		d, ok, err := ch.Get(queue, false)
+		if missing(err) {
+			err = fmt.Errorf("%w: %s", ErrQueueNotFound, queue)
+		}
+		return d, ok, err
+	}
+	return get, func() { ch.Close() }, nil
+}
@@ -0,0 +1,130 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+// memQueue is a Consumer serving deliveries from memory.
+type memQueue struct {
+	queue    []amqp.Delivery
+	acked    []uint64
+	requeued []uint64
+}
+
+func (q *memQueue) Get(_ string, autoAck bool) (amqp.Delivery, bool, error) {
+	if len(q.queue) == 0 {
+		return amqp.Delivery{}, false, nil
+	}
+	d := q.queue[0]
+	q.queue = q.queue[1:]
+	d.Acknowledger = q
+	return d, true, nil
+}
+
+func (q *memQueue) Ack(tag uint64, _ bool) error {
+	q.acked = append(q.acked, tag)
+	return nil
+}
+
+func (q *memQueue) Nack(tag uint64, _, _ bool) error {
+	q.requeued = append(q.requeued, tag)
+	return nil
+}
+
+func (q *memQueue) Reject(tag uint64, requeue bool) error { return q.Nack(tag, false, requeue) }
+
+// memConfirmPublisher is a ConfirmPublisher recording the messages published.
+type memConfirmPublisher struct {
+	Publisher
+	published []*amqp.Publishing
+	fail      error
+}
+
+func (p *memConfirmPublisher) PublishConfirm(_ context.Context, _, _ string, body []byte, opts ...PublishOption) error {
+	if p.fail != nil {
+		return p.fail
+	}
+	msg := &Publishing{Publishing: amqp.Publishing{Body: body}}
+	for _, opt := range opts {
+		opt(msg)
+	}
+	p.published = append(p.published, &msg.Publishing)
+	return nil
+}
+
+func TestMoveMessages(t *testing.T) {
+	src := &memQueue{}
+	for i := 1; i <= 5; i++ {
+		src.queue = append(src.queue, amqp.Delivery{DeliveryTag: uint64(i), Body: []byte{byte('0' + i)}, ContentType: "application/json", Headers: amqp.Table{"k": "v"}})
+	}
+	dst := &memConfirmPublisher{}
+	var progress []int
+	report, err := MoveMessages(context.Background(), src, dst, MoveOptions{
+		Queue: "orders", Key: "orders-v2", Max: 4, StampSource: true, PreserveProperties: true,
+		ProgressEvery: 2, Progress: func(r MoveReport) { progress = append(progress, r.Moved) },
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Moved)
+	require.Equal(t, []int{2, 4}, progress)
+	require.Equal(t, []uint64{1, 2, 3, 4}, src.acked)
+	require.Equal(t, "application/json", dst.published[0].ContentType)
+	require.Equal(t, amqp.Table{"k": "v", HeaderMovedFrom: "orders"}, dst.published[0].Headers)
+
+	dst = &memConfirmPublisher{}
+	report, err = MoveMessages(context.Background(), src, dst, MoveOptions{Queue: "orders"})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Moved, "stops once the queue is empty")
+	require.Empty(t, dst.published[0].Headers, "properties not preserved")
+
+	src.queue = append(src.queue, amqp.Delivery{DeliveryTag: 6})
+	dst.fail = ErrPublishNacked
+	report, err = MoveMessages(context.Background(), src, dst, MoveOptions{Queue: "orders"})
+	require.ErrorIs(t, err, ErrPublishNacked)
+	require.Zero(t, report.Moved)
+	require.Equal(t, []uint64{6}, src.requeued, "the message that failed is put back")
+
+	_, err = MoveMessages(context.Background(), src, struct{ Publisher }{}, MoveOptions{})
+	require.True(t, errors.Is(err, ErrConfirmsDisabled))
+}
+
+func TestMoveMessagesBetweenClients(t *testing.T) {
+	const (
+		from = "test_move_from"
+		to   = "test_move_to"
+	)
+
+	src, err := New()
+	require.NoError(t, err)
+	defer src.Close()
+	dst, err := New()
+	require.NoError(t, err)
+	defer dst.Close()
+	require.NoError(t, dst.EnableConfirms())
+	for _, q := range []string{from, to} {
+		_, _ = src.QueueDelete(q, false, false)
+		defer src.QueueDelete(q, false, false)
+		_, err = src.QueueDeclareWithOptions(q, WithQueueDurable(false))
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, dst.PublishConfirm(ctx, DefaultExchange, from, []byte("moved"), WithMessageID(string(rune('a'+i)))))
+	}
+
+	report, err := MoveMessages(ctx, src, dst, MoveOptions{Queue: from, Key: to, Rate: 1000, StampSource: true, PreserveProperties: true})
+	require.NoError(t, err)
+	require.Equal(t, 10, report.Moved)
+	d, ok, err := src.GetAndAck(to)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a", d.MessageId)
+	require.Equal(t, from, d.Headers[HeaderMovedFrom])
+	info, err := src.QueueInspect(from)
+	require.NoError(t, err)
+	require.Zero(t, info.Messages)
+}
@@ -0,0 +1,170 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// OutboxMessage is a message of an outbox, written by the application in the
+// same database transaction as the changes it announces.
+type OutboxMessage struct {
+	ID string // identifies the message in the store
+	PublishedMessage
+}
+
+// OutboxStore gives an OutboxRelay access to the outbox of the application.
+type OutboxStore interface {
+	// FetchBatch returns up to n messages that are neither sent nor failed,
+	// oldest first.
+	FetchBatch(ctx context.Context, n int) ([]OutboxMessage, error)
+	// MarkSent records that the broker acknowledged the messages.
+	MarkSent(ctx context.Context, ids []string) error
+	// MarkFailed records that the broker refused the messages with err.
+	MarkFailed(ctx context.Context, ids []string, err error) error
+}
+
+// OutboxOption configures an OutboxRelay.
+type OutboxOption func(*OutboxRelay)
+
+// WithPollInterval sets how long the relay waits before fetching messages again
+// once the outbox is empty, one second by default.
+func WithPollInterval(d time.Duration) OutboxOption {
+	return func(r *OutboxRelay) { r.pollInterval = d }
+}
+
+// WithBatchSize sets the number of messages fetched at once, 100 by default.
+func WithBatchSize(n int) OutboxOption {
+	return func(r *OutboxRelay) { r.batchSize = n }
+}
+
+// WithRelayConcurrency sets the number of messages of a batch published at
+// the same time, 1 by default. Messages are published out of order above 1.
+func WithRelayConcurrency(n int) OutboxOption {
+	return func(r *OutboxRelay) { r.concurrency = n }
+}
+
+// OutboxRelay publishes the messages of an OutboxStore with confirms, marking
+// them sent only once the broker acknowledged them. A message may be published
+// twice if the process stops between the acknowledgement and MarkSent, so
+// consumers should be idempotent.
+type OutboxRelay struct {
+	cli          *Amqpx
+	store        OutboxStore
+	pollInterval time.Duration
+	batchSize    int
+	concurrency  int
+}
+
+// NewOutboxRelay returns an OutboxRelay publishing the messages of store
+// through cli.
+func NewOutboxRelay(cli *Amqpx, store OutboxStore, opts ...OutboxOption) *OutboxRelay {
+	r := &OutboxRelay{
+		cli:          cli,
+		store:        store,
+		pollInterval: time.Second,
+		batchSize:    100,
+		concurrency:  1,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run puts the channel in confirm mode and relays messages until ctx is done.
+// It pauses while the channel is being re-established; messages whose publish
+// was interrupted are left in the store and fetched again.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	if !r.cli.confirms.Load() {
+		if err := r.cli.EnableConfirms(); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-r.cli.channelReady():
+		case <-ctx.Done():
+			return nil
+		}
+		msgs, err := r.store.FetchBatch(ctx, r.batchSize)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("amqpd-outbox: fetch batch err: %s\n", err)
+		}
+		if err == nil && len(msgs) > 0 {
+			r.relay(ctx, msgs)
+		}
+		if err == nil && len(msgs) == r.batchSize {
+			continue // there may be more
+		}
+		select {
+		case <-time.After(r.pollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// relay publishes msgs and marks them according to the outcome.
+func (r *OutboxRelay) relay(ctx context.Context, msgs []OutboxMessage) {
+	errs := make([]error, len(msgs))
+	publish := r.cli.chain(r.cli.sendConfirm)
+	sem := make(chan struct{}, max(r.concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range msgs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			m := msgs[i].Publishing
+			errs[i] = publish(ctx, msgs[i].Exchange, msgs[i].Key, &m)
+		}(i)
+	}
+	wg.Wait()
+
+	var sent []string
+	var kinds []string              // error messages, in order
+	failures := map[string]error{}  // first error of each kind
+	failed := map[string][]string{} // ids by error message
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			sent = append(sent, msgs[i].ID)
+		case !refused(err):
+			// Left in the store to be published again.
+		default:
+			if _, ok := failures[err.Error()]; !ok {
+				failures[err.Error()] = err
+				kinds = append(kinds, err.Error())
+			}
+			failed[err.Error()] = append(failed[err.Error()], msgs[i].ID)
+		}
+	}
+
+	// Record the outcome even if ctx is done, the messages were published.
+	ctx = context.WithoutCancel(ctx)
+	if len(sent) > 0 {
+		if err := r.store.MarkSent(ctx, sent); err != nil {
+			log.Printf("amqpd-outbox: mark %d messages sent err: %s\n", len(sent), err)
+		}
+	}
+	for _, kind := range kinds {
+		ids := failed[kind]
+		if err := r.store.MarkFailed(ctx, ids, failures[kind]); err != nil {
+			log.Printf("amqpd-outbox: mark %d messages failed err: %s\n", len(ids), err)
+		}
+	}
+}
+
+// refused reports whether a publish failed because of the message rather than
+// the state of the channel or of the relay, so that it should not be retried.
+func refused(err error) bool {
+	return !transientPublishError(err) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, ErrDraining) &&
+		!errors.Is(err, ErrCircuitOpen) &&
+		!errors.Is(err, ErrConfirmsDisabled) // the channel was just replaced
+}
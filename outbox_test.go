@@ -0,0 +1,143 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+// memOutbox is an OutboxStore keeping its messages in memory.
+type memOutbox struct {
+	mu     sync.Mutex
+	msgs   []OutboxMessage
+	sent   []string
+	failed map[string]error
+}
+
+func (s *memOutbox) FetchBatch(_ context.Context, n int) ([]OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var batch []OutboxMessage
+	for _, m := range s.msgs {
+		if len(batch) == n {
+			break
+		}
+		if !s.done(m.ID) {
+			batch = append(batch, m)
+		}
+	}
+	return batch, nil
+}
+
+func (s *memOutbox) done(id string) bool {
+	if _, ok := s.failed[id]; ok {
+		return true
+	}
+	for _, sent := range s.sent {
+		if sent == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memOutbox) MarkSent(_ context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, ids...)
+	return nil
+}
+
+func (s *memOutbox) MarkFailed(_ context.Context, ids []string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed == nil {
+		s.failed = map[string]error{}
+	}
+	for _, id := range ids {
+		s.failed[id] = err
+	}
+	return nil
+}
+
+func (s *memOutbox) sentCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.sent)
+}
+
+func TestOutboxRelayMarks(t *testing.T) {
+	ad := &Amqpx{}
+	ad.SetPublishInterceptors(func(PublishFunc) PublishFunc {
+		return func(_ context.Context, _, key string, _ *amqp.Publishing) error {
+			switch key {
+			case "nacked":
+				return ErrPublishNacked
+			case "lost":
+				return amqp.ErrClosed
+			}
+			return nil
+		}
+	})
+	store := &memOutbox{}
+	for i, key := range []string{"ok", "nacked", "lost", "ok", "nacked"} {
+		store.msgs = append(store.msgs, OutboxMessage{
+			ID:               fmt.Sprint(i),
+			PublishedMessage: PublishedMessage{Key: key},
+		})
+	}
+
+	NewOutboxRelay(ad, store, WithRelayConcurrency(2)).relay(context.Background(), store.msgs)
+	require.ElementsMatch(t, []string{"0", "3"}, store.sent)
+	require.Len(t, store.failed, 2)
+	require.ErrorIs(t, store.failed["1"], ErrPublishNacked)
+	require.ErrorIs(t, store.failed["4"], ErrPublishNacked)
+
+	batch, err := store.FetchBatch(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, batch, 1, "the message of the lost channel is published again")
+	require.Equal(t, "2", batch[0].ID)
+}
+
+func TestOutboxRelay(t *testing.T) {
+	const queue = "test_outbox_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+
+	store := &memOutbox{}
+	for i := 0; i < 25; i++ {
+		store.msgs = append(store.msgs, OutboxMessage{
+			ID: fmt.Sprint(i),
+			PublishedMessage: PublishedMessage{
+				Key:        queue,
+				Publishing: amqp.Publishing{Body: []byte(fmt.Sprint(i))},
+			},
+		})
+	}
+	relay := NewOutboxRelay(cli, store, WithBatchSize(10), WithRelayConcurrency(4), WithPollInterval(time.Millisecond*10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- relay.Run(ctx) }()
+	require.Eventually(t, func() bool { return store.sentCount() == 25 }, time.Second*5, time.Millisecond*10)
+	cancel()
+	require.NoError(t, <-done)
+
+	q, err := cli.channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+	require.NoError(t, err)
+	require.Equal(t, 25, q.Messages)
+}
@@ -0,0 +1,121 @@
+package amqpx
+
+import "fmt"
+
+// ConsumerStatus describes the state of a registered consumer.
+type ConsumerStatus string
+
+const (
+	StatusIdle       ConsumerStatus = "idle"       // registered, the AmqpxConsumer is not running
+	StatusConnecting ConsumerStatus = "connecting" // subscribing to its queue
+	StatusRunning    ConsumerStatus = "running"    // consuming from its queue
+	StatusRetrying   ConsumerStatus = "retrying"   // waiting to subscribe again after a failure
+	StatusPaused     ConsumerStatus = "paused"     // cancelled on the broker until Resume is called
+	StatusFailed     ConsumerStatus = "failed"     // stopped after the broker permanently refused the subscription
+	StatusStandby    ConsumerStatus = "standby"    // waiting for the exclusive consumer holding the queue to go away
+	StatusCancelled  ConsumerStatus = "cancelled"  // stopped after a broker-side cancellation, see CancelFatal
+)
+
+// Pause stops pulling messages for the consumer identified by consumerTag
+// without removing it: the consumer is cancelled on the broker, so new messages
+// stay in the queue, and its goroutine waits for Resume. Deliveries already
+// being handled finish and are acked normally.
+func (ac *AmqpxConsumer) Pause(consumerTag string) error {
+	e, err := ac.entry(consumerTag)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	if e.paused {
+		e.mu.Unlock()
+		return nil
+	}
+	e.paused = true
+	e.pauses++
+	e.resumed = make(chan struct{})
+	e.mu.Unlock()
+	e.stopWaiting()
+
+	ac.runningMu.Lock()
+	running := ac.running.Load()
+	ac.runningMu.Unlock()
+	if cli := ac.openedClient(e); running && cli != nil {
+		return cli.Cancel(consumerTag)
+	}
+	return nil
+}
+
+// Resume restarts a consumer paused with Pause, subscribing again to its queue
+// with the same consumer tag and handler.
+func (ac *AmqpxConsumer) Resume(consumerTag string) error {
+	e, err := ac.entry(consumerTag)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.paused {
+		e.paused = false
+		close(e.resumed)
+	}
+	return nil
+}
+
+// Status returns the state of the consumer identified by consumerTag.
+func (ac *AmqpxConsumer) Status(consumerTag string) (ConsumerStatus, error) {
+	e, err := ac.entry(consumerTag)
+	if err != nil {
+		return "", err
+	}
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	return ac.entryStatus(e), nil
+}
+
+// entry returns the entry registered under consumerTag.
+func (ac *AmqpxConsumer) entry(consumerTag string) (*entry, error) {
+	ac.runningMu.Lock()
+	defer ac.runningMu.Unlock()
+
+	e, ok := ac.entries[consumerTag]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConsumerNotFound, consumerTag)
+	}
+	return e, nil
+}
+
+// waitResumed blocks while e is paused. It returns false if e was removed or
+// the consumer stopped in the meantime.
+func (ac *AmqpxConsumer) waitResumed(e *entry) bool {
+	e.mu.Lock()
+	paused, resumed := e.paused, e.resumed
+	e.mu.Unlock()
+
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-e.quit:
+		return false
+	case <-ac.stopped:
+		return false
+	}
+}
+
+func (e *entry) isPaused() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.paused
+}
+
+func (e *entry) pauseCount() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.pauses
+}
@@ -0,0 +1,141 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// pubChannel is a channel used to publish.
+type pubChannel struct {
+	ch      *amqp.Channel
+	returns *returnListener
+	confirm bool // in confirm mode
+}
+
+// channelPool holds the channels of an Amqpx used to publish concurrently.
+// Channels are opened on demand, up to size, and discarded once closed.
+type channelPool struct {
+	slots chan struct{}    // one token per open channel
+	idle  chan *pubChannel // open channels not in use
+	dial  func() (*amqp.Channel, error)
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// SetPublishPool makes the publish methods of ad, except PublishAsync, use a
+// pool of up to size channels opened on demand from its connection instead of
+// the channel of ad, so that concurrent publishes are not serialized on a
+// single channel and are unaffected by exceptions raised on it. Publishing
+// waits for a channel while they are all in use. Channels found closed are
+// discarded and replaced, and each is put in confirm mode by EnableConfirms
+// on first use. A size of 0 disables the pool. The channels are closed by
+// Close.
+func (ad *Amqpx) SetPublishPool(size int) {
+	ad.publishMu.Lock()
+	old := ad.pool
+	ad.pool = nil
+	if size > 0 {
+		ad.pool = &channelPool{
+			slots: make(chan struct{}, size),
+			idle:  make(chan *pubChannel, size),
+			dial:  ad.openChannel,
+		}
+	}
+	ad.publishMu.Unlock()
+	if old != nil {
+		old.close()
+	}
+}
+
+// acquire returns a channel to publish on and the function to call once the
+// message has been written.
+func (ad *Amqpx) acquire(ctx context.Context) (pubChannel, func(), error) {
+	ad.publishMu.Lock()
+	pool := ad.pool
+	ad.publishMu.Unlock()
+	if pool == nil {
+		return pubChannel{ch: ad.channel, returns: ad.returns.Load()}, noRelease, nil
+	}
+	pc, err := pool.get(ctx, ad.listenReturns)
+	if err != nil {
+		return pubChannel{}, nil, err
+	}
+	if ad.confirms.Load() && !pc.confirm {
+		if err := pc.ch.Confirm(false); err != nil {
+			pool.put(pc)
+			return pubChannel{}, nil, fmt.Errorf("amqpd confirm mode err: %w", err)
+		}
+		pc.confirm = true
+	}
+	return *pc, func() { pool.put(pc) }, nil
+}
+
+// noRelease is the release function of the channel of ad.
+func noRelease() {}
+
+// get checks out an idle channel, or opens one if the pool is not full.
+func (p *channelPool) get(ctx context.Context, listen func(*amqp.Channel) *returnListener) (*pubChannel, error) {
+	for {
+		var pc *pubChannel
+		select {
+		case pc = <-p.idle:
+		default:
+			select {
+			case pc = <-p.idle:
+			case p.slots <- struct{}{}:
+				return p.open(listen)
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if !pc.ch.IsClosed() {
+			return pc, nil
+		}
+		<-p.slots
+	}
+}
+
+// open opens a channel in the slot just taken.
+func (p *channelPool) open(listen func(*amqp.Channel) *returnListener) (*pubChannel, error) {
+	ch, err := p.dial()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return &pubChannel{ch: ch, returns: listen(ch)}, nil
+}
+
+// put checks a channel back in, or discards it if it is closed or if the pool
+// has been closed.
+func (p *channelPool) put(pc *pubChannel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || pc.ch.IsClosed() {
+		pc.ch.Close()
+		<-p.slots
+		return
+	}
+	p.idle <- pc
+}
+
+// close closes the idle channels, and the others as they are checked in.
+func (p *channelPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for {
+		select {
+		case pc := <-p.idle:
+			pc.ch.Close()
+			<-p.slots
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package amqpx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelPoolFull(t *testing.T) {
+	p := &channelPool{slots: make(chan struct{}, 1), idle: make(chan *pubChannel, 1)}
+	p.slots <- struct{}{} // the only channel is in use
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	_, err := p.get(ctx, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPublishPool(t *testing.T) {
+	const queue = "test_publish_pool_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	cli.SetPublishPool(3)
+	require.NoError(t, cli.EnableConfirms())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, cli.PublishConfirm(ctx, DefaultExchange, queue, []byte("pooled")))
+		}()
+	}
+	wg.Wait()
+	require.LessOrEqual(t, len(cli.pool.slots), 3)
+
+	// A channel closed by an exception is replaced.
+	pc, release, err := cli.acquire(ctx)
+	require.NoError(t, err)
+	require.Error(t, pc.ch.ExchangeDeclarePassive("test_publish_pool_missing", ExchangeDirect, true, false, false, false, nil))
+	release()
+	require.NoError(t, cli.PublishConfirm(ctx, DefaultExchange, queue, []byte("after exception")))
+
+	q, err := cli.channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+	require.NoError(t, err)
+	require.Equal(t, 21, q.Messages)
+	_, err = cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, err)
+
+	require.NoError(t, cli.Close())
+	require.Nil(t, cli.pool)
+}
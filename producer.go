@@ -1,12 +1,32 @@
 package amqpx
 
-import "errors"
+import (
+	"context"
+)
 
 // Publish publishes a message to the specified exchange with the given routing key
 // using the default Amqpx instance (Default).
-func Publish(exchange, key string, body []byte) error {
+func Publish(exchange, key string, body []byte, opts ...PublishOption) error {
 	if Default == nil {
-		return errors.New("default amqpd instance is not initialized")
+		return ErrNotInitialized
 	}
-	return Default.Publish(exchange, key, body)
+	return Default.Publish(exchange, key, body, opts...)
+}
+
+// PublishWithContext is like Publish but bounded by ctx, see
+// Amqpx.PublishWithContext.
+func PublishWithContext(ctx context.Context, exchange, key string, body []byte, opts ...PublishOption) error {
+	if Default == nil {
+		return ErrNotInitialized
+	}
+	return Default.PublishWithContext(ctx, exchange, key, body, opts...)
+}
+
+// PublishToQueue publishes a message to queue through the default exchange
+// using the default Amqpx instance, see Amqpx.PublishToQueue.
+func PublishToQueue(ctx context.Context, queue string, body []byte, opts ...PublishOption) error {
+	if Default == nil {
+		return ErrNotInitialized
+	}
+	return Default.PublishToQueue(ctx, queue, body, opts...)
 }
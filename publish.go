@@ -0,0 +1,376 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// PublishFunc publishes msg to exchange with routing key. msg may be modified
+// before it is sent.
+type PublishFunc func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error
+
+// PublishOption customizes a published message, or how it is published.
+type PublishOption func(*Publishing)
+
+// Publishing is the message built by the PublishOptions of a publish call,
+// along with the settings of the call that are not sent to the broker.
+type Publishing struct {
+	amqp.Publishing
+
+	ensureQueue bool // set by WithEnsureQueue
+}
+
+// WithContentType sets the MIME content type of the message, "text/plain" by
+// default, see DefaultsInterceptor.
+func WithContentType(contentType string) PublishOption {
+	return func(msg *Publishing) { msg.ContentType = contentType }
+}
+
+// WithHeaders adds headers to the message. Later options override the headers
+// set by earlier ones.
+func WithHeaders(headers amqp.Table) PublishOption {
+	return func(msg *Publishing) {
+		if msg.Headers == nil {
+			msg.Headers = make(amqp.Table, len(headers))
+		}
+		for k, v := range headers {
+			msg.Headers[k] = v
+		}
+	}
+}
+
+// WithPersistent marks the message persistent, so that a durable queue keeps it
+// across broker restarts.
+func WithPersistent() PublishOption {
+	return WithDeliveryMode(amqp.Persistent)
+}
+
+// WithDeliveryMode sets the delivery mode of the message, amqp.Transient or
+// amqp.Persistent, overriding the default of the Amqpx.
+func WithDeliveryMode(mode uint8) PublishOption {
+	return func(msg *Publishing) { msg.DeliveryMode = mode }
+}
+
+// WithPriority sets the priority of the message, used by the queues declared
+// WithMaxPriority. Like AMQP, uint8 bounds it to 255; priorities above the
+// maximum of the queue are treated as the maximum.
+func WithPriority(n uint8) PublishOption {
+	return func(msg *Publishing) { msg.Priority = n }
+}
+
+// WithExpiration sets the per-message TTL, after which the broker discards or
+// dead-letters the message. It is rounded down to the millisecond.
+func WithExpiration(d time.Duration) PublishOption {
+	return func(msg *Publishing) { msg.Expiration = strconv.FormatInt(d.Milliseconds(), 10) }
+}
+
+// WithCorrelationID sets the correlation identifier of the message, typically
+// the MessageId of the request it answers.
+func WithCorrelationID(id string) PublishOption {
+	return func(msg *Publishing) { msg.CorrelationId = id }
+}
+
+// WithReplyTo sets the queue the receiver should reply to.
+func WithReplyTo(queue string) PublishOption {
+	return func(msg *Publishing) { msg.ReplyTo = queue }
+}
+
+// WithMessageID sets the application message identifier.
+func WithMessageID(id string) PublishOption {
+	return func(msg *Publishing) { msg.MessageId = id }
+}
+
+// WithType sets the type of the message, the name of its schema.
+func WithType(name string) PublishOption {
+	return func(msg *Publishing) { msg.Type = name }
+}
+
+// WithTimestamp sets the timestamp of the message.
+func WithTimestamp(t time.Time) PublishOption {
+	return func(msg *Publishing) { msg.Timestamp = t }
+}
+
+// SetDefaultDeliveryMode sets the delivery mode of the messages published
+// through ad that do not set one with WithDeliveryMode or WithPersistent.
+//
+// Messages are transient by default and are lost when the broker restarts,
+// even in durable queues. Only persistent messages in durable queues survive a
+// restart; a persistent message routed to a non-durable queue is lost with the
+// queue. Persistence costs throughput, as the broker writes messages to disk.
+func (ad *Amqpx) SetDefaultDeliveryMode(mode uint8) {
+	ad.deliveryMode.Store(uint32(mode))
+}
+
+// newPublishing returns the amqp.Publishing of body with opts applied. The
+// defaults of ad are applied by DefaultsInterceptor. It is allocated once, as
+// the publish pipeline takes a pointer anyway.
+func (ad *Amqpx) newPublishing(body []byte, opts []PublishOption) *amqp.Publishing {
+	return &ad.buildPublishing(body, opts).Publishing
+}
+
+// buildPublishing is like newPublishing but returns the settings of opts too.
+func (ad *Amqpx) buildPublishing(body []byte, opts []PublishOption) *Publishing {
+	msg := &Publishing{Publishing: amqp.Publishing{Body: body}}
+	for _, opt := range opts {
+		opt(msg)
+	}
+	return msg
+}
+
+// WithEnsureQueue makes PublishToQueue check that the queue exists before
+// publishing, and fail with ErrQueueNotFound otherwise instead of having the
+// broker drop the message. The check costs a round trip to the broker. Other
+// publish methods ignore it.
+func WithEnsureQueue() PublishOption {
+	return func(msg *Publishing) { msg.ensureQueue = true }
+}
+
+// PublishToQueue publishes a message to queue through the default exchange,
+// like PublishWithContext(ctx, DefaultExchange, queue, body, opts...).
+func (ad *Amqpx) PublishToQueue(ctx context.Context, queue string, body []byte, opts ...PublishOption) error {
+	if queue == "" {
+		return ErrEmptyQueue
+	}
+	msg := ad.buildPublishing(body, opts)
+	if msg.ensureQueue {
+		ok, err := ad.queueExists(queue)
+		if err != nil {
+			return fmt.Errorf("amqpd check queue err: %s", err)
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrQueueNotFound, queue)
+		}
+	}
+	return ad.publisher()(ctx, DefaultExchange, queue, &msg.Publishing)
+}
+
+// PublishInterceptor wraps a PublishFunc with additional behavior, e.g. to add
+// headers to every message. It may return an error without calling next to
+// abort the publish.
+type PublishInterceptor func(next PublishFunc) PublishFunc
+
+// UsePublishInterceptor appends interceptors applied to every message published
+// through ad. They run in registration order: the first registered is the
+// outermost. They all run outside the built-in DefaultsInterceptor, unless the
+// pipeline was set with SetPublishInterceptors, in which case they are
+// appended to it.
+func (ad *Amqpx) UsePublishInterceptor(interceptors ...PublishInterceptor) {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	ad.interceptors = append(ad.interceptors, interceptors...)
+	ad.resetChain()
+}
+
+// PublishInterceptors returns the interceptors applied to the messages
+// published through ad, outermost first, including the built-in ones.
+func (ad *Amqpx) PublishInterceptors() []PublishInterceptor {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	return ad.pipeline()
+}
+
+// SetPublishInterceptors replaces the interceptors applied to the messages
+// published through ad, outermost first, including the built-in ones: the
+// pipeline returned by PublishInterceptors can be reordered, and the built-in
+// interceptors left out.
+func (ad *Amqpx) SetPublishInterceptors(interceptors ...PublishInterceptor) {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	ad.interceptors = slices.Clone(interceptors)
+	ad.customPipeline = true
+	ad.resetChain()
+}
+
+// pipeline returns the interceptors of ad. It is called with publishMu held.
+func (ad *Amqpx) pipeline() []PublishInterceptor {
+	if ad.customPipeline {
+		return slices.Clone(ad.interceptors)
+	}
+	return append(slices.Clone(ad.interceptors), ad.DefaultsInterceptor())
+}
+
+// DefaultsInterceptor returns the built-in interceptor of ad, which sets the
+// content type of messages without one to "text/plain", their delivery mode, if
+// unset, to the one set by SetDefaultDeliveryMode, and their Envelope: a random
+// UUID as message id, the current time and the id set by SetAppID, unless set
+// by options. It is the innermost interceptor unless SetPublishInterceptors
+// places it elsewhere.
+func (ad *Amqpx) DefaultsInterceptor() PublishInterceptor {
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+			if msg.ContentType == "" {
+				msg.ContentType = "text/plain"
+			}
+			if msg.DeliveryMode == 0 {
+				msg.DeliveryMode = uint8(ad.deliveryMode.Load())
+			}
+			ad.stamp(msg)
+			return next(ctx, exchange, key, msg)
+		}
+	}
+}
+
+// publisher returns the PublishFunc of ad, built from its interceptors.
+func (ad *Amqpx) publisher() PublishFunc {
+	if p := ad.sendChain.Load(); p != nil {
+		return *p
+	}
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	p := ad.chainLocked(ad.send)
+	ad.sendChain.Store(&p)
+	return p
+}
+
+// chain wraps p, the innermost PublishFunc, with the interceptors of ad.
+func (ad *Amqpx) chain(p PublishFunc) PublishFunc {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	return ad.chainLocked(p)
+}
+
+// pinned is like chain without the retries of SetPublishRetry, for a p
+// publishing on a channel held by the caller: once closed, the channel stays
+// so, and retrying on it would only fail again after the backoff.
+func (ad *Amqpx) pinned(p PublishFunc) PublishFunc {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	return ad.wrapLocked(p, false)
+}
+
+// chainLocked is chain called with publishMu held. The setters of the settings
+// it reads must call resetChain.
+func (ad *Amqpx) chainLocked(p PublishFunc) PublishFunc {
+	return ad.wrapLocked(p, true)
+}
+
+// wrapLocked wraps p with the interceptors of ad, and with the retries of
+// SetPublishRetry if retry is set. It is called with publishMu held.
+func (ad *Amqpx) wrapLocked(p PublishFunc, retry bool) PublishFunc {
+	p = ad.tracked(ad.validating(ad.unblocking(p)))
+	if retry && ad.maxRetries > 0 {
+		p = ad.retrying(p, ad.maxRetries, ad.retryBackoff)
+	}
+	if ad.breaker != nil {
+		p = ad.breaker.wrap(p)
+	}
+	interceptors := ad.pipeline()
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		p = interceptors[i](p)
+	}
+	return p
+}
+
+// resetChain discards the PublishFunc cached by publisher after a change of
+// the settings of the pipeline. It is called with publishMu held.
+func (ad *Amqpx) resetChain() {
+	ad.sendChain.Store(nil)
+}
+
+// send is the innermost PublishFunc, it writes msg to the channel. The
+// channel ignores ctx and may block, so the write is abandoned, not
+// interrupted, when ctx is done.
+func (ad *Amqpx) send(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pc, release, err := ad.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		defer release()
+		return pc.ch.PublishWithContext(ctx, exchange, key, false, false, *msg)
+	}
+	m := *msg
+	return abandonable(ctx, func() error {
+		defer release()
+		return pc.ch.PublishWithContext(ctx, exchange, key, false, false, m)
+	})
+}
+
+// abandonable runs fn, returning early with ctx.Err() if ctx is done first.
+// fn keeps running in the background in that case.
+func abandonable(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetPublishRetry makes the publish methods of ad retry up to maxRetries times
+// when the channel or the connection is lost, waiting for the delay of b and
+// then for the channel to be re-established, within the deadline of the
+// context. Permanent errors, like a PRECONDITION_FAILED exception, are not
+// retried. A message whose confirmation was lost with the channel may have
+// reached the broker and is published twice. Interceptors run only once. A nil
+// b stands for DefaultBackoff.
+func (ad *Amqpx) SetPublishRetry(maxRetries int, b Backoff) {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	if b == nil {
+		b = DefaultBackoff
+	}
+	ad.maxRetries = maxRetries
+	ad.retryBackoff = b
+	ad.resetChain()
+}
+
+// retrying wraps p to retry it as set by SetPublishRetry.
+func (ad *Amqpx) retrying(p PublishFunc, maxRetries int, b Backoff) PublishFunc {
+	return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+		for failures := 1; ; failures++ {
+			err := p(ctx, exchange, key, msg)
+			if err == nil || failures > maxRetries || !transientPublishError(err) {
+				return err
+			}
+			timer := time.NewTimer(b.NextDelay(failures))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+			select {
+			case <-ad.channelReady():
+			case <-ad.stop:
+				return err
+			case <-ctx.Done():
+				return err
+			}
+		}
+	}
+}
+
+// transientPublishError reports whether err is caused by the loss of the
+// channel or the connection, so that publishing again may succeed.
+func transientPublishError(err error) bool {
+	if errors.Is(err, amqp.ErrClosed) {
+		return true
+	}
+	var ae *amqp.Error
+	if errors.As(err, &ae) {
+		switch ae.Code {
+		case amqp.ConnectionForced, amqp.InternalError, amqp.ResourceError:
+			return true
+		}
+	}
+	return false
+}
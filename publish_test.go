@@ -0,0 +1,300 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishInterceptorOrder(t *testing.T) {
+	var order []string
+	record := func(name string) PublishInterceptor {
+		return func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+				order = append(order, name)
+				msg.Headers = amqp.Table{name: true}
+				return next(ctx, exchange, key, msg)
+			}
+		}
+	}
+	errTooLarge := errors.New("too large")
+	var seen amqp.Publishing
+	abort := func(PublishFunc) PublishFunc {
+		return func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+			seen = *msg
+			return errTooLarge
+		}
+	}
+
+	ad := &Amqpx{}
+	ad.UsePublishInterceptor(record("outer"), record("inner"))
+	ad.UsePublishInterceptor(abort)
+
+	require.ErrorIs(t, ad.publish("ex", "key", amqp.Publishing{}), errTooLarge)
+	require.Equal(t, []string{"outer", "inner"}, order)
+	require.Equal(t, amqp.Table{"inner": true}, seen.Headers)
+}
+
+func TestPublishWithContext(t *testing.T) {
+	type ctxKey struct{}
+	var seen amqp.Publishing
+	var value any
+	ad := &Amqpx{}
+	ad.SetPublishInterceptors(ad.DefaultsInterceptor(), func(PublishFunc) PublishFunc {
+		return func(ctx context.Context, _, _ string, msg *amqp.Publishing) error {
+			seen, value = *msg, ctx.Value(ctxKey{})
+			return nil
+		}
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	withType := func(msg *Publishing) { msg.Type = "order.created" }
+	require.NoError(t, ad.PublishWithContext(ctx, "ex", "key", []byte("body"), withType))
+	require.Equal(t, "request", value)
+	require.Equal(t, "text/plain", seen.ContentType)
+	require.Equal(t, "order.created", seen.Type)
+	require.Equal(t, []byte("body"), seen.Body)
+}
+
+func TestSendCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ad := &Amqpx{}
+	require.ErrorIs(t, ad.send(ctx, "ex", "key", &amqp.Publishing{}), context.Canceled)
+}
+
+func TestPublishOptions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ad := &Amqpx{}
+	msg := ad.newPublishing([]byte("body"), []PublishOption{
+		WithContentType("application/json"),
+		WithHeaders(amqp.Table{"a": 1, "b": 1}),
+		WithHeaders(amqp.Table{"b": 2}),
+		WithPersistent(),
+		WithPriority(5),
+		WithExpiration(time.Second * 30),
+		WithCorrelationID("req-1"),
+		WithReplyTo("replies"),
+		WithMessageID("msg-1"),
+		WithTimestamp(now),
+		WithDelay(time.Second * 5),
+	})
+	require.Equal(t, &amqp.Publishing{
+		ContentType:   "application/json",
+		Headers:       amqp.Table{"a": 1, "b": 2, HeaderDelay: int64(5000)},
+		DeliveryMode:  amqp.Persistent,
+		Priority:      5,
+		Expiration:    "30000",
+		CorrelationId: "req-1",
+		ReplyTo:       "replies",
+		MessageId:     "msg-1",
+		Timestamp:     now,
+		Body:          []byte("body"),
+	}, msg)
+
+	require.Equal(t, amqp.Publishing{Body: []byte("body")}, *ad.newPublishing([]byte("body"), nil))
+}
+
+func TestDefaultDeliveryMode(t *testing.T) {
+	var seen []amqp.Publishing
+	ad := &Amqpx{}
+	ad.SetPublishInterceptors(ad.DefaultsInterceptor(), func(PublishFunc) PublishFunc {
+		return func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+			m := *msg
+			m.MessageId, m.Timestamp = "", time.Time{} // see TestEnvelope
+			seen = append(seen, m)
+			return nil
+		}
+	})
+
+	require.NoError(t, ad.Publish("ex", "key", []byte("transient")))
+	ad.SetDefaultDeliveryMode(amqp.Persistent)
+	require.NoError(t, ad.Publish("ex", "key", []byte("persistent")))
+	require.NoError(t, ad.Publish("ex", "key", []byte("override"), WithDeliveryMode(amqp.Transient)))
+
+	require.Equal(t, []amqp.Publishing{
+		{ContentType: "text/plain", DeliveryMode: 0, Body: []byte("transient")},
+		{ContentType: "text/plain", DeliveryMode: amqp.Persistent, Body: []byte("persistent")},
+		{ContentType: "text/plain", DeliveryMode: amqp.Transient, Body: []byte("override")},
+	}, seen)
+}
+
+func TestPublishRetry(t *testing.T) {
+	ready := make(chan struct{})
+	close(ready)
+	ad := &Amqpx{channel: &amqp.Channel{}, ready: ready}
+	ad.SetPublishRetry(2, ExponentialBackoff{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond})
+
+	var attempts int
+	fail := func(errs ...error) PublishFunc {
+		attempts = 0
+		return func(context.Context, string, string, *amqp.Publishing) error {
+			attempts++
+			if attempts <= len(errs) {
+				return errs[attempts-1]
+			}
+			return nil
+		}
+	}
+	ctx := context.Background()
+
+	require.NoError(t, ad.chain(fail(amqp.ErrClosed, amqp.ErrClosed))(ctx, "ex", "key", &amqp.Publishing{}))
+	require.Equal(t, 3, attempts)
+
+	err := ad.chain(fail(amqp.ErrClosed, amqp.ErrClosed, amqp.ErrClosed))(ctx, "ex", "key", &amqp.Publishing{})
+	require.ErrorIs(t, err, amqp.ErrClosed)
+	require.Equal(t, 3, attempts, "retries exhausted")
+
+	precondition := &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED"}
+	require.Equal(t, precondition, ad.chain(fail(precondition))(ctx, "ex", "key", &amqp.Publishing{}))
+	require.Equal(t, 1, attempts, "permanent errors are not retried")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, ad.chain(fail(amqp.ErrClosed))(cancelled, "ex", "key", &amqp.Publishing{}), amqp.ErrClosed)
+	require.Equal(t, 1, attempts)
+
+	err = ad.pinned(fail(amqp.ErrClosed, amqp.ErrClosed))(ctx, "ex", "key", &amqp.Publishing{})
+	require.ErrorIs(t, err, amqp.ErrClosed)
+	require.Equal(t, 1, attempts, "a pinned channel is not retried")
+}
+
+func TestPublishRetryNilBackoff(t *testing.T) {
+	ad := &Amqpx{}
+	ad.SetPublishRetry(1, nil)
+	require.Equal(t, DefaultBackoff, ad.retryBackoff)
+}
+
+func TestPublishToQueue(t *testing.T) {
+	var key string
+	var seen amqp.Publishing
+	ad := &Amqpx{}
+	ad.UsePublishInterceptor(func(PublishFunc) PublishFunc {
+		return func(_ context.Context, exchange, k string, msg *amqp.Publishing) error {
+			require.Equal(t, DefaultExchange, exchange)
+			key, seen = k, *msg
+			return nil
+		}
+	})
+
+	require.NoError(t, ad.PublishToQueue(context.Background(), "orders", []byte("body"), WithPersistent()))
+	require.Equal(t, "orders", key)
+	require.Equal(t, amqp.Persistent, seen.DeliveryMode)
+	require.ErrorIs(t, ad.PublishToQueue(context.Background(), "", []byte("body")), ErrEmptyQueue)
+
+	msg := ad.buildPublishing(nil, []PublishOption{WithEnsureQueue()})
+	require.True(t, msg.ensureQueue)
+	require.Equal(t, amqp.Publishing{}, msg.Publishing, "the setting is not published")
+}
+
+func TestPublishToQueueEnsureQueue(t *testing.T) {
+	const queue = "test_publish_to_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+
+	require.NoError(t, cli.PublishToQueue(context.Background(), queue, []byte("body"), WithEnsureQueue()))
+	err = cli.PublishToQueue(context.Background(), "test_publish_to_missing_queue", []byte("body"), WithEnsureQueue())
+	require.ErrorIs(t, err, ErrQueueNotFound)
+	require.False(t, cli.channel.IsClosed())
+}
+
+func TestPublishPipeline(t *testing.T) {
+	var order []string
+	record := func(name string) PublishInterceptor {
+		return func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+				order = append(order, name+":"+msg.ContentType)
+				return next(ctx, exchange, key, msg)
+			}
+		}
+	}
+	var sent amqp.Publishing
+	send := func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+		sent = *msg
+		return nil
+	}
+
+	ad := &Amqpx{}
+	ad.UsePublishInterceptor(record("audit"))
+	pipeline := ad.PublishInterceptors()
+	require.Len(t, pipeline, 2, "the built-in interceptor is innermost")
+	require.NoError(t, ad.chain(send)(context.Background(), "ex", "key", &amqp.Publishing{}))
+	require.Equal(t, []string{"audit:"}, order)
+	require.Equal(t, "text/plain", sent.ContentType)
+
+	// Move the built-in interceptor outermost, so that the audit sees its defaults.
+	order = nil
+	ad.SetPublishInterceptors(pipeline[1], pipeline[0])
+	ad.UsePublishInterceptor(record("size"))
+	require.NoError(t, ad.chain(send)(context.Background(), "ex", "key", &amqp.Publishing{}))
+	require.Equal(t, []string{"audit:text/plain", "size:text/plain"}, order)
+
+	// Leave it out.
+	ad.SetPublishInterceptors()
+	require.NoError(t, ad.chain(send)(context.Background(), "ex", "key", &amqp.Publishing{}))
+	require.Empty(t, sent.ContentType)
+}
+
+func TestPublisherRebuilt(t *testing.T) {
+	var seen []string
+	record := func(name string) PublishInterceptor {
+		return func(PublishFunc) PublishFunc {
+			return func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+				seen = append(seen, name+":"+string(msg.Body))
+				return nil
+			}
+		}
+	}
+	ad := &Amqpx{}
+	ad.SetPublishInterceptors(record("a"))
+	require.NoError(t, ad.Publish("ex", "key", []byte("first")))
+	require.NoError(t, ad.Publish("ex", "key", []byte("second")))
+	ad.SetPublishInterceptors(record("b"))
+	require.NoError(t, ad.Publish("ex", "key", []byte("third")))
+	require.Equal(t, []string{"a:first", "a:second", "b:third"}, seen)
+}
+
+// benchClient returns an Amqpx whose pipeline ends with a discarding
+// interceptor instead of the channel, to measure the cost of the publish path.
+func benchClient() *Amqpx {
+	ad := &Amqpx{}
+	ad.SetPublishInterceptors(ad.DefaultsInterceptor(), func(PublishFunc) PublishFunc {
+		return func(context.Context, string, string, *amqp.Publishing) error { return nil }
+	})
+	return ad
+}
+
+func BenchmarkPublish(b *testing.B) {
+	ad := benchClient()
+	body := []byte("benchmark body")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := ad.Publish("ex", "key", body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPublishWithOptions(b *testing.B) {
+	ad := benchClient()
+	body := []byte("benchmark body")
+	headers := amqp.Table{"tenant": "acme"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := ad.Publish("ex", "key", body,
+			WithPersistent(), WithContentType(ContentTypeJSON), WithMessageID("id"),
+			WithExpiration(time.Minute), WithHeaders(headers))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Message is a message of a batch published by PublishBatch.
+type Message struct {
+	Key     string // routing key
+	Body    []byte
+	Options []PublishOption
+}
+
+// BatchError is returned by PublishBatch when some messages of the batch were
+// not confirmed. The others were, and need not be published again.
+type BatchError struct {
+	Failed []int   // indexes in the batch of the failed messages, in order
+	Errs   []error // Errs[i] is the reason of the failure of Failed[i]
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("amqpx: %d of the batch messages failed, indexes %v: %s", len(e.Failed), e.Failed, e.Errs[0])
+}
+
+// Unwrap returns the reasons of the failures, so that errors.Is can tell for
+// instance whether some messages were nacked.
+func (e *BatchError) Unwrap() []error { return e.Errs }
+
+// PublishBatch publishes msgs to exchange on a single channel, then waits for
+// all of them to be confirmed, which is much faster than confirming them one
+// by one. EnableConfirms must have been called. If some messages are nacked,
+// could not be written or are still unconfirmed when ctx is done, it returns a
+// *BatchError listing them.
+func (ad *Amqpx) PublishBatch(ctx context.Context, exchange string, msgs []Message) error {
+	if !ad.confirms.Load() {
+		return ErrConfirmsDisabled
+	}
+	pc, release, err := ad.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The messages are published on pc, which a retry could not replace.
+	var dc *amqp.DeferredConfirmation
+	publish := ad.pinned(func(ctx context.Context, exchange, key string, msg *amqp.Publishing) (err error) {
+		dc, err = pc.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, *msg)
+		if err == nil && dc == nil {
+			err = ErrConfirmsDisabled
+		}
+		return err
+	})
+	confirms := make([]*amqp.DeferredConfirmation, len(msgs))
+	errs := make([]error, len(msgs))
+	for i, m := range msgs {
+		if errs[i] = ctx.Err(); errs[i] != nil {
+			continue
+		}
+		dc = nil
+		errs[i] = publish(ctx, exchange, m.Key, ad.newPublishing(m.Body, m.Options))
+		confirms[i] = dc
+	}
+	release()
+
+	// Confirmations arrive in order, multiple ones being split by the library,
+	// so waiting for them in order costs no more than waiting for the last.
+	batchErr := &BatchError{}
+	for i, dc := range confirms {
+		if errs[i] == nil {
+			errs[i] = ad.nacked(exchange, msgs[i].Key, waitConfirm(ctx, pc.ch, dc))
+		}
+		if errs[i] != nil {
+			batchErr.Failed = append(batchErr.Failed, i)
+			batchErr.Errs = append(batchErr.Errs, errs[i])
+		}
+	}
+	if len(batchErr.Failed) > 0 {
+		return batchErr
+	}
+	return nil
+}
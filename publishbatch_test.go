@@ -0,0 +1,43 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchError(t *testing.T) {
+	err := error(&BatchError{Failed: []int{2, 5}, Errs: []error{ErrPublishNacked, context.DeadlineExceeded}})
+	require.ErrorIs(t, err, ErrPublishNacked)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Contains(t, err.Error(), "[2 5]")
+
+	require.ErrorIs(t, (&Amqpx{}).PublishBatch(context.Background(), "", nil), ErrConfirmsDisabled)
+}
+
+func TestPublishBatch(t *testing.T) {
+	const queue = "test_publish_batch_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, cli.EnableConfirms())
+
+	msgs := make([]Message, 500)
+	for i := range msgs {
+		msgs[i] = Message{Key: queue, Body: []byte(fmt.Sprint(i)), Options: []PublishOption{WithPersistent()}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, cli.PublishBatch(ctx, DefaultExchange, msgs))
+
+	q, err := cli.channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+	require.NoError(t, err)
+	require.Equal(t, len(msgs), q.Messages)
+}
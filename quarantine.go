@@ -0,0 +1,68 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// quarantineStackSize bounds the stack trace excerpt sent in HeaderQuarantineStack.
+const quarantineStackSize = 2 << 10
+
+// WithPanicQuarantine parks the deliveries whose handler panicked instead of
+// requeueing them: the message is published to exchange with routingKey,
+// carrying its original headers plus HeaderQuarantineReason,
+// HeaderQuarantineStack, HeaderQuarantinedAt and HeaderOriginalQueue, and the
+// original delivery is acked once the broker confirmed the copy. If the copy
+// is nacked, returned as unroutable or not confirmed in time, the delivery is
+// requeued so that it is not lost.
+//
+// Quarantine takes precedence over WithMaxRetries and the requeue policy for
+// panics; other errors are handled as usual. It does not apply to batch
+// handlers, whose panics cannot be blamed on a single delivery.
+func WithPanicQuarantine(exchange, routingKey string) EntryOption {
+	return func(e *entry) {
+		e.quarantine = true
+		e.quarantineExchange = exchange
+		e.quarantineKey = routingKey
+	}
+}
+
+// quarantine publishes dely, whose handler panicked with pe, to the quarantine
+// exchange of e. It reports whether the delivery will be delivered again.
+func (ac *AmqpxConsumer) quarantine(e *entry, dely amqp.Delivery, pe *PanicError) (requeued bool) {
+	stack := pe.Stack
+	if len(stack) > quarantineStackSize {
+		stack = stack[:quarantineStackSize]
+	}
+	msg := deliveryToPublishing(dely)
+	msg.Headers[HeaderQuarantineReason] = fmt.Sprint(pe.Value)
+	msg.Headers[HeaderQuarantineStack] = string(stack)
+	msg.Headers[HeaderQuarantinedAt] = time.Now()
+	msg.Headers[HeaderOriginalQueue] = e.Queue
+	if err := ac.republish(e.quarantineExchange, e.quarantineKey, msg); err != nil {
+		ac.channelError(e, "quarantine", err, &dely)
+		if err := dely.Nack(false, true); err != nil {
+			ac.channelError(e, "reject", err, &dely)
+		}
+		return true
+	}
+	ac.ack(e, dely)
+	return false
+}
+
+// republishTimeout bounds how long republish waits for the confirmation.
+const republishTimeout = 30 * time.Second
+
+// republish publishes msg, a copy of a delivery about to be acked, through the
+// interceptors of the consumer's Amqpx, as mandatory and waiting for its
+// confirmation. It returns an error if the copy may not have been taken by a
+// queue, in which case the delivery must be requeued rather than acked.
+func (ac *AmqpxConsumer) republish(exchange, key string, msg amqp.Publishing) error {
+	ctx, cancel := context.WithTimeout(context.Background(), republishTimeout)
+	defer cancel()
+
+	return ac.cli.chain(ac.cli.sendMandatory)(ctx, exchange, key, &msg)
+}
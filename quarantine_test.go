@@ -0,0 +1,84 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+// capturePublishes returns an Amqpx whose publishes are recorded instead of
+// sent, failing with err if it is not nil.
+func capturePublishes(err error) (*Amqpx, *[]amqp.Publishing) {
+	var sent []amqp.Publishing
+	cli := &Amqpx{}
+	cli.UsePublishInterceptor(func(PublishFunc) PublishFunc {
+		return func(_ context.Context, exchange, key string, msg *amqp.Publishing) error {
+			if err != nil {
+				return err
+			}
+			msg.Headers["exchange"], msg.Headers["key"] = exchange, key
+			sent = append(sent, *msg)
+			return nil
+		}
+	})
+	return cli, &sent
+}
+
+func TestPanicQuarantine(t *testing.T) {
+	cli, sent := capturePublishes(nil)
+	ac := &AmqpxConsumer{ctx: context.Background(), cli: cli, panicRequeue: true, errorHandler: func(string, string, error, []byte) {}}
+	e := &entry{Queue: "orders", tag: "orders-1"}
+	WithPanicQuarantine("parking", "orders.bad")(e)
+	WithMaxRetries(3, "dlx", "orders")(e)
+	ch := &recordingAcknowledger{}
+
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1, Body: []byte("poison")}, &PanicError{Value: "nil map", Stack: []byte("goroutine 1")}, 0)
+	require.Equal(t, []string{"ack 1 false"}, ch.ops)
+	require.Len(t, *sent, 1)
+	msg := (*sent)[0]
+	require.Equal(t, "parking", msg.Headers["exchange"])
+	require.Equal(t, "orders.bad", msg.Headers["key"])
+	require.Equal(t, "nil map", msg.Headers[HeaderQuarantineReason])
+	require.Equal(t, "goroutine 1", msg.Headers[HeaderQuarantineStack])
+	require.Equal(t, "orders", msg.Headers[HeaderOriginalQueue])
+	require.Contains(t, msg.Headers, HeaderQuarantinedAt)
+	require.Equal(t, []byte("poison"), msg.Body)
+
+	// Plain errors still go through the retries.
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 2}, errors.New("boom"), 0)
+	require.Len(t, *sent, 2)
+	require.Equal(t, DefaultExchange, (*sent)[1].Headers["exchange"])
+}
+
+func TestPanicQuarantinePublishFailure(t *testing.T) {
+	cli, _ := capturePublishes(errors.New("channel closed"))
+	ac := &AmqpxConsumer{ctx: context.Background(), cli: cli, errorHandler: func(string, string, error, []byte) {}}
+	e := &entry{Queue: "orders", tag: "orders-1"}
+	WithPanicQuarantine("parking", "orders.bad")(e)
+	ch := &recordingAcknowledger{}
+
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1}, &PanicError{Value: "nil map"}, 0)
+	require.Equal(t, []string{"nack 1 false true"}, ch.ops)
+}
+
+func TestPanicQuarantineUnroutable(t *testing.T) {
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	defer func() { <-ac.Stop().Done() }()
+	e := &entry{Queue: "orders", tag: "orders-1"}
+	WithPanicQuarantine("amq.direct", "test.quarantine.nowhere")(e)
+	ch := &recordingAcknowledger{}
+
+	ac.errorHandler = func(string, string, error, []byte) {}
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1}, &PanicError{Value: "nil map"}, 0)
+	require.Equal(t, []string{"nack 1 false true"}, ch.ops, "a copy no queue took is not acked")
+
+	// A missing exchange closes the channel: the copy is not confirmed.
+	WithPanicQuarantine("test_quarantine_missing", "orders.bad")(e)
+	ch.ops = nil
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 2}, &PanicError{Value: "nil map"}, 0)
+	require.Equal(t, []string{"nack 2 false true"}, ch.ops)
+}
@@ -0,0 +1,75 @@
+package amqpx
+
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HeaderDeliveryCount is the header in which quorum queues count the failed
+// deliveries of a message, i.e. those returned to the queue by a reject with
+// requeue or a lost consumer. It is absent on the first delivery.
+const HeaderDeliveryCount = "x-delivery-count"
+
+// QueueTypeQuorum is the x-queue-type of a quorum queue.
+const QueueTypeQuorum = "quorum"
+
+// WithDeliveryLimit sets how many times a quorum queue redelivers a message
+// before discarding or dead-lettering it.
+func WithDeliveryLimit(n int) QueueOption {
+	return WithQueueArgs(amqp.Table{"x-delivery-limit": int64(n)})
+}
+
+// WithQuorumInitialGroupSize sets the number of replicas of a quorum queue when
+// it is declared, instead of one per cluster node.
+func WithQuorumInitialGroupSize(n int) QueueOption {
+	return WithQueueArgs(amqp.Table{"x-quorum-initial-group-size": int64(n)})
+}
+
+// QueueDeclareQuorum declares the quorum queue name and returns its state.
+// Quorum queues are always durable, and neither exclusive nor auto-deleted:
+// opts asking otherwise make it return ErrIncompatibleQueueOption without
+// declaring the queue.
+func (ad *Amqpx) QueueDeclareQuorum(name string, opts ...QueueOption) (amqp.Queue, error) {
+	spec := QueueSpec{Name: name, Durable: true}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	if err := checkQueueType(&spec, QueueTypeQuorum); err != nil {
+		return amqp.Queue{}, err
+	}
+	return ad.declareQueue(spec)
+}
+
+// checkQueueType sets the x-queue-type of spec to kind, checking first that
+// spec describes a durable queue that is neither exclusive nor auto-deleted,
+// as replicated queue types require.
+func checkQueueType(spec *QueueSpec, kind string) error {
+	fail := func(what string) error {
+		return fmt.Errorf("%w: %s queue %s cannot be %s", ErrIncompatibleQueueOption, kind, spec.Name, what)
+	}
+	switch {
+	case !spec.Durable:
+		return fail("transient")
+	case spec.Exclusive:
+		return fail("exclusive")
+	case spec.AutoDelete:
+		return fail("auto-deleted")
+	}
+	if t, ok := spec.Args["x-queue-type"]; ok && t != kind {
+		return fail(fmt.Sprintf("of type %v", t))
+	}
+	if spec.Args == nil {
+		spec.Args = amqp.Table{}
+	}
+	spec.Args["x-queue-type"] = kind
+	return nil
+}
+
+// DeliveryCount returns the number of failed deliveries of d counted by a
+// quorum queue in HeaderDeliveryCount, for the handlers given the delivery.
+// It is 0 on the first delivery and for other queue types.
+func DeliveryCount(d amqp.Delivery) int64 {
+	n, _ := tableInt(d.Headers, HeaderDeliveryCount)
+	return n
+}
@@ -0,0 +1,73 @@
+package amqpx
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckQueueType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec QueueSpec
+		err  string
+	}{
+		{name: "durable", spec: QueueSpec{Name: "q", Durable: true}},
+		{name: "transient", spec: QueueSpec{Name: "q"}, err: "quorum queue q cannot be transient"},
+		{name: "exclusive", spec: QueueSpec{Name: "q", Durable: true, Exclusive: true}, err: "cannot be exclusive"},
+		{name: "auto-delete", spec: QueueSpec{Name: "q", Durable: true, AutoDelete: true}, err: "cannot be auto-deleted"},
+		{name: "other type", spec: QueueSpec{Name: "q", Durable: true, Args: amqp.Table{"x-queue-type": "classic"}}, err: "cannot be of type classic"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkQueueType(&tc.spec, QueueTypeQuorum)
+			if tc.err != "" {
+				require.ErrorIs(t, err, ErrIncompatibleQueueOption)
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, QueueTypeQuorum, tc.spec.Args["x-queue-type"])
+		})
+	}
+}
+
+func TestDeliveryCount(t *testing.T) {
+	require.Zero(t, DeliveryCount(amqp.Delivery{}))
+	require.Equal(t, int64(2), DeliveryCount(amqp.Delivery{Headers: amqp.Table{HeaderDeliveryCount: int64(2)}}))
+}
+
+func TestQueueDeclareQuorum(t *testing.T) {
+	const queue = "test_queue_declare_quorum"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, _ = cli.QueueDelete(queue, false, false)
+	defer cli.QueueDelete(queue, false, false)
+
+	_, err = cli.QueueDeclareQuorum(queue, WithQueueAutoDelete())
+	require.ErrorIs(t, err, ErrIncompatibleQueueOption)
+	require.False(t, cli.channel.IsClosed(), "refused before reaching the broker")
+
+	_, err = cli.QueueDeclareQuorum(queue, WithDeliveryLimit(5), WithQuorumInitialGroupSize(1))
+	require.NoError(t, err)
+	require.NoError(t, cli.Publish("", queue, []byte("quorum")))
+
+	var dely amqp.Delivery
+	require.Eventually(t, func() bool {
+		d, ok, err := cli.channel.Get(queue, false)
+		dely = d
+		return err == nil && ok
+	}, time.Second*5, time.Millisecond*50)
+	require.Zero(t, DeliveryCount(dely))
+	require.NoError(t, dely.Nack(false, true))
+
+	require.Eventually(t, func() bool {
+		d, ok, err := cli.channel.Get(queue, true)
+		dely = d
+		return err == nil && ok
+	}, time.Second*5, time.Millisecond*50)
+	require.Equal(t, int64(1), DeliveryCount(dely))
+}
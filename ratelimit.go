@@ -0,0 +1,111 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithRateLimit limits the entry to handling at most perSecond deliveries per
+// second on average, with bursts of up to burst deliveries. The limit is shared
+// by all workers of the entry. A delivery waiting for the limiter when the
+// consumer stops, or the entry is removed, paused or restarted by the
+// watchdog, is nacked with requeue.
+//
+// AddFunc and friends fail with ErrInvalidOption if perSecond is not positive.
+func WithRateLimit(perSecond float64, burst int) EntryOption {
+	return func(e *entry) {
+		if !(perSecond > 0) {
+			e.invalid = fmt.Errorf("%w: WithRateLimit(%v, %d)", ErrInvalidOption, perSecond, burst)
+			return
+		}
+		e.limiter = newTokenBucket(perSecond, burst)
+	}
+}
+
+// tokenBucket is a token bucket rate limiter.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // bucket capacity
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := &tokenBucket{
+		rate:  rate,
+		burst: float64(max(burst, 1)),
+		now:   time.Now,
+	}
+	b.tokens = b.burst
+	b.last = b.now()
+	return b
+}
+
+// reserve takes a token and returns how long the caller must wait before using it.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// release returns a reserved token that was not used.
+func (b *tokenBucket) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	d := b.reserve()
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.release()
+		return ctx.Err()
+	}
+}
+
+// setUnwait registers cancel as the function interrupting the rate limiter
+// waits of the new subscription of e, calling it right away if e was removed
+// or paused meanwhile.
+func (e *entry) setUnwait(cancel func()) {
+	e.mu.Lock()
+	e.unwait = cancel
+	paused := e.paused
+	e.mu.Unlock()
+
+	if paused || e.removed() {
+		cancel()
+	}
+}
+
+// stopWaiting interrupts the rate limiter waits of the current subscription of
+// e, whose deliveries are then nacked with requeue.
+func (e *entry) stopWaiting() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.unwait != nil {
+		e.unwait()
+	}
+}
@@ -0,0 +1,74 @@
+package amqpx
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(10, 2)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	require.Zero(t, b.reserve())
+	require.Zero(t, b.reserve())
+	require.Equal(t, time.Millisecond*100, b.reserve())
+
+	now = now.Add(time.Millisecond * 300)
+	require.Zero(t, b.reserve())
+}
+
+func TestTokenBucketWaitCancelled(t *testing.T) {
+	b := newTokenBucket(0.1, 1)
+	require.NoError(t, b.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	require.ErrorIs(t, b.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestWithRateLimitInvalid(t *testing.T) {
+	ac := &AmqpxConsumer{entries: map[string]*entry{}}
+	noop := func(amqp.Delivery) error { return nil }
+
+	for _, perSecond := range []float64{0, -1, math.NaN()} {
+		_, err := ac.AddDeliveryFunc("orders", "c", noop, WithRateLimit(perSecond, 10))
+		require.ErrorIs(t, err, ErrInvalidOption, "%v per second", perSecond)
+	}
+	tag, err := ac.AddDeliveryFunc("orders", "c", noop, WithRateLimit(0.5, 1))
+	require.NoError(t, err)
+	require.NotNil(t, ac.entries[tag].limiter)
+}
+
+func TestRateLimitWaitInterrupted(t *testing.T) {
+	ac := &AmqpxConsumer{entries: map[string]*entry{}}
+	tag, err := ac.AddDeliveryFunc("orders", "c", func(amqp.Delivery) error { return nil }, WithRateLimit(0.01, 1))
+	require.NoError(t, err)
+	e := ac.entries[tag]
+	require.NoError(t, e.limiter.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.setUnwait(cancel)
+	waited := make(chan error, 1)
+	go func() { waited <- e.limiter.Wait(ctx) }()
+
+	require.NoError(t, ac.Pause(tag))
+	select {
+	case err := <-waited:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("Pause left the delivery waiting for the next token")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	e.setUnwait(cancel)
+	require.Error(t, ctx.Err(), "a paused entry does not wait")
+}
@@ -0,0 +1,171 @@
+package amqpx
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// recovery records the declarations made through an Amqpx, see
+// EnableTopologyRecovery.
+type recovery struct {
+	mu      sync.Mutex
+	enabled bool
+	decls   []declaration // in the order they were first made
+	onError func(err error)
+}
+
+// declaration is an exchange, queue or binding recorded for recovery.
+type declaration struct {
+	key     string   // identifies the element, redeclaring it replaces it
+	refs    []string // keys of the exchanges and queues a binding depends on
+	declare func(ch *amqp.Channel) error
+}
+
+// EnableTopologyRecovery makes ad remember the exchanges, queues and bindings
+// it successfully declares from now on, and declare them again, in the same
+// order, every time redial re-establishes the channel. This restores the
+// transient and auto-deleted elements lost when the broker restarts, which
+// consumers would otherwise fail to subscribe to. Deleting or unbinding an
+// element through ad forgets it, together with the bindings of a deleted
+// exchange or queue. Queues named by the broker are not remembered, since
+// their names cannot be declared by clients.
+//
+// Declarations the broker refuses during recovery are reported to the
+// function set with OnTopologyRecoveryError, or logged.
+func (ad *Amqpx) EnableTopologyRecovery() {
+	ad.recovery.mu.Lock()
+	defer ad.recovery.mu.Unlock()
+
+	ad.recovery.enabled = true
+}
+
+// OnTopologyRecoveryError sets the function called with the declarations
+// refused by the broker while they are recovered after a reconnect, instead of
+// logging them.
+func (ad *Amqpx) OnTopologyRecoveryError(fn func(err error)) {
+	ad.recovery.mu.Lock()
+	defer ad.recovery.mu.Unlock()
+
+	ad.recovery.onError = fn
+}
+
+// remember records a successful declaration if recovery is enabled.
+func (ad *Amqpx) remember(d declaration) {
+	ad.recovery.mu.Lock()
+	defer ad.recovery.mu.Unlock()
+
+	if !ad.recovery.enabled {
+		return
+	}
+	for i := range ad.recovery.decls {
+		if ad.recovery.decls[i].key == d.key {
+			ad.recovery.decls[i] = d
+			return
+		}
+	}
+	ad.recovery.decls = append(ad.recovery.decls, d)
+}
+
+// forget removes the declaration key from the recorded ones, along with the
+// bindings depending on it.
+func (ad *Amqpx) forget(key string) {
+	ad.recovery.mu.Lock()
+	defer ad.recovery.mu.Unlock()
+
+	kept := ad.recovery.decls[:0]
+	for _, d := range ad.recovery.decls {
+		if d.key != key && !slices.Contains(d.refs, key) {
+			kept = append(kept, d)
+		}
+	}
+	clear(ad.recovery.decls[len(kept):])
+	ad.recovery.decls = kept
+}
+
+// recoverTopology declares again the recorded declarations, after the channel
+// was re-established.
+func (ad *Amqpx) recoverTopology() {
+	ad.recovery.mu.Lock()
+	decls := append([]declaration(nil), ad.recovery.decls...)
+	onError := ad.recovery.onError
+	ad.recovery.mu.Unlock()
+
+	if len(decls) == 0 {
+		return
+	}
+	a := &applier{ad: ad}
+	defer a.close()
+	for _, d := range decls {
+		ch, err := a.channel()
+		if err == nil {
+			err = d.declare(ch)
+		}
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("amqpd recover %s err: %w", d.key, err)
+		if onError != nil {
+			onError(err)
+		} else {
+			log.Printf("amqpd-redial: %s", err)
+		}
+	}
+}
+
+// exchangeDeclaration returns the declaration of the exchange spec.
+func exchangeDeclaration(spec ExchangeSpec) declaration {
+	return declaration{
+		key:     exchangeKey(spec.Name),
+		declare: func(ch *amqp.Channel) error { return declareExchangeOn(ch, spec) },
+	}
+}
+
+// queueDeclaration returns the declaration of the queue spec.
+func queueDeclaration(spec QueueSpec) declaration {
+	return declaration{
+		key: queueKey(spec.Name),
+		declare: func(ch *amqp.Channel) error {
+			_, err := declareQueueOn(ch, spec)
+			return err
+		},
+	}
+}
+
+// bindingDeclaration returns the declaration of the binding spec.
+func bindingDeclaration(spec BindingSpec) declaration {
+	return declaration{
+		key:     bindingKey(spec),
+		refs:    []string{queueKey(spec.Queue), exchangeKey(spec.Exchange)},
+		declare: func(ch *amqp.Channel) error { return bindOn(ch, spec) },
+	}
+}
+
+// exchangeBindingDeclaration returns the declaration of the binding of the
+// exchange destination to source.
+func exchangeBindingDeclaration(destination, key, source string, args amqp.Table) declaration {
+	return declaration{
+		key:  exchangeBindingKey(destination, key, source, args),
+		refs: []string{exchangeKey(destination), exchangeKey(source)},
+		declare: func(ch *amqp.Channel) error {
+			return ch.ExchangeBind(destination, key, source, false, args)
+		},
+	}
+}
+
+// exchangeKey, queueKey, bindingKey and exchangeBindingKey identify the
+// declarations of the elements they describe.
+func exchangeKey(name string) string { return "exchange " + name }
+
+func queueKey(name string) string { return "queue " + name }
+
+func bindingKey(spec BindingSpec) string {
+	return fmt.Sprintf("binding of queue %s to %s with key %q %v", spec.Queue, spec.Exchange, spec.Key, spec.Args)
+}
+
+func exchangeBindingKey(destination, key, source string, args amqp.Table) string {
+	return fmt.Sprintf("binding of exchange %s to %s with key %q %v", destination, source, key, args)
+}
@@ -0,0 +1,105 @@
+package amqpx
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryRegistry(t *testing.T) {
+	ad := &Amqpx{}
+	keys := func() []string {
+		var keys []string
+		for _, d := range ad.recovery.decls {
+			keys = append(keys, d.key)
+		}
+		return keys
+	}
+
+	ad.remember(queueDeclaration(QueueSpec{Name: "ignored"}))
+	require.Empty(t, keys(), "recovery not enabled")
+
+	ad.EnableTopologyRecovery()
+	ad.remember(exchangeDeclaration(ExchangeSpec{Name: "firehose", Kind: ExchangeTopic}))
+	ad.remember(exchangeDeclaration(ExchangeSpec{Name: "team", Kind: ExchangeFanout}))
+	ad.remember(queueDeclaration(QueueSpec{Name: "orders"}))
+	ad.remember(bindingDeclaration(BindingSpec{Queue: "orders", Exchange: "team"}))
+	ad.remember(exchangeBindingDeclaration("team", "orders.#", "firehose", nil))
+	ad.remember(queueDeclaration(QueueSpec{Name: "orders", Durable: true}))
+	require.Equal(t, []string{
+		"exchange firehose",
+		"exchange team",
+		"queue orders",
+		`binding of queue orders to team with key "" map[]`,
+		`binding of exchange team to firehose with key "orders.#" map[]`,
+	}, keys(), "redeclaring keeps the original order")
+
+	ad.forget(queueKey("orders"))
+	require.Equal(t, []string{"exchange firehose", "exchange team", `binding of exchange team to firehose with key "orders.#" map[]`}, keys())
+	ad.forget(exchangeBindingKey("team", "orders.#", "firehose", amqp.Table{}))
+	require.Equal(t, []string{"exchange firehose", "exchange team"}, keys())
+	ad.remember(exchangeBindingDeclaration("team", "orders.#", "firehose", nil))
+	ad.forget(exchangeKey("firehose"))
+	require.Equal(t, []string{"exchange team"}, keys())
+}
+
+func TestTopologyRecovery(t *testing.T) {
+	const (
+		exchange = "test_recovery_exchange"
+		queue    = "test_recovery_queue"
+		conflict = "test_recovery_conflict"
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	other, err := New()
+	require.NoError(t, err)
+	defer other.Close()
+	_, _ = other.QueueDelete(conflict, false, false)
+	defer other.QueueDelete(conflict, false, false)
+
+	failures := make(chan error, 4)
+	cli.EnableTopologyRecovery()
+	cli.OnTopologyRecoveryError(func(err error) { failures <- err })
+	require.NoError(t, cli.ExchangeDeclareWithOptions(exchange, ExchangeDirect, WithExchangeDurable(false)))
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false))
+	require.NoError(t, err)
+	require.NoError(t, cli.QueueBind(queue, "k", exchange))
+	_, err = cli.QueueDeclareWithOptions(conflict, WithQueueDurable(false))
+	require.NoError(t, err)
+
+	// Simulate a broker restart losing the transient elements, one of which
+	// is then declared differently by another application.
+	require.NoError(t, other.ExchangeDelete(exchange, false))
+	_, err = other.QueueDelete(queue, false, false)
+	require.NoError(t, err)
+	_, err = other.QueueDelete(conflict, false, false)
+	require.NoError(t, err)
+	_, err = other.QueueDeclareWithOptions(conflict, WithQueueArgs(amqp.Table{"x-max-length": int32(1)}))
+	require.NoError(t, err)
+	require.NoError(t, cli.channel.Close())
+
+	select {
+	case err := <-failures:
+		var de *DeclareError
+		require.ErrorAs(t, err, &de)
+		require.Equal(t, conflict, de.Name)
+	case <-time.After(time.Second * 5):
+		t.Fatal("refused declaration not reported")
+	}
+	require.Eventually(t, func() bool {
+		return cli.Publish(exchange, "k", []byte("recovered")) == nil
+	}, time.Second*5, time.Millisecond*50)
+	require.Eventually(t, func() bool {
+		info, err := cli.QueueInspect(queue)
+		return err == nil && info.Messages == 1
+	}, time.Second*5, time.Millisecond*50)
+
+	require.NoError(t, cli.ExchangeDelete(exchange, false))
+	_, err = cli.QueueDelete(queue, false, false)
+	require.NoError(t, err)
+	require.Len(t, cli.recovery.decls, 1, "deleted elements are forgotten")
+}
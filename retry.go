@@ -0,0 +1,251 @@
+package amqpx
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// WithMaxRetries limits how many times a failing delivery is retried. Once a
+// message has failed n times it is published to deadLetterExchange with
+// deadLetterKey, carrying its original headers plus HeaderError, HeaderRetryCount
+// and HeaderOriginalQueue, and the original delivery is acked.
+//
+// The attempt count is taken from the broker-maintained x-delivery-count
+// (quorum queues) and x-death headers when present, and otherwise from
+// HeaderRetryCount, which the consumer maintains by republishing the failed
+// message to the tail of its queue.
+func WithMaxRetries(n int, deadLetterExchange, deadLetterKey string) EntryOption {
+	return func(e *entry) {
+		e.maxRetries = n
+		e.dlExchange = deadLetterExchange
+		e.dlKey = deadLetterKey
+	}
+}
+
+// WithRetryDelay delays the redelivery of failed messages by d instead of
+// requeueing them immediately. A failed message is published, with an
+// incremented HeaderRetryCount, to a wait queue named after the queue and d,
+// e.g. "orders.retry.30s", whose messages expire after d and are then
+// dead-lettered back to the queue; the original delivery is acked.
+//
+// The wait queue is declared whenever the consumer subscribes. Combined with
+// WithMaxRetries, messages are dead-lettered once the limit is reached.
+func WithRetryDelay(d time.Duration) EntryOption {
+	return func(e *entry) {
+		e.retryDelays = []time.Duration{d}
+		e.retryLadder = false
+	}
+}
+
+// WithRetryLadder retries failed messages with increasing delays: the first
+// failure goes to the wait queue of delays[0], the second to that of delays[1]
+// and so on, see WithRetryDelay. After the last rung, the message is published
+// to the dead-letter queue of the queue, see DeadLetterQueueName. The topology
+// is declared with DeclareRetryTopology whenever the consumer subscribes.
+func WithRetryLadder(delays ...time.Duration) EntryOption {
+	return func(e *entry) {
+		e.retryDelays = delays
+		e.retryLadder = len(delays) > 0
+	}
+}
+
+// DeadLetterQueueName returns the name of the queue receiving the messages of
+// queue that failed on every rung of a retry ladder, "<queue>.dlq".
+func DeadLetterQueueName(queue string) string {
+	return queue + ".dlq"
+}
+
+// DeclareRetryTopology declares the wait queues retrying the messages of queue
+// after each of delays, see WithRetryLadder, and the durable queue dlqName,
+// DeadLetterQueueName(queue) if empty. It is idempotent.
+func (ad *Amqpx) DeclareRetryTopology(queue string, delays []time.Duration, dlqName string) error {
+	for _, d := range delays {
+		if err := ad.declareRetryQueue(queue, d); err != nil {
+			return err
+		}
+	}
+	if dlqName == "" {
+		dlqName = DeadLetterQueueName(queue)
+	}
+	_, err := ad.QueueDeclare(dlqName)
+	return err
+}
+
+// retryQueueName returns the name of the wait queue delaying the retries of
+// queue by d.
+func retryQueueName(queue string, d time.Duration) string {
+	return queue + ".retry." + durationName(d)
+}
+
+// durationName formats d in the largest unit that divides it, e.g. "30s" or "10m".
+func durationName(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
+
+// declareRetryQueue declares the wait queue delaying the retries of queue by d.
+func (ad *Amqpx) declareRetryQueue(queue string, d time.Duration) error {
+	name := retryQueueName(queue, d)
+	_, err := ad.channel.QueueDeclare(name, true, false, false, false, amqp.Table{
+		"x-message-ttl":             d.Milliseconds(),
+		"x-dead-letter-exchange":    DefaultExchange,
+		"x-dead-letter-routing-key": queue,
+	})
+	return ad.refused(declareError("queue", name, err))
+}
+
+// declareRetryTopology declares the wait queues, and the dead-letter queue of a
+// retry ladder, used by e.
+func (ac *AmqpxConsumer) declareRetryTopology(cli *Amqpx, e *entry) error {
+	if e.retryLadder {
+		return cli.DeclareRetryTopology(e.Queue, e.retryDelays, "")
+	}
+	for _, d := range e.retryDelays {
+		if err := cli.declareRetryQueue(e.Queue, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retry handles a failed delivery of an entry configured with WithMaxRetries,
+// WithRetryDelay or WithRetryLadder. The copy is published with confirms and
+// the mandatory flag, and the delivery acked once it is confirmed; it is
+// requeued if the copy is nacked, returned or not confirmed in time. It
+// reports whether the delivery will be delivered again, as opposed to
+// dead-lettered.
+func (ac *AmqpxConsumer) retry(e *entry, dely amqp.Delivery, cause error) (requeued bool) {
+	attempts := deliveryAttempts(dely, e.Queue) + 1
+
+	if e.maxRetries > 0 && attempts >= int64(e.maxRetries) {
+		return ac.deadLetter(e, dely, cause, attempts, e.dlExchange, e.dlKey)
+	}
+	if e.retryLadder && attempts > int64(len(e.retryDelays)) {
+		return ac.deadLetter(e, dely, cause, attempts, DefaultExchange, DeadLetterQueueName(e.Queue))
+	}
+
+	key := e.Queue
+	if n := len(e.retryDelays); n > 0 {
+		key = retryQueueName(e.Queue, e.retryDelays[min(attempts, int64(n))-1])
+	} else if _, ok := dely.Headers["x-delivery-count"]; ok {
+		// Quorum queues count redeliveries themselves.
+		ac.reject(e, dely, true)
+		return true
+	}
+	msg := deliveryToPublishing(dely)
+	msg.Headers[HeaderRetryCount] = attempts
+	msg.Headers[HeaderError] = cause.Error()
+	if err := ac.republish(DefaultExchange, key, msg); err != nil {
+		ac.channelError(e, "retry", err, &dely)
+		ac.reject(e, dely, true)
+		return true
+	}
+	ac.ack(e, dely)
+	return true
+}
+
+// deadLetter publishes dely to exchange with key once it failed for the last
+// time, then acks it once the copy is confirmed. It reports whether the
+// delivery will be delivered again, which only happens if the copy was
+// nacked, returned or not confirmed in time.
+func (ac *AmqpxConsumer) deadLetter(e *entry, dely amqp.Delivery, cause error, attempts int64, exchange, key string) (requeued bool) {
+	msg := deliveryToPublishing(dely)
+	msg.Headers[HeaderRetryCount] = attempts
+	msg.Headers[HeaderError] = cause.Error()
+	msg.Headers[HeaderOriginalQueue] = e.Queue
+	if err := ac.republish(exchange, key, msg); err != nil {
+		ac.channelError(e, "dead-letter", err, &dely)
+		ac.reject(e, dely, true)
+		return true
+	}
+	ac.ack(e, dely)
+	return false
+}
+
+// deliveryAttempts returns how many times dely has already failed, as recorded
+// by the broker (x-delivery-count, x-death) or by the consumer (HeaderRetryCount).
+func deliveryAttempts(dely amqp.Delivery, queue string) int64 {
+	var attempts int64
+	if n, ok := tableInt(dely.Headers, HeaderRetryCount); ok && n > attempts {
+		attempts = n
+	}
+	if n, ok := tableInt(dely.Headers, HeaderDeliveryCount); ok && n > attempts {
+		attempts = n
+	}
+	if deaths, ok := dely.Headers["x-death"].([]interface{}); ok {
+		var n int64
+		for _, d := range deaths {
+			death, ok := d.(amqp.Table)
+			if !ok || death["queue"] != queue {
+				continue
+			}
+			if c, ok := tableInt(death, "count"); ok {
+				n += c
+			}
+		}
+		if n > attempts {
+			attempts = n
+		}
+	}
+	return attempts
+}
+
+// tableInt reads an integer value of any width from an amqp.Table.
+func tableInt(t amqp.Table, key string) (int64, bool) {
+	switch v := t[key].(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// deliveryToPublishing copies the properties and body of dely into a new
+// amqp.Publishing with a private copy of the headers, less HeaderReturnID.
+func deliveryToPublishing(dely amqp.Delivery) amqp.Publishing {
+	headers := make(amqp.Table, len(dely.Headers)+3)
+	for k, v := range dely.Headers {
+		headers[k] = v
+	}
+	stripReturnID(headers)
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     dely.ContentType,
+		ContentEncoding: dely.ContentEncoding,
+		DeliveryMode:    dely.DeliveryMode,
+		Priority:        dely.Priority,
+		CorrelationId:   dely.CorrelationId,
+		ReplyTo:         dely.ReplyTo,
+		Expiration:      dely.Expiration,
+		MessageId:       dely.MessageId,
+		Timestamp:       dely.Timestamp,
+		Type:            dely.Type,
+		UserId:          dely.UserId,
+		AppId:           dely.AppId,
+		Body:            dely.Body,
+	}
+}
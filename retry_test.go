@@ -0,0 +1,121 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryAttempts(t *testing.T) {
+	const queue = "orders"
+
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int64
+	}{
+		{"no headers", nil, 0},
+		{"retry header", amqp.Table{HeaderRetryCount: int32(2)}, 2},
+		{"quorum delivery count", amqp.Table{"x-delivery-count": int64(3)}, 3},
+		{"x-death for queue", amqp.Table{"x-death": []interface{}{
+			amqp.Table{"queue": queue, "reason": "rejected", "count": int64(4)},
+			amqp.Table{"queue": "orders.retry", "reason": "expired", "count": int64(4)},
+		}}, 4},
+		{"x-death other queue", amqp.Table{"x-death": []interface{}{
+			amqp.Table{"queue": "other", "count": int64(7)},
+		}}, 0},
+		{"highest wins", amqp.Table{
+			HeaderRetryCount:   int64(1),
+			"x-delivery-count": int64(5),
+		}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, deliveryAttempts(amqp.Delivery{Headers: tt.headers}, queue))
+		})
+	}
+}
+
+func TestDeliveryToPublishingCopiesHeaders(t *testing.T) {
+	dely := amqp.Delivery{
+		Headers:       amqp.Table{"tenant": "acme", HeaderReturnID: "7"},
+		ContentType:   "application/json",
+		CorrelationId: "c-1",
+		Body:          []byte(`{}`),
+	}
+	msg := deliveryToPublishing(dely)
+	msg.Headers[HeaderError] = "boom"
+
+	require.Equal(t, "acme", msg.Headers["tenant"])
+	require.Equal(t, "application/json", msg.ContentType)
+	require.Equal(t, "c-1", msg.CorrelationId)
+	require.NotContains(t, dely.Headers, HeaderError)
+	require.NotContains(t, msg.Headers, HeaderReturnID, "the return id belongs to the original publisher")
+}
+
+func TestRetryQueueName(t *testing.T) {
+	require.Equal(t, "orders.retry.30s", retryQueueName("orders", time.Second*30))
+	require.Equal(t, "orders.retry.10m", retryQueueName("orders", time.Minute*10))
+	require.Equal(t, "orders.retry.2h", retryQueueName("orders", time.Hour*2))
+	require.Equal(t, "orders.retry.1500ms", retryQueueName("orders", time.Millisecond*1500))
+}
+
+func TestRetryDelay(t *testing.T) {
+	cli, sent := capturePublishes(nil)
+	ac := &AmqpxConsumer{ctx: context.Background(), cli: cli, errorHandler: func(string, string, error, []byte) {}}
+	e := &entry{Queue: "orders", tag: "orders-1"}
+	WithRetryDelay(time.Second * 30)(e)
+	ch := &recordingAcknowledger{}
+
+	dely := amqp.Delivery{Acknowledger: ch, DeliveryTag: 1, Headers: amqp.Table{"x-delivery-count": int64(1)}}
+	ac.settle(e, dely, errors.New("downstream unavailable"), 0)
+	require.Equal(t, []string{"ack 1 false"}, ch.ops)
+	require.Len(t, *sent, 1)
+	msg := (*sent)[0]
+	require.Equal(t, DefaultExchange, msg.Headers["exchange"])
+	require.Equal(t, "orders.retry.30s", msg.Headers["key"])
+	require.Equal(t, int64(2), msg.Headers[HeaderRetryCount])
+}
+
+func TestRetryLadder(t *testing.T) {
+	cli, sent := capturePublishes(nil)
+	ac := &AmqpxConsumer{ctx: context.Background(), cli: cli, errorHandler: func(string, string, error, []byte) {}}
+	e := &entry{Queue: "orders", tag: "orders-1"}
+	WithRetryLadder(time.Second*5, time.Minute, time.Minute*10)(e)
+	ch := &recordingAcknowledger{}
+
+	for attempt := 0; attempt < 4; attempt++ {
+		dely := amqp.Delivery{Acknowledger: ch, DeliveryTag: 1, Headers: amqp.Table{HeaderRetryCount: int64(attempt)}}
+		ac.settle(e, dely, errors.New("boom"), 0)
+	}
+	require.Len(t, *sent, 4)
+	var keys []interface{}
+	for _, msg := range *sent {
+		keys = append(keys, msg.Headers["key"])
+	}
+	require.Equal(t, []interface{}{"orders.retry.5s", "orders.retry.1m", "orders.retry.10m", "orders.dlq"}, keys)
+	require.Equal(t, "orders", (*sent)[3].Headers[HeaderOriginalQueue])
+}
+
+func TestRetryUnroutable(t *testing.T) {
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	defer func() { <-ac.Stop().Done() }()
+	ac.errorHandler = func(string, string, error, []byte) {}
+	ch := &recordingAcknowledger{}
+
+	// The wait queue of the retry is not declared: no queue takes the copy.
+	e := &entry{Queue: "test_retry_unroutable", tag: "orders-1"}
+	WithRetryDelay(time.Second * 30)(e)
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 1}, errors.New("boom"), 0)
+	require.Equal(t, []string{"nack 1 false true"}, ch.ops, "a retry no queue took is not acked")
+
+	ch.ops = nil
+	WithMaxRetries(1, "amq.direct", "test.retry.nowhere")(e)
+	ac.settle(e, amqp.Delivery{Acknowledger: ch, DeliveryTag: 2}, errors.New("boom"), 0)
+	require.Equal(t, []string{"nack 2 false true"}, ch.ops, "a dead letter no queue took is not acked")
+}
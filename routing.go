@@ -0,0 +1,131 @@
+package amqpx
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxRoutingKeyLen is the length limit of routing keys and binding patterns,
+// in bytes, that of an AMQP short string.
+const maxRoutingKeyLen = 255
+
+// SetStrictRouting makes the publish methods of ad check routing keys with
+// ValidateRoutingKey, and its bind methods check binding keys with
+// ValidateTopicPattern, failing with ErrInvalidRoutingKey instead of sending
+// keys that would route nowhere. It is off by default.
+func (ad *Amqpx) SetStrictRouting(strict bool) {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	ad.strictRouting.Store(strict)
+	ad.resetChain()
+}
+
+// ValidateRoutingKey checks that key can be published with: at most 255 bytes
+// of UTF-8 without control characters, made of words separated by dots, none
+// of them empty. The wildcards * and # are refused: topic exchanges match them
+// literally in routing keys, so they are nearly always a binding pattern used
+// by mistake. The empty key is valid.
+func ValidateRoutingKey(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if strings.ContainsAny(key, "*#") {
+		return fmt.Errorf("%w: %q: wildcards are only valid in binding patterns", ErrInvalidRoutingKey, key)
+	}
+	return nil
+}
+
+// ValidateTopicPattern checks that pattern is a valid topic binding key: at
+// most 255 bytes of UTF-8 without control characters, made of words separated
+// by dots, none of them empty, each word being either * (exactly one word), #
+// (zero or more words), or free of both. A wildcard within a word, as in
+// "order*", is matched literally by the broker and refused.
+func ValidateTopicPattern(pattern string) error {
+	if err := checkKey(pattern); err != nil {
+		return err
+	}
+	for _, word := range strings.Split(pattern, ".") {
+		if word != "*" && word != "#" && strings.ContainsAny(word, "*#") {
+			return fmt.Errorf("%w: %q: wildcard within the word %q", ErrInvalidRoutingKey, pattern, word)
+		}
+	}
+	return nil
+}
+
+// checkKey checks the length, characters and words of a routing key or
+// binding pattern.
+func checkKey(key string) error {
+	switch {
+	case key == "":
+		return nil
+	case len(key) > maxRoutingKeyLen:
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrInvalidRoutingKey, len(key), maxRoutingKeyLen)
+	case !utf8.ValidString(key):
+		return fmt.Errorf("%w: %q: not UTF-8", ErrInvalidRoutingKey, key)
+	case strings.IndexFunc(key, unicode.IsControl) >= 0:
+		return fmt.Errorf("%w: %q: control character", ErrInvalidRoutingKey, key)
+	}
+	for _, word := range strings.Split(key, ".") {
+		if word == "" {
+			return fmt.Errorf("%w: %q: empty word", ErrInvalidRoutingKey, key)
+		}
+	}
+	return nil
+}
+
+// TopicMatches reports whether a topic exchange routes a message published
+// with the routing key key to a queue bound with pattern: the words of
+// pattern and key, separated by dots, must match one by one, * matching
+// exactly one word and # zero or more. It helps asserting which queues receive
+// a key without a broker:
+//
+//	TopicMatches("order.*.created", "order.eu.created") // true
+//	TopicMatches("order.*", "order.eu.created")         // false
+//	TopicMatches("order.#", "order")                    // true
+func TopicMatches(pattern, key string) bool {
+	return matchWords(topicWords(pattern), topicWords(key))
+}
+
+// topicWords splits a routing key or pattern into words, the empty key having
+// none, as the broker does.
+func topicWords(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ".")
+}
+
+// matchWords reports whether the words of a pattern match those of a key.
+func matchWords(pattern, key []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			// Consecutive # match as one.
+			for len(pattern) > 0 && pattern[0] == "#" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range key {
+				if matchWords(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(key) == 0 {
+				return false
+			}
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
@@ -0,0 +1,78 @@
+package amqpx
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRoutingKey(t *testing.T) {
+	for _, key := range []string{"", "orders", "order.eu.created", "amq.gen-JzTY20BRgKO", "commande.créée"} {
+		require.NoError(t, ValidateRoutingKey(key), key)
+	}
+	for _, key := range []string{"order.*", "order.#", "order..created", ".order", "order.", "tab\tkey", "\xff", strings.Repeat("k", 256)} {
+		require.ErrorIs(t, ValidateRoutingKey(key), ErrInvalidRoutingKey, key)
+	}
+}
+
+func TestValidateTopicPattern(t *testing.T) {
+	for _, pattern := range []string{"", "#", "*", "order.*.created", "order.#", "#.created", "*.*.#"} {
+		require.NoError(t, ValidateTopicPattern(pattern), pattern)
+	}
+	for _, pattern := range []string{"order*", "order.#created", "order..*", "*.", strings.Repeat("k", 256)} {
+		require.ErrorIs(t, ValidateTopicPattern(pattern), ErrInvalidRoutingKey, pattern)
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.created", "order.deleted", false},
+		{"order.*.created", "order.eu.created", true},
+		{"order.*.created", "order.created", false},
+		{"order.*.created", "order.eu.fr.created", false},
+		{"order.*", "order.eu.created", false},
+		{"order.#", "order", true},
+		{"order.#", "order.eu.created", true},
+		{"order.#", "orders", false},
+		{"#.created", "order.eu.created", true},
+		{"#.created", "created", true},
+		{"order.#.created", "order.created", true},
+		{"order.#.created", "order.eu.fr.created", true},
+		{"order.#.created", "order.eu.fr.deleted", false},
+		{"#.#", "order", true},
+		{"#", "", true},
+		{"*", "", false},
+		{"", "", true},
+		{"", "order", false},
+		{"*.#.*", "order", false},
+		{"*.#.*", "order.created", true},
+	} {
+		require.Equal(t, tc.match, TopicMatches(tc.pattern, tc.key), "%q %q", tc.pattern, tc.key)
+	}
+}
+
+func TestStrictRouting(t *testing.T) {
+	ad := &Amqpx{}
+	var sent []string
+	publish := func(key string) error {
+		return ad.chain(func(_ context.Context, _, key string, _ *amqp.Publishing) error {
+			sent = append(sent, key)
+			return nil
+		})(context.Background(), "ex", key, &amqp.Publishing{})
+	}
+
+	require.NoError(t, publish("order.*"), "keys are not checked by default")
+	ad.SetStrictRouting(true)
+	require.ErrorIs(t, publish("order.#"), ErrInvalidRoutingKey)
+	require.NoError(t, publish("order.created"))
+	require.Equal(t, []string{"order.*", "order.created"}, sent)
+
+	require.ErrorIs(t, ad.QueueBind("orders", "order*", "events"), ErrInvalidRoutingKey, "checked before binding")
+}
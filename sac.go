@@ -0,0 +1,48 @@
+package amqpx
+
+import amqp "github.com/rabbitmq/amqp091-go"
+
+// WithSingleActiveConsumer makes the broker deliver the messages of the queue
+// to a single of its consumers at a time, in order, failing over to another
+// one when it goes away. See WithSingleActive for the consumer side.
+func WithSingleActiveConsumer() QueueOption {
+	return WithQueueArgs(amqp.Table{"x-single-active-consumer": true})
+}
+
+// WithSingleActive tracks whether the entry is the active consumer of a queue
+// declared WithSingleActiveConsumer. AMQP does not tell consumers whether they
+// are active, so the entry considers itself on standby every time it
+// subscribes, and active from its first delivery on: an active consumer of an
+// empty queue is therefore reported on standby until a message arrives.
+// onStandby is called when the entry subscribes without being known to be
+// active, onActive when it receives its first delivery; either may be nil.
+// EntryInfo.Standby reports the current state.
+func WithSingleActive(onActive, onStandby func()) EntryOption {
+	return func(e *entry) {
+		e.single = true
+		e.onActive = func(active bool) {
+			switch {
+			case active && onActive != nil:
+				onActive()
+			case !active && onStandby != nil:
+				onStandby()
+			}
+		}
+	}
+}
+
+// standby reports whether e waits to become the active consumer of its queue,
+// with WithSingleActive or WithExclusive.
+func (e *entry) standby() bool {
+	state := e.exclState.Load()
+	return state == exclusiveStandby || e.single && state != exclusiveActive
+}
+
+// received records a delivery to e, which makes a WithSingleActive entry the
+// active consumer of its queue.
+func (e *entry) received() {
+	e.stats.recordDelivery()
+	if e.single && e.exclState.Load() != exclusiveActive {
+		e.setActive(true)
+	}
+}
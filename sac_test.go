@@ -0,0 +1,76 @@
+package amqpx
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSingleActive(t *testing.T) {
+	var active, standby int
+	e := &entry{}
+	WithSingleActive(func() { active++ }, func() { standby++ })(e)
+
+	require.True(t, e.standby(), "standby until told otherwise")
+	e.setActive(false) // subscribed
+	require.Equal(t, 1, standby)
+	e.received()
+	e.received()
+	require.Equal(t, 1, active, "active from the first delivery on")
+	require.False(t, e.standby())
+	require.Nil(t, e.stats.status.Load(), "the status is left to the subscription")
+
+	e.setActive(false) // subscribed again
+	require.Equal(t, 2, standby)
+}
+
+func TestSingleActiveConsumer(t *testing.T) {
+	const queue = "test_single_active_consumer"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, _ = cli.QueueDelete(queue, false, false)
+	defer cli.QueueDelete(queue, false, false)
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithSingleActiveConsumer())
+	require.NoError(t, err)
+
+	var received [2]atomic.Int32
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	for i := range received {
+		_, err = ac.AddFunc(queue, "test-sac-consumer", func([]byte) error {
+			received[i].Add(1)
+			return nil
+		}, WithSingleActive(nil, nil))
+		require.NoError(t, err)
+	}
+	require.NoError(t, ac.Start())
+	defer ac.StopContext(context.Background())
+	require.Eventually(t, func() bool {
+		for _, info := range ac.Entries() {
+			if info.Status != StatusRunning || !info.Standby {
+				return false
+			}
+		}
+		return true
+	}, time.Second*5, time.Millisecond*50, "both on standby until a delivery")
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, cli.Publish(DefaultExchange, queue, []byte("ordered")))
+	}
+	require.Eventually(t, func() bool {
+		return received[0].Load()+received[1].Load() == 5
+	}, time.Second*5, time.Millisecond*50)
+	require.Zero(t, received[0].Load()*received[1].Load(), "a single consumer received everything")
+	standby := 0
+	for _, info := range ac.Entries() {
+		if info.Standby {
+			standby++
+		}
+	}
+	require.Equal(t, 1, standby)
+}
@@ -0,0 +1,119 @@
+package amqpx
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// QueueTypeStream is the x-queue-type of a stream.
+const QueueTypeStream = "stream"
+
+// HeaderStreamOffset is the header holding the offset of a message delivered
+// from a stream.
+const HeaderStreamOffset = "x-stream-offset"
+
+// StreamOption configures a stream declared by QueueDeclareStream.
+type StreamOption func(*QueueSpec)
+
+// WithStreamMaxLengthBytes sets the size in bytes beyond which the oldest
+// segments of the stream are discarded.
+func WithStreamMaxLengthBytes(n int64) StreamOption {
+	return StreamOption(WithQueueArgs(amqp.Table{"x-max-length-bytes": n}))
+}
+
+// WithStreamMaxSegmentSizeBytes sets the size of the segment files of the
+// stream on disk, the unit in which its retention discards messages.
+func WithStreamMaxSegmentSizeBytes(n int64) StreamOption {
+	return StreamOption(WithQueueArgs(amqp.Table{"x-stream-max-segment-size-bytes": n}))
+}
+
+// WithStreamMaxAge sets the age, rounded down to the second, beyond which the
+// segments of the stream are discarded.
+func WithStreamMaxAge(d time.Duration) StreamOption {
+	return StreamOption(WithQueueArgs(amqp.Table{"x-max-age": fmt.Sprintf("%ds", int64(d.Seconds()))}))
+}
+
+// QueueDeclareStream declares the stream name and returns its state. Streams
+// keep their messages after they are consumed, for consumers to read from the
+// offset given with WithStreamOffset.
+func (ad *Amqpx) QueueDeclareStream(name string, opts ...StreamOption) (amqp.Queue, error) {
+	spec := QueueSpec{Name: name, Durable: true}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	if err := checkQueueType(&spec, QueueTypeStream); err != nil {
+		return amqp.Queue{}, err
+	}
+	return ad.declareQueue(spec)
+}
+
+// WithStreamOffset makes the entry consume a stream from offset: "first",
+// "last" or "next", an absolute offset as an integer, or the messages appended
+// since a time.Time. The offset is sent on every subscription, including after
+// the channel is re-established, so applications that checkpoint the offset of
+// the handled messages, see StreamOffset, should resume with a new entry.
+//
+// Streams are consumed with a prefetch count: AddFunc and friends fail with
+// ErrInvalidStreamOffset if neither WithPrefetch nor WithWorkers is given, or
+// if offset is of another type.
+func WithStreamOffset(offset any) EntryOption {
+	return func(e *entry) {
+		var err error
+		if e.streamOffset, err = streamOffset(offset); err != nil {
+			e.invalid = err
+		}
+	}
+}
+
+// streamOffset converts offset into an x-stream-offset argument.
+func streamOffset(offset any) (any, error) {
+	switch v := offset.(type) {
+	case string:
+		if v == "first" || v == "last" || v == "next" {
+			return v, nil
+		}
+	case int:
+		if v >= 0 {
+			return int64(v), nil
+		}
+	case int64:
+		if v >= 0 {
+			return v, nil
+		}
+	case uint64:
+		return int64(v), nil
+	case time.Time:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: %v, expected first, last, next, an offset or a time.Time", ErrInvalidStreamOffset, offset)
+}
+
+// consumeArgs returns the basic.consume arguments of e, including its stream
+// offset.
+func (e *entry) consumeArgs() amqp.Table {
+	if e.streamOffset == nil {
+		return e.args
+	}
+	args := make(amqp.Table, len(e.args)+1)
+	for k, v := range e.args {
+		args[k] = v
+	}
+	args[HeaderStreamOffset] = e.streamOffset
+	return args
+}
+
+// checkStream checks that an entry consuming a stream has a prefetch count.
+func (e *entry) checkStream() error {
+	if e.streamOffset == nil || max(e.prefetch, e.batchSize) > 0 || e.workers > 1 {
+		return nil
+	}
+	return fmt.Errorf("%w: consuming a stream requires WithPrefetch", ErrInvalidStreamOffset)
+}
+
+// StreamOffset returns the offset of d in the stream it was consumed from, for
+// the handlers given the delivery, and false for messages from other queues.
+func StreamOffset(d amqp.Delivery) (int64, bool) {
+	return tableInt(d.Headers, HeaderStreamOffset)
+}
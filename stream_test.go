@@ -0,0 +1,69 @@
+package amqpx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithStreamOffset(t *testing.T) {
+	ac := &AmqpxConsumer{entries: map[string]*entry{}}
+	noop := func(amqp.Delivery) error { return nil }
+
+	_, err := ac.AddDeliveryFunc("stream", "c", noop, WithStreamOffset("first"))
+	require.ErrorIs(t, err, ErrInvalidStreamOffset, "no prefetch")
+	_, err = ac.AddDeliveryFunc("stream", "c", noop, WithStreamOffset("middle"), WithPrefetch(10))
+	require.ErrorIs(t, err, ErrInvalidStreamOffset)
+	_, err = ac.AddDeliveryFunc("stream", "c", noop, WithStreamOffset(-1), WithPrefetch(10))
+	require.ErrorIs(t, err, ErrInvalidStreamOffset)
+
+	since := time.Now()
+	for offset, want := range map[any]any{"next": "next", 42: int64(42), since: since} {
+		tag, err := ac.AddDeliveryFunc("stream", "c", noop, WithConsumeArgs(amqp.Table{"x-priority": 1}), WithStreamOffset(offset), WithPrefetch(10))
+		require.NoError(t, err)
+		e := ac.entries[tag]
+		require.Equal(t, amqp.Table{"x-priority": 1, HeaderStreamOffset: want}, e.consumeArgs())
+		require.Equal(t, amqp.Table{"x-priority": 1}, e.args, "WithConsumeArgs table left untouched")
+	}
+}
+
+func TestQueueDeclareStream(t *testing.T) {
+	const stream = "test_queue_declare_stream"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, _ = cli.QueueDelete(stream, false, false)
+	defer cli.QueueDelete(stream, false, false)
+
+	_, err = cli.QueueDeclareStream(stream, WithStreamMaxLengthBytes(1<<20), WithStreamMaxSegmentSizeBytes(1<<16), WithStreamMaxAge(time.Hour))
+	require.NoError(t, err)
+	for _, body := range []string{"a", "b", "c"} {
+		require.NoError(t, cli.Publish("", stream, []byte(body)))
+	}
+
+	offsets := make(chan int64, 3)
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddDeliveryFunc(stream, "test-stream-consumer", func(d amqp.Delivery) error {
+		offset, ok := StreamOffset(d)
+		require.True(t, ok)
+		offsets <- offset
+		return nil
+	}, WithStreamOffset("first"), WithPrefetch(10))
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer ac.StopContext(context.Background())
+
+	for want := int64(0); want < 3; want++ {
+		select {
+		case offset := <-offsets:
+			require.Equal(t, want, offset)
+		case <-time.After(time.Second * 5):
+			t.Fatal("stream not consumed from the first offset")
+		}
+	}
+}
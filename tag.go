@@ -0,0 +1,35 @@
+package amqpx
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ConsumerTagFunc builds the consumer tag of an entry from the consumer name
+// given to AddFunc and friends and a sequence number unique in the process.
+// The tags must be unique among the entries of an AmqpxConsumer.
+type ConsumerTagFunc func(base string, seq uint64) string
+
+// WithConsumerTagFunc sets how the consumer tags of the entries are built. The
+// default is DefaultConsumerTag.
+func WithConsumerTagFunc(f ConsumerTagFunc) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.tagFunc = f
+	}
+}
+
+// DefaultConsumerTag returns "<base>-<seq>".
+func DefaultConsumerTag(base string, seq uint64) string {
+	return base + "-" + strconv.FormatUint(seq, 10)
+}
+
+// HostConsumerTag returns "<base>-<hostname>-<pid>-<seq>", so that the consumers
+// listed by the management UI can be traced back to their process.
+func HostConsumerTag(base string, seq uint64) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%s-%d-%d", base, host, os.Getpid(), seq)
+}
@@ -0,0 +1,28 @@
+package amqpx
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerTagFunc(t *testing.T) {
+	ac := &AmqpxConsumer{entries: make(map[string]*entry)}
+	WithConsumerTagFunc(func(base string, _ uint64) string { return "pod-a." + base })(ac)
+
+	tag, err := ac.AddFunc("orders", "billing", func([]byte) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, "pod-a.billing", tag)
+	require.Equal(t, tag, ac.entries[tag].tag)
+
+	_, err = ac.AddFunc("orders", "billing", func([]byte) error { return nil })
+	require.ErrorIs(t, err, ErrDuplicateConsumer)
+}
+
+func TestHostConsumerTag(t *testing.T) {
+	host, _ := os.Hostname()
+	require.Equal(t, fmt.Sprintf("billing-%s-%d-7", host, os.Getpid()), HostConsumerTag("billing", 7))
+	require.Equal(t, "billing-7", DefaultConsumerTag("billing", 7))
+}
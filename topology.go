@@ -0,0 +1,462 @@
+package amqpx
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// QueueSpec describes a queue to declare.
+type QueueSpec struct {
+	Name       string     `json:"name" yaml:"name"`
+	Durable    bool       `json:"durable,omitempty" yaml:"durable,omitempty"`
+	AutoDelete bool       `json:"auto_delete,omitempty" yaml:"auto_delete,omitempty"`
+	Exclusive  bool       `json:"exclusive,omitempty" yaml:"exclusive,omitempty"`
+	NoWait     bool       `json:"no_wait,omitempty" yaml:"no_wait,omitempty"`
+	Args       amqp.Table `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// QueueOption configures a queue declared by QueueDeclareWithOptions.
+type QueueOption func(*QueueSpec)
+
+// WithQueueDurable sets whether the queue survives a broker restart, true by
+// default.
+func WithQueueDurable(durable bool) QueueOption {
+	return func(s *QueueSpec) { s.Durable = durable }
+}
+
+// WithQueueAutoDelete makes the broker delete the queue once its last consumer
+// unsubscribes.
+func WithQueueAutoDelete() QueueOption {
+	return func(s *QueueSpec) { s.AutoDelete = true }
+}
+
+// WithQueueExclusive makes the queue usable only by the connection declaring
+// it, and deleted when the connection closes.
+func WithQueueExclusive() QueueOption {
+	return func(s *QueueSpec) { s.Exclusive = true }
+}
+
+// WithQueueNoWait declares the queue without waiting for the broker to confirm
+// it. Errors then close the channel instead of being returned.
+func WithQueueNoWait() QueueOption {
+	return func(s *QueueSpec) { s.NoWait = true }
+}
+
+// WithQueueArgs adds arguments such as x-message-ttl or x-dead-letter-exchange
+// to the queue. Later options override the arguments set by earlier ones.
+func WithQueueArgs(args amqp.Table) QueueOption {
+	return func(s *QueueSpec) {
+		if s.Args == nil {
+			s.Args = make(amqp.Table, len(args))
+		}
+		for k, v := range args {
+			s.Args[k] = v
+		}
+	}
+}
+
+// WithMaxPriority makes the queue a priority queue, delivering the messages
+// with a higher priority, set by WithPriority, first. n is the highest
+// priority it distinguishes; RabbitMQ advises to keep it under 10. Handlers
+// given the delivery read its priority in amqp.Delivery.Priority.
+func WithMaxPriority(n uint8) QueueOption {
+	return WithQueueArgs(amqp.Table{"x-max-priority": int32(n)})
+}
+
+// QueueDeclareWithOptions declares the queue name, durable unless opts say
+// otherwise, and returns its state. If the queue exists with other settings,
+// the broker refuses the declaration with a *DeclareError and closes the
+// channel, which redial then re-establishes.
+func (ad *Amqpx) QueueDeclareWithOptions(name string, opts ...QueueOption) (amqp.Queue, error) {
+	spec := QueueSpec{Name: name, Durable: true}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	return ad.declareQueue(spec)
+}
+
+// ExchangeSpec describes an exchange to declare.
+type ExchangeSpec struct {
+	Name       string     `json:"name" yaml:"name"`
+	Kind       string     `json:"kind" yaml:"kind"` // ExchangeDirect, ExchangeFanout, ExchangeTopic, ExchangeHeaders or a plugin type
+	Durable    bool       `json:"durable,omitempty" yaml:"durable,omitempty"`
+	AutoDelete bool       `json:"auto_delete,omitempty" yaml:"auto_delete,omitempty"`
+	Internal   bool       `json:"internal,omitempty" yaml:"internal,omitempty"`
+	NoWait     bool       `json:"no_wait,omitempty" yaml:"no_wait,omitempty"`
+	Args       amqp.Table `json:"args,omitempty" yaml:"args,omitempty"`
+	CustomKind bool       `json:"custom_kind,omitempty" yaml:"custom_kind,omitempty"` // allow a plugin type, set by WithCustomKind
+}
+
+// ExchangeOption configures an exchange declared by ExchangeDeclareWithOptions.
+type ExchangeOption func(*ExchangeSpec)
+
+// WithExchangeDurable sets whether the exchange survives a broker restart,
+// true by default.
+func WithExchangeDurable(durable bool) ExchangeOption {
+	return func(s *ExchangeSpec) { s.Durable = durable }
+}
+
+// WithExchangeAutoDelete makes the broker delete the exchange once its last
+// binding is removed.
+func WithExchangeAutoDelete() ExchangeOption {
+	return func(s *ExchangeSpec) { s.AutoDelete = true }
+}
+
+// WithExchangeInternal makes the exchange accept messages only from other
+// exchanges, not from publishers.
+func WithExchangeInternal() ExchangeOption {
+	return func(s *ExchangeSpec) { s.Internal = true }
+}
+
+// WithExchangeNoWait declares the exchange without waiting for the broker to
+// confirm it. Errors then close the channel instead of being returned.
+func WithExchangeNoWait() ExchangeOption {
+	return func(s *ExchangeSpec) { s.NoWait = true }
+}
+
+// WithExchangeArgs adds arguments such as alternate-exchange to the exchange.
+// Later options override the arguments set by earlier ones.
+func WithExchangeArgs(args amqp.Table) ExchangeOption {
+	return func(s *ExchangeSpec) {
+		if s.Args == nil {
+			s.Args = make(amqp.Table, len(args))
+		}
+		for k, v := range args {
+			s.Args[k] = v
+		}
+	}
+}
+
+// WithAlternateExchange makes the exchange pass the messages it cannot route
+// to any queue to the exchange name, instead of dropping them or returning
+// them to mandatory publishers.
+func WithAlternateExchange(name string) ExchangeOption {
+	return WithExchangeArgs(amqp.Table{"alternate-exchange": name})
+}
+
+// WithCustomKind allows the kind of the exchange to be an "x-" type provided
+// by a broker plugin, such as ExchangeDelayed or "x-consistent-hash".
+func WithCustomKind() ExchangeOption {
+	return func(s *ExchangeSpec) { s.CustomKind = true }
+}
+
+// ExchangeDeclareWithOptions declares the exchange name of type kind, durable
+// unless opts say otherwise. kind must be one of the standard types unless
+// WithCustomKind is given, otherwise ErrUnknownExchangeKind is returned before
+// the broker closes the connection over it. If the exchange exists with other
+// settings, the broker refuses the declaration with a *DeclareError and closes
+// the channel, which redial then re-establishes.
+func (ad *Amqpx) ExchangeDeclareWithOptions(name, kind string, opts ...ExchangeOption) error {
+	spec := ExchangeSpec{Name: name, Kind: kind, Durable: true}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	return ad.declareExchange(spec)
+}
+
+// declareExchange declares the exchange described by spec.
+func (ad *Amqpx) declareExchange(spec ExchangeSpec) error {
+	if err := declareExchangeOn(ad.channel, spec); err != nil {
+		return ad.refused(err)
+	}
+	ad.remember(exchangeDeclaration(spec))
+	return nil
+}
+
+// declareExchangeOn declares the exchange described by spec on ch.
+func declareExchangeOn(ch *amqp.Channel, spec ExchangeSpec) error {
+	if err := checkExchangeKind(spec.Kind, spec.CustomKind); err != nil {
+		return err
+	}
+	err := ch.ExchangeDeclare(spec.Name, spec.Kind, spec.Durable, spec.AutoDelete, spec.Internal, spec.NoWait, spec.Args)
+	return declareError("exchange", spec.Name, err)
+}
+
+// checkExchangeKind checks that kind is a standard exchange type, or a plugin
+// one if custom is set.
+func checkExchangeKind(kind string, custom bool) error {
+	switch kind {
+	case ExchangeDirect, ExchangeFanout, ExchangeTopic, ExchangeHeaders:
+		return nil
+	}
+	if custom && strings.HasPrefix(kind, "x-") {
+		return nil
+	}
+	if strings.HasPrefix(kind, "x-") {
+		return fmt.Errorf("%w: %q is a plugin type, declare it with WithCustomKind", ErrUnknownExchangeKind, kind)
+	}
+	return fmt.Errorf("%w: %q, expected direct, fanout, topic, headers or an x- plugin type", ErrUnknownExchangeKind, kind)
+}
+
+// BindingSpec describes a binding of a queue to an exchange.
+type BindingSpec struct {
+	Queue    string     `json:"queue" yaml:"queue"`
+	Exchange string     `json:"exchange" yaml:"exchange"`
+	Key      string     `json:"key,omitempty" yaml:"key,omitempty"`
+	Args     amqp.Table `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// MatchAll returns the arguments binding a queue to a headers exchange for the
+// messages carrying all of headers with the same values.
+func MatchAll(headers map[string]any) amqp.Table {
+	return match("all", headers)
+}
+
+// MatchAny returns the arguments binding a queue to a headers exchange for the
+// messages carrying at least one of headers with the same value.
+func MatchAny(headers map[string]any) amqp.Table {
+	return match("any", headers)
+}
+
+// match builds the arguments of a headers exchange binding.
+func match(mode string, headers map[string]any) amqp.Table {
+	args := make(amqp.Table, len(headers)+1)
+	for k, v := range headers {
+		args[k] = v
+	}
+	args["x-match"] = mode
+	return args
+}
+
+// WithDeclare declares queue and its bindings before every subscription of the
+// entry, so that the consumer does not depend on another process declaring
+// them first and recreates them after a broker restart. The name of queue is
+// ignored in favor of the queue of the entry, which is also the default queue
+// of the bindings.
+func WithDeclare(queue QueueSpec, bindings ...BindingSpec) EntryOption {
+	return func(e *entry) {
+		e.declare = &queue
+		e.bindings = bindings
+	}
+}
+
+// QueueDelete deletes the queue name and returns the number of messages it
+// held. With ifUnused or ifEmpty, the broker refuses to delete a queue that has
+// consumers or messages, and closes the channel. The consumers of a deleted
+// queue are cancelled by the broker, which AmqpxConsumer reports through the
+// OnCancel hook and handles according to WithCancelPolicy.
+func (ad *Amqpx) QueueDelete(name string, ifUnused, ifEmpty bool) (int, error) {
+	n, err := ad.channel.QueueDelete(name, ifUnused, ifEmpty, false)
+	if err == nil {
+		ad.forget(queueKey(name))
+		ad.forgetEphemeralQueue(name)
+	}
+	return n, err
+}
+
+// QueuePurge removes the messages of the queue name that are not awaiting an
+// acknowledgement, and returns their number.
+func (ad *Amqpx) QueuePurge(name string) (int, error) {
+	return ad.channel.QueuePurge(name, false)
+}
+
+// QueueUnbind removes the binding of the queue name to exchange with the
+// routing key and arguments it was bound with.
+func (ad *Amqpx) QueueUnbind(name, key, exchange string, args amqp.Table) error {
+	if err := ad.channel.QueueUnbind(name, key, exchange, args); err != nil {
+		return err
+	}
+	ad.forget(bindingKey(BindingSpec{Queue: name, Exchange: exchange, Key: key, Args: args}))
+	return nil
+}
+
+// ExchangeDelete deletes the exchange name and its bindings. With ifUnused, the
+// broker refuses to delete an exchange that is still bound to a queue or
+// another exchange, and closes the channel.
+func (ad *Amqpx) ExchangeDelete(name string, ifUnused bool) error {
+	if err := ad.channel.ExchangeDelete(name, ifUnused, false); err != nil {
+		return fmt.Errorf("amqpd delete exchange %s err: %w", name, err)
+	}
+	ad.forget(exchangeKey(name))
+	return nil
+}
+
+// ExchangeBind routes the messages published to the exchange source with a
+// routing key matching key to the exchange destination, as QueueBind does for
+// a queue. args are the binding arguments, such as x-match for a headers
+// exchange. Like the other declarations, the binding is restored after a
+// reconnect once EnableTopologyRecovery is called.
+func (ad *Amqpx) ExchangeBind(destination, key, source string, args amqp.Table) error {
+	if err := ad.channel.ExchangeBind(destination, key, source, false, args); err != nil {
+		return fmt.Errorf("amqpd bind exchange %s to %s err: %w", destination, source, err)
+	}
+	ad.remember(exchangeBindingDeclaration(destination, key, source, args))
+	return nil
+}
+
+// ExchangeUnbind removes the binding of the exchange destination to source
+// with the routing key and arguments it was bound with.
+func (ad *Amqpx) ExchangeUnbind(destination, key, source string, args amqp.Table) error {
+	if err := ad.channel.ExchangeUnbind(destination, key, source, false, args); err != nil {
+		return fmt.Errorf("amqpd unbind exchange %s from %s err: %w", destination, source, err)
+	}
+	ad.forget(exchangeBindingKey(destination, key, source, args))
+	return nil
+}
+
+// QueueInfo is the state of a queue reported by the broker.
+type QueueInfo struct {
+	Name      string
+	Messages  int // messages ready for delivery, not those awaiting an acknowledgement
+	Consumers int
+}
+
+// QueueInspect returns the state of the queue name without declaring it, or
+// an error matching ErrQueueNotFound if it does not exist. The check runs on a
+// throwaway channel, so that a missing queue does not close the channel shared
+// with consumers and publishers.
+func (ad *Amqpx) QueueInspect(name string) (QueueInfo, error) {
+	var q amqp.Queue
+	err := ad.throwaway(func(ch *amqp.Channel) (err error) {
+		q, err = ch.QueueDeclarePassive(name, false, false, false, false, nil)
+		return err
+	})
+	var ae *amqp.Error
+	if errors.As(err, &ae) && ae.Code == amqp.NotFound {
+		return QueueInfo{}, fmt.Errorf("%w: %s", ErrQueueNotFound, name)
+	}
+	if err != nil {
+		return QueueInfo{}, fmt.Errorf("amqpd inspect queue %s err: %w", name, err)
+	}
+	return QueueInfo{Name: q.Name, Messages: q.Messages, Consumers: q.Consumers}, nil
+}
+
+// ExchangeExists reports whether the exchange name exists, checking on a
+// throwaway channel like QueueInspect. kind is sent along with the check, but
+// RabbitMQ does not compare it with the type of an existing exchange.
+func (ad *Amqpx) ExchangeExists(name, kind string) (bool, error) {
+	err := ad.throwaway(func(ch *amqp.Channel) error {
+		return ch.ExchangeDeclarePassive(name, kind, false, false, false, false, nil)
+	})
+	var ae *amqp.Error
+	if errors.As(err, &ae) && ae.Code == amqp.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("amqpd check exchange %s err: %w", name, err)
+	}
+	return true, nil
+}
+
+// declareQueue declares the queue described by spec.
+func (ad *Amqpx) declareQueue(spec QueueSpec) (amqp.Queue, error) {
+	q, err := ad.declareQueueWith(ad.channel, spec)
+	return q, ad.refused(err)
+}
+
+// declareQueueWith is declareQueue on the channel ch.
+func (ad *Amqpx) declareQueueWith(ch *amqp.Channel, spec QueueSpec) (amqp.Queue, error) {
+	q, err := declareQueueOn(ch, spec)
+	if err != nil {
+		return q, err
+	}
+	if spec.Name != "" {
+		ad.remember(queueDeclaration(spec))
+	}
+	if rejects(spec.Args) {
+		ad.rejectOnFull(route{key: q.Name}, q.Name)
+	}
+	return q, nil
+}
+
+// declareQueueOn declares the queue described by spec on ch.
+func declareQueueOn(ch *amqp.Channel, spec QueueSpec) (amqp.Queue, error) {
+	if err := checkOverflow(spec.Args); err != nil {
+		return amqp.Queue{}, err
+	}
+	q, err := ch.QueueDeclare(spec.Name, spec.Durable, spec.AutoDelete, spec.Exclusive, spec.NoWait, spec.Args)
+	return q, declareError("queue", spec.Name, err)
+}
+
+// inequivalentArg extracts the argument named in the reply text of a
+// PRECONDITION_FAILED raised by a mismatched declaration.
+var inequivalentArg = regexp.MustCompile(`inequivalent arg '([^']+)'`)
+
+// declareError wraps the PRECONDITION_FAILED raised by the declaration of the
+// entity name of the given kind in a *DeclareError.
+func declareError(kind, name string, err error) error {
+	var ae *amqp.Error
+	if !errors.As(err, &ae) || ae.Code != amqp.PreconditionFailed {
+		return err
+	}
+	de := &DeclareError{Kind: kind, Name: name, Code: ae.Code, Reason: ae.Reason}
+	if m := inequivalentArg.FindStringSubmatch(ae.Reason); m != nil {
+		de.Arg = m[1]
+	}
+	return de
+}
+
+// declareRecoveryTimeout bounds how long refused waits for the channel.
+const declareRecoveryTimeout = 5 * time.Second
+
+// refused returns err, the result of a declaration on the channel of ad, once
+// the channel closed by a *DeclareError is re-established by redial, or after
+// declareRecoveryTimeout if the connection is down too.
+func (ad *Amqpx) refused(err error) error {
+	var de *DeclareError
+	if !errors.As(err, &de) {
+		return err
+	}
+	select {
+	case <-ad.channelReady():
+	case <-ad.stop:
+	case <-time.After(declareRecoveryTimeout):
+	}
+	return err
+}
+
+// bind declares the binding described by spec.
+func (ad *Amqpx) bind(spec BindingSpec) error {
+	return ad.bindWith(ad.channel, spec)
+}
+
+// bindWith is bind on the channel ch.
+func (ad *Amqpx) bindWith(ch *amqp.Channel, spec BindingSpec) error {
+	if ad.strictRouting.Load() {
+		if err := ValidateTopicPattern(spec.Key); err != nil {
+			return err
+		}
+	}
+	if err := bindOn(ch, spec); err != nil {
+		return err
+	}
+	ad.remember(bindingDeclaration(spec))
+	ad.fullMu.Lock()
+	queue, full := ad.fullRoutes[route{key: spec.Queue}]
+	ad.fullMu.Unlock()
+	if full {
+		ad.rejectOnFull(route{exchange: spec.Exchange}, queue)
+	}
+	return nil
+}
+
+// bindOn declares the binding described by spec on ch.
+func bindOn(ch *amqp.Channel, spec BindingSpec) error {
+	return ch.QueueBind(spec.Queue, spec.Key, spec.Exchange, false, spec.Args)
+}
+
+// declareTopology declares the queue and bindings given to WithDeclare for e.
+func (ac *AmqpxConsumer) declareTopology(cli *Amqpx, e *entry) error {
+	if e.declare == nil {
+		return nil
+	}
+	spec := *e.declare
+	spec.Name = e.Queue
+	if _, err := cli.declareQueue(spec); err != nil {
+		return err
+	}
+	for _, b := range e.bindings {
+		if b.Queue == "" {
+			b.Queue = e.Queue
+		}
+		if err := cli.bind(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmqpxConsumerWithDeclare(t *testing.T) {
+	const queue = "test_with_declare_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, _ = cli.channel.QueueDelete(queue, false, false, false)
+
+	received := make(chan string, 1)
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddFunc(queue, "test-with-declare-consumer", func(body []byte) error {
+		received <- string(body)
+		return nil
+	}, WithDeclare(QueueSpec{AutoDelete: true}, BindingSpec{Exchange: "amq.direct", Key: queue}))
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer ac.Stop()
+
+	require.Eventually(t, func() bool {
+		return ac.Entries()[0].Status == StatusRunning
+	}, time.Second*5, time.Millisecond*50)
+	require.NoError(t, cli.Publish("amq.direct", queue, []byte("declared")))
+
+	select {
+	case body := <-received:
+		require.Equal(t, "declared", body)
+	case <-time.After(time.Second * 5):
+		t.Fatal("no delivery on the declared queue")
+	}
+}
+
+func TestDeclareError(t *testing.T) {
+	reason := "PRECONDITION_FAILED - inequivalent arg 'x-message-ttl' for queue 'orders' in vhost '/': received the value '1000' of type 'signedint' but current is none"
+	err := declareError("queue", "orders", fmt.Errorf("wrapped: %w", &amqp.Error{Code: amqp.PreconditionFailed, Reason: reason}))
+	var de *DeclareError
+	require.ErrorAs(t, err, &de)
+	require.Equal(t, "x-message-ttl", de.Arg)
+	require.Equal(t, "orders", de.Name)
+	require.Contains(t, err.Error(), "queue orders exists with a different x-message-ttl")
+	require.ErrorIs(t, err, ErrDeclareMismatch)
+
+	other := errors.New("other")
+	require.Equal(t, other, declareError("queue", "orders", other))
+	require.NoError(t, declareError("queue", "orders", nil))
+}
+
+func TestQueueDeclareWithOptions(t *testing.T) {
+	const queue = "test_queue_declare_options"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, _ = cli.channel.QueueDelete(queue, false, false, false)
+
+	q, err := cli.QueueDeclareWithOptions(queue,
+		WithQueueDurable(false), WithQueueAutoDelete(),
+		WithQueueArgs(amqp.Table{"x-message-ttl": int32(60000)}), WithQueueArgs(amqp.Table{"x-max-length": int32(10)}))
+	require.NoError(t, err)
+	require.Equal(t, queue, q.Name)
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithQueueAutoDelete(),
+		WithQueueArgs(amqp.Table{"x-message-ttl": int32(60000), "x-max-length": int32(10)}))
+	require.NoError(t, err, "redeclaring with the same settings")
+
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithQueueAutoDelete(),
+		WithQueueArgs(amqp.Table{"x-message-ttl": int32(1000), "x-max-length": int32(10)}))
+	var de *DeclareError
+	require.ErrorAs(t, err, &de)
+	require.Equal(t, "x-message-ttl", de.Arg)
+	require.ErrorIs(t, err, ErrDeclareMismatch)
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithQueueAutoDelete(),
+		WithQueueArgs(amqp.Table{"x-message-ttl": int32(60000), "x-max-length": int32(10)}))
+	require.NoError(t, err, "the channel closed by the mismatch is re-established before it is returned")
+
+	select {
+	case <-cli.channelReady():
+	case <-time.After(time.Second * 5):
+		t.Fatal("channel not re-established")
+	}
+	_, err = cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, err)
+}
+
+func TestCheckExchangeKind(t *testing.T) {
+	for _, kind := range []string{ExchangeDirect, ExchangeFanout, ExchangeTopic, ExchangeHeaders} {
+		require.NoError(t, checkExchangeKind(kind, false))
+	}
+	require.ErrorIs(t, checkExchangeKind("topik", false), ErrUnknownExchangeKind)
+	require.ErrorIs(t, checkExchangeKind("topik", true), ErrUnknownExchangeKind)
+	require.ErrorContains(t, checkExchangeKind(ExchangeDelayed, false), "WithCustomKind")
+	require.NoError(t, checkExchangeKind(ExchangeDelayed, true))
+
+	// Rejected before reaching the channel.
+	require.ErrorIs(t, (&Amqpx{}).ExchangeDeclareWithOptions("ex", "fan-out"), ErrUnknownExchangeKind)
+}
+
+func TestExchangeDeclareWithOptions(t *testing.T) {
+	const exchange = "test_exchange_declare_options"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_ = cli.channel.ExchangeDelete(exchange, false, false)
+
+	opts := []ExchangeOption{WithExchangeDurable(false), WithExchangeInternal(), WithExchangeArgs(amqp.Table{"alternate-exchange": "amq.fanout"})}
+	require.NoError(t, cli.ExchangeDeclareWithOptions(exchange, ExchangeTopic, opts...))
+	require.NoError(t, cli.ExchangeDeclareWithOptions(exchange, ExchangeTopic, opts...), "redeclaring with the same settings")
+
+	err = cli.ExchangeDeclareWithOptions(exchange, ExchangeTopic)
+	var de *DeclareError
+	require.ErrorAs(t, err, &de)
+	require.Equal(t, "exchange", de.Kind)
+
+	select {
+	case <-cli.channelReady():
+	case <-time.After(time.Second * 5):
+		t.Fatal("channel not re-established")
+	}
+	require.NoError(t, cli.channel.ExchangeDelete(exchange, false, false))
+}
+
+func TestQueueDeletePurgeUnbind(t *testing.T) {
+	const queue = "test_queue_delete_purge"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	require.NoError(t, cli.QueueBind(queue, queue, "amq.direct"))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, cli.Publish("amq.direct", queue, []byte("body")))
+	}
+	require.Eventually(t, func() bool {
+		q, err := cli.channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+		return err == nil && q.Messages == 3
+	}, time.Second*2, time.Millisecond*20)
+	n, err := cli.QueuePurge(queue)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	require.NoError(t, cli.QueueUnbind(queue, queue, "amq.direct", nil))
+	require.NoError(t, cli.Publish("amq.direct", queue, []byte("unrouted")))
+
+	cancelled := make(chan string, 1)
+	ac, err := NewAmqpxConsumer(WithHooks(Hooks{OnCancel: func(queue, _ string) { cancelled <- queue }}))
+	require.NoError(t, err)
+	tag, err := ac.AddFunc(queue, "test-delete-consumer", func([]byte) error { return nil }, WithCancelPolicy(CancelFatal))
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer func() { <-ac.Stop().Done() }()
+	require.Eventually(t, func() bool {
+		status, _ := ac.Status(tag)
+		return status == StatusRunning
+	}, time.Second*2, time.Millisecond*20)
+
+	n, err = cli.QueueDelete(queue, false, false)
+	require.NoError(t, err)
+	require.Zero(t, n, "the message was published after the unbind")
+	select {
+	case q := <-cancelled:
+		require.Equal(t, queue, q)
+	case <-time.After(time.Second * 2):
+		t.Fatal("deletion not reported")
+	}
+}
+
+func TestExchangeBindUnbind(t *testing.T) {
+	const (
+		firehose = "test_exchange_bind_firehose"
+		team     = "test_exchange_bind_team"
+		queue    = "test_exchange_bind_queue"
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+
+	require.NoError(t, cli.ExchangeDeclareWithOptions(firehose, ExchangeTopic, WithExchangeDurable(false)))
+	require.NoError(t, cli.ExchangeDeclareWithOptions(team, ExchangeFanout, WithExchangeDurable(false)))
+	defer cli.ExchangeDelete(firehose, false)
+	defer cli.ExchangeDelete(team, false)
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithQueueAutoDelete())
+	require.NoError(t, err)
+	defer cli.QueueDelete(queue, false, false)
+	require.NoError(t, cli.QueueBind(queue, "", team))
+
+	require.NoError(t, cli.ExchangeBind(team, "orders.#", firehose, nil))
+	require.NoError(t, cli.Publish(firehose, "orders.created", []byte("routed")))
+	require.NoError(t, cli.Publish(firehose, "payments.created", []byte("dropped")))
+	require.Eventually(t, func() bool {
+		_, ok, err := cli.channel.Get(queue, true)
+		return err == nil && ok
+	}, time.Second*5, time.Millisecond*50)
+
+	require.NoError(t, cli.ExchangeUnbind(team, "orders.#", firehose, nil))
+	require.NoError(t, cli.Publish(firehose, "orders.created", []byte("unrouted")))
+	time.Sleep(time.Millisecond * 200)
+	n, err := cli.QueuePurge(queue)
+	require.NoError(t, err)
+	require.Zero(t, n, "only the routed message reaches the queue")
+
+	err = cli.ExchangeBind(team, "#", "test_exchange_bind_missing", nil)
+	require.ErrorContains(t, err, "test_exchange_bind_missing")
+	var ae *amqp.Error
+	require.ErrorAs(t, err, &ae)
+	require.Equal(t, amqp.NotFound, ae.Code)
+}
+
+func TestQueueInspect(t *testing.T) {
+	const queue = "test_queue_inspect"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithQueueAutoDelete())
+	require.NoError(t, err)
+	defer cli.QueueDelete(queue, false, false)
+
+	require.NoError(t, cli.Publish("", queue, []byte("one")))
+	require.NoError(t, cli.Publish("", queue, []byte("two")))
+	require.Eventually(t, func() bool {
+		info, err := cli.QueueInspect(queue)
+		return err == nil && info.Messages == 2 && info.Consumers == 0
+	}, time.Second*5, time.Millisecond*50)
+
+	_, err = cli.QueueInspect("test_queue_inspect_missing")
+	require.ErrorIs(t, err, ErrQueueNotFound)
+	ok, err := cli.ExchangeExists("amq.direct", ExchangeDirect)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = cli.ExchangeExists("test_exchange_exists_missing", ExchangeDirect)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.False(t, cli.channel.IsClosed(), "probes must not close the shared channel")
+}
+
+func TestMatchArgs(t *testing.T) {
+	headers := map[string]any{"format": "pdf", "type": "report"}
+	require.Equal(t, amqp.Table{"x-match": "all", "format": "pdf", "type": "report"}, MatchAll(headers))
+	require.Equal(t, amqp.Table{"x-match": "any", "format": "pdf", "type": "report"}, MatchAny(headers))
+	require.NotContains(t, headers, "x-match", "headers left untouched")
+}
+
+func TestQueueBindHeaders(t *testing.T) {
+	const (
+		exchange = "test_bind_headers_exchange"
+		all      = "test_bind_headers_all"
+		anyQueue = "test_bind_headers_any"
+	)
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	require.NoError(t, cli.ExchangeDeclareWithOptions(exchange, ExchangeHeaders, WithExchangeDurable(false)))
+	defer cli.ExchangeDelete(exchange, false)
+	headers := map[string]any{"format": "pdf", "type": "report"}
+	for queue, args := range map[string]amqp.Table{all: MatchAll(headers), anyQueue: MatchAny(headers)} {
+		_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithQueueAutoDelete())
+		require.NoError(t, err)
+		defer cli.QueueDelete(queue, false, false)
+		require.NoError(t, cli.QueueBindWithArgs(queue, "", exchange, args))
+	}
+
+	require.NoError(t, cli.Publish(exchange, "", []byte("both"), WithHeaders(amqp.Table{"format": "pdf", "type": "report"})))
+	require.NoError(t, cli.Publish(exchange, "", []byte("one"), WithHeaders(amqp.Table{"format": "pdf", "type": "log"})))
+	require.NoError(t, cli.Publish(exchange, "", []byte("none"), WithHeaders(amqp.Table{"format": "zip"})))
+
+	bodies := func(queue string, n int) []string {
+		var got []string
+		require.Eventually(t, func() bool {
+			d, ok, err := cli.channel.Get(queue, true)
+			if err == nil && ok {
+				got = append(got, string(d.Body))
+			}
+			return len(got) == n
+		}, time.Second*5, time.Millisecond*20)
+		return got
+	}
+	require.Equal(t, []string{"both"}, bodies(all, 1))
+	require.Equal(t, []string{"both", "one"}, bodies(anyQueue, 2))
+	info, err := cli.QueueInspect(anyQueue)
+	require.NoError(t, err)
+	require.Zero(t, info.Messages, "the message matching no header is not routed")
+}
+
+func TestPriorityQueue(t *testing.T) {
+	const queue = "test_priority_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, _ = cli.QueueDelete(queue, false, false)
+	defer cli.QueueDelete(queue, false, false)
+
+	_, err = cli.QueueDeclareWithOptions(queue, WithQueueDurable(false), WithMaxPriority(10))
+	require.NoError(t, err)
+	require.NoError(t, cli.EnableConfirms())
+	ctx := context.Background()
+	for i, priority := range []uint8{1, 1, 9, 5, 255} {
+		require.NoError(t, cli.PublishConfirm(ctx, DefaultExchange, queue, []byte(fmt.Sprint(i)), WithPriority(priority)))
+	}
+
+	priorities := make(chan uint8, 5)
+	ac, err := NewAmqpxConsumer()
+	require.NoError(t, err)
+	_, err = ac.AddDeliveryFunc(queue, "test-priority-consumer", func(d amqp.Delivery) error {
+		priorities <- d.Priority
+		return nil
+	}, WithPrefetch(1))
+	require.NoError(t, err)
+	require.NoError(t, ac.Start())
+	defer ac.StopContext(ctx)
+
+	var got []uint8
+	for len(got) < 5 {
+		select {
+		case p := <-priorities:
+			got = append(got, p)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("received %v", got)
+		}
+	}
+	require.Equal(t, []uint8{255, 9, 5, 1, 1}, got, "higher priorities overtake lower ones, 255 counting as 10")
+}
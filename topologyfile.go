@@ -0,0 +1,275 @@
+package amqpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the topology files read by LoadTopology.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// LoadTopology reads a Topology from r in the given format, FormatYAML or
+// FormatJSON. The file holds the lists "exchanges", "queues" and "bindings",
+// whose elements have the fields of ExchangeSpec, QueueSpec and BindingSpec in
+// snake case:
+//
+//	exchanges:
+//	  - name: events
+//	    kind: topic
+//	    durable: true
+//	queues:
+//	  - name: ${ENV}-orders
+//	    durable: true
+//	    args: {x-message-ttl: 60000}
+//	bindings:
+//	  - queue: ${ENV}-orders
+//	    exchange: events
+//	    key: orders.#
+//
+// As in the Go structs, elements are transient unless durable is set. In the
+// names and routing keys, ${NAME} is replaced with the environment variable
+// NAME, which must be set.
+//
+// The file is checked for unknown fields, unknown exchange kinds, duplicate
+// names, and bindings referencing a queue or exchange the file does not
+// declare, other than the default and amq.* exchanges. Every problem found is
+// reported with its line, in errors matching ErrInvalidTopology.
+func LoadTopology(r io.Reader, format string) (Topology, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Topology{}, err
+	}
+	switch format {
+	case FormatYAML, "yml":
+	case FormatJSON:
+		// JSON is parsed as YAML, of which it is a subset, for the lines.
+		// Syntax errors are reported by the JSON parser for accuracy.
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			var se *json.SyntaxError
+			if errors.As(err, &se) {
+				return Topology{}, fmt.Errorf("%w: line %d: %s", ErrInvalidTopology, 1+bytes.Count(data[:se.Offset], []byte("\n")), se)
+			}
+			return Topology{}, fmt.Errorf("%w: %s", ErrInvalidTopology, err)
+		}
+	default:
+		return Topology{}, fmt.Errorf("%w: unknown format %q, expected yaml or json", ErrInvalidTopology, format)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Topology{}, fmt.Errorf("%w: %s", ErrInvalidTopology, err)
+	}
+	l := &topologyLoader{exchanges: map[string]int{}, queues: map[string]int{}}
+	l.load(&doc)
+	return l.t, errors.Join(l.errs...)
+}
+
+// Marshal encodes t in the given format, FormatYAML or FormatJSON, as read by
+// LoadTopology.
+func (t Topology) Marshal(format string) ([]byte, error) {
+	switch format {
+	case FormatYAML, "yml":
+		return yaml.Marshal(t)
+	case FormatJSON:
+		return json.MarshalIndent(t, "", "  ")
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q, expected yaml or json", ErrInvalidTopology, format)
+	}
+}
+
+// topologyLoader decodes a topology file, collecting the problems found.
+type topologyLoader struct {
+	t         Topology
+	errs      []error
+	exchanges map[string]int // line of the declaration of each exchange
+	queues    map[string]int // line of the declaration of each queue
+}
+
+// errorf records a problem found on line.
+func (l *topologyLoader) errorf(line int, format string, v ...any) {
+	l.errs = append(l.errs, fmt.Errorf("%w: line %d: %s", ErrInvalidTopology, line, fmt.Sprintf(format, v...)))
+}
+
+// load decodes the document doc.
+func (l *topologyLoader) load(doc *yaml.Node) {
+	if len(doc.Content) == 0 {
+		return // empty file
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		l.errorf(root.Line, "expected a mapping of exchanges, queues and bindings")
+		return
+	}
+	var bindings []*yaml.Node
+	for i := 0; i < len(root.Content); i += 2 {
+		key, list := root.Content[i], root.Content[i+1]
+		if list.Kind != yaml.SequenceNode {
+			if list.Tag != "!!null" {
+				l.errorf(list.Line, "%s must be a list", key.Value)
+			}
+			continue
+		}
+		switch key.Value {
+		case "exchanges":
+			for _, n := range list.Content {
+				l.exchange(n)
+			}
+		case "queues":
+			for _, n := range list.Content {
+				l.queue(n)
+			}
+		case "bindings":
+			bindings = list.Content // checked against every declaration
+		default:
+			l.errorf(key.Line, "unknown field %q", key.Value)
+		}
+	}
+	for _, n := range bindings {
+		l.binding(n)
+	}
+}
+
+// exchange decodes the exchange declared by n.
+func (l *topologyLoader) exchange(n *yaml.Node) {
+	var spec ExchangeSpec
+	if !l.decode(n, &spec, "name") {
+		return
+	}
+	switch first, dup := l.exchanges[spec.Name]; {
+	case spec.Name == "":
+		l.errorf(n.Line, "exchange without a name")
+	case dup:
+		l.errorf(n.Line, "duplicate exchange %s, first declared on line %d", spec.Name, first)
+	default:
+		l.exchanges[spec.Name] = n.Line
+	}
+	if err := checkExchangeKind(spec.Kind, spec.CustomKind); err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%w: line %d: exchange %s: %w", ErrInvalidTopology, n.Line, spec.Name, err))
+	}
+	spec.Args = tableArgs(spec.Args)
+	l.t.Exchanges = append(l.t.Exchanges, spec)
+}
+
+// queue decodes the queue declared by n.
+func (l *topologyLoader) queue(n *yaml.Node) {
+	var spec QueueSpec
+	if !l.decode(n, &spec, "name") {
+		return
+	}
+	switch first, dup := l.queues[spec.Name]; {
+	case spec.Name == "":
+		l.errorf(n.Line, "queue without a name")
+	case dup:
+		l.errorf(n.Line, "duplicate queue %s, first declared on line %d", spec.Name, first)
+	default:
+		l.queues[spec.Name] = n.Line
+	}
+	spec.Args = tableArgs(spec.Args)
+	l.t.Queues = append(l.t.Queues, spec)
+}
+
+// binding decodes the binding declared by n.
+func (l *topologyLoader) binding(n *yaml.Node) {
+	var spec BindingSpec
+	if !l.decode(n, &spec, "queue", "exchange", "key") {
+		return
+	}
+	if _, ok := l.queues[spec.Queue]; !ok {
+		l.errorf(n.Line, "binding to exchange %q of undeclared queue %q", spec.Exchange, spec.Queue)
+	}
+	_, ok := l.exchanges[spec.Exchange]
+	if !ok && spec.Exchange != DefaultExchange && !strings.HasPrefix(spec.Exchange, "amq.") {
+		l.errorf(n.Line, "binding of queue %q to undeclared exchange %q", spec.Queue, spec.Exchange)
+	}
+	spec.Args = tableArgs(spec.Args)
+	l.t.Bindings = append(l.t.Bindings, spec)
+}
+
+// decode decodes the mapping n into the spec pointed to by v, after checking
+// its fields and expanding the environment variables of the fields named. It
+// reports whether n could be decoded.
+func (l *topologyLoader) decode(n *yaml.Node, v any, expand ...string) bool {
+	if n.Kind != yaml.MappingNode {
+		l.errorf(n.Line, "expected a mapping")
+		return false
+	}
+	fields := specFields(reflect.TypeOf(v).Elem())
+	for i := 0; i < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if !fields[key.Value] {
+			l.errorf(key.Line, "unknown field %q", key.Value)
+			continue
+		}
+		for _, name := range expand {
+			if key.Value == name {
+				value.Value = l.expand(value)
+			}
+		}
+	}
+	if err := n.Decode(v); err != nil {
+		l.errorf(n.Line, "%s", err)
+		return false
+	}
+	return true
+}
+
+// envVar matches the ${NAME} references to environment variables.
+var envVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expand replaces the environment variables referenced by the scalar n.
+func (l *topologyLoader) expand(n *yaml.Node) string {
+	return envVar.ReplaceAllStringFunc(n.Value, func(ref string) string {
+		name := envVar.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			l.errorf(n.Line, "environment variable %s is not set", name)
+		}
+		return value
+	})
+}
+
+// specFields returns the names of the fields of the spec type t in a file.
+func specFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		fields[name] = true
+	}
+	return fields
+}
+
+// tableArgs converts the nested maps decoded in args into the amqp.Table the
+// AMQP encoder expects.
+func tableArgs(args amqp.Table) amqp.Table {
+	for k, v := range args {
+		args[k] = tableValue(v)
+	}
+	return args
+}
+
+// tableValue converts v for tableArgs.
+func tableValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return tableArgs(amqp.Table(v))
+	case []any:
+		for i := range v {
+			v[i] = tableValue(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,99 @@
+package amqpx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+const topologyYAML = `exchanges:
+  - name: events
+    kind: topic
+    durable: true
+queues:
+  - name: ${AMQPX_TEST_ENV}-orders
+    durable: true
+    args:
+      x-message-ttl: 60000
+      x-dead-letter-exchange: events
+bindings:
+  - queue: ${AMQPX_TEST_ENV}-orders
+    exchange: events
+    key: orders.#
+  - queue: ${AMQPX_TEST_ENV}-orders
+    exchange: amq.headers
+    args: {x-match: all, nested: {a: 1}}
+`
+
+func TestLoadTopology(t *testing.T) {
+	t.Setenv("AMQPX_TEST_ENV", "prod")
+
+	topo, err := LoadTopology(strings.NewReader(topologyYAML), FormatYAML)
+	require.NoError(t, err)
+	require.Equal(t, Topology{
+		Exchanges: []ExchangeSpec{{Name: "events", Kind: ExchangeTopic, Durable: true}},
+		Queues: []QueueSpec{{Name: "prod-orders", Durable: true, Args: amqp.Table{
+			"x-message-ttl": 60000, "x-dead-letter-exchange": "events",
+		}}},
+		Bindings: []BindingSpec{
+			{Queue: "prod-orders", Exchange: "events", Key: "orders.#"},
+			{Queue: "prod-orders", Exchange: "amq.headers", Args: amqp.Table{"x-match": "all", "nested": amqp.Table{"a": 1}}},
+		},
+	}, topo)
+	for _, b := range topo.Bindings {
+		require.NoError(t, b.Args.Validate())
+	}
+
+	// The effective topology round-trips through both formats.
+	for _, format := range []string{FormatYAML, FormatJSON} {
+		data, err := topo.Marshal(format)
+		require.NoError(t, err)
+		again, err := LoadTopology(bytes.NewReader(data), format)
+		require.NoError(t, err, string(data))
+		require.Equal(t, topo, again)
+	}
+}
+
+func TestLoadTopologyErrors(t *testing.T) {
+	src := `exchanges:
+  - name: events
+    kind: topics
+  - name: events
+    kind: topic
+queues:
+  - name: orders
+    durabel: true
+  - name: orders
+  - name: ${AMQPX_TEST_UNSET}
+bindings:
+  - queue: invoices
+    exchange: events
+  - queue: orders
+    exchange: missing
+`
+	_, err := LoadTopology(strings.NewReader(src), FormatYAML)
+	require.ErrorIs(t, err, ErrInvalidTopology)
+	require.ErrorIs(t, err, ErrUnknownExchangeKind)
+	for _, want := range []string{
+		`line 2: exchange events: amqpx: unknown exchange kind: "topics"`,
+		"line 4: duplicate exchange events, first declared on line 2",
+		`line 8: unknown field "durabel"`,
+		"line 9: duplicate queue orders, first declared on line 7",
+		"line 10: environment variable AMQPX_TEST_UNSET is not set",
+		`line 12: binding to exchange "events" of undeclared queue "invoices"`,
+		`line 14: binding of queue "orders" to undeclared exchange "missing"`,
+	} {
+		require.ErrorContains(t, err, want)
+	}
+
+	_, err = LoadTopology(strings.NewReader("{\n  \"queues\": [\n    {\"name\": \"orders\",}\n  ]\n}"), FormatJSON)
+	require.ErrorIs(t, err, ErrInvalidTopology)
+	require.ErrorContains(t, err, "line 3:")
+	_, err = LoadTopology(strings.NewReader("{\n\t\"queues\": [\n\t\t{\"name\": \"orders\", \"exclusive\": true}\n\t]\n}"), FormatJSON)
+	require.NoError(t, err)
+	_, err = LoadTopology(strings.NewReader(""), "toml")
+	require.ErrorIs(t, err, ErrInvalidTopology)
+}
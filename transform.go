@@ -0,0 +1,52 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Transformer transforms message bodies on their way to and from the broker,
+// e.g. to encrypt them.
+type Transformer interface {
+	// Encode returns the body to publish in place of body. It may set
+	// properties of msg, such as headers needed by Decode.
+	Encode(body []byte, msg *amqp.Publishing) ([]byte, error)
+	// Decode returns the original body of a delivery encoded by Encode.
+	Decode(d amqp.Delivery) ([]byte, error)
+}
+
+// UseTransformer encodes the body of every message published through ad with
+// t. It is a publish interceptor, registered after the current ones.
+func (ad *Amqpx) UseTransformer(t Transformer) {
+	ad.UsePublishInterceptor(func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+			body, err := t.Encode(msg.Body, msg)
+			if err != nil {
+				return fmt.Errorf("amqpx: encode: %w", err)
+			}
+			msg.Body = body
+			return next(ctx, exchange, key, msg)
+		}
+	})
+}
+
+// WithTransformer decodes every delivery with t before the middleware and the
+// handler see it. Deliveries that fail to decode are reported to the error
+// handler and rejected without requeue, as retrying them cannot help. Batch
+// handlers receive the deliveries as they are.
+func WithTransformer(t Transformer) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.middlewares = append(ac.middlewares, func(next Handler) Handler {
+			return func(ctx context.Context, d amqp.Delivery) error {
+				body, err := t.Decode(d)
+				if err != nil {
+					return Drop(fmt.Errorf("amqpx: decode: %w", err))
+				}
+				d.Body = body
+				return next(ctx, d)
+			}
+		})
+	}
+}
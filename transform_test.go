@@ -0,0 +1,48 @@
+package amqpx
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAESGCM(t *testing.T) {
+	keys := StaticKeys{Current: "k1", Keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}}
+	var published amqp.Publishing
+	ad := &Amqpx{}
+	ad.UseTransformer(AESGCM{Keys: keys})
+	ad.UsePublishInterceptor(func(PublishFunc) PublishFunc {
+		return func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+			published = *msg
+			return nil
+		}
+	})
+	require.NoError(t, ad.Publish("ex", "key", []byte("secret")))
+	require.Equal(t, "k1", published.Headers[HeaderKeyID])
+	require.NotContains(t, string(published.Body), "secret")
+
+	var handled []byte
+	ac := &AmqpxConsumer{}
+	keys.Current = "k2" // rotation: messages encrypted with k1 still decrypt
+	WithTransformer(AESGCM{Keys: keys})(ac)
+	h := ac.handler(&entry{Handler: func(_ context.Context, d amqp.Delivery) error {
+		handled = d.Body
+		return nil
+	}})
+	d := amqp.Delivery{Headers: published.Headers, Body: published.Body}
+	require.NoError(t, h(context.Background(), d))
+	require.Equal(t, []byte("secret"), handled)
+
+	d.Body = append([]byte(nil), published.Body...)
+	d.Body[len(d.Body)-1] ^= 1
+	require.ErrorIs(t, h(context.Background(), d), ErrDropMessage)
+	d.Headers = amqp.Table{HeaderKeyID: "k2"} // the key id is authenticated
+	require.ErrorIs(t, h(context.Background(), amqp.Delivery{Headers: d.Headers, Body: published.Body}), ErrDropMessage)
+	require.ErrorIs(t, h(context.Background(), amqp.Delivery{Body: published.Body}), ErrDropMessage)
+}
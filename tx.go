@@ -0,0 +1,90 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AmqpxTx is an AMQP transaction: the messages published through it are
+// enqueued together by Commit, or discarded by Rollback.
+type AmqpxTx struct {
+	cli     *Amqpx
+	channel *amqp.Channel
+	publish PublishFunc // the interceptors of cli around send, without retries
+
+	mu   sync.Mutex
+	done bool
+}
+
+// Tx starts a transaction. It runs on a channel of its own, since the broker
+// refuses transactions on a channel in confirm mode, and so that an aborted
+// transaction does not disturb the consumers and publishers of ad. The
+// transaction must be finished by Commit or Rollback.
+func (ad *Amqpx) Tx() (*AmqpxTx, error) {
+	channel, err := ad.openChannel()
+	if err != nil {
+		return nil, fmt.Errorf("amqpd open channel err: %w", err)
+	}
+	if err := channel.Tx(); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("amqpd tx select err: %w", err)
+	}
+	tx := &AmqpxTx{cli: ad, channel: channel}
+	// A retry would only fail again on the closed channel of the transaction.
+	tx.publish = ad.pinned(tx.send)
+	return tx, nil
+}
+
+// Publish adds a message to the transaction, through the interceptors of the
+// Amqpx. The broker enqueues it on Commit. It is not retried as set by
+// SetPublishRetry: if the channel of the transaction was closed, Publish
+// fails at once and the transaction is lost.
+func (tx *AmqpxTx) Publish(exchange, key string, body []byte, opts ...PublishOption) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	msg := tx.cli.newPublishing(body, opts)
+	return tx.publish(context.Background(), exchange, key, msg)
+}
+
+// send is the innermost PublishFunc of the transaction.
+func (tx *AmqpxTx) send(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+	return tx.channel.PublishWithContext(ctx, exchange, key, false, false, *msg)
+}
+
+// Commit enqueues the messages of the transaction atomically and finishes it.
+func (tx *AmqpxTx) Commit() error {
+	return tx.finish("commit", tx.channel.TxCommit)
+}
+
+// Rollback discards the messages of the transaction and finishes it. Calling
+// Rollback after Commit does nothing, so it can be deferred.
+func (tx *AmqpxTx) Rollback() error {
+	err := tx.finish("rollback", tx.channel.TxRollback)
+	if err == ErrTxDone {
+		return nil
+	}
+	return err
+}
+
+// finish ends the transaction with op and closes its channel.
+func (tx *AmqpxTx) finish(name string, op func() error) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.channel.Close()
+	if err := op(); err != nil {
+		return fmt.Errorf("amqpd tx %s err: %w", name, err)
+	}
+	return nil
+}
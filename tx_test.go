@@ -0,0 +1,55 @@
+package amqpx
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTx(t *testing.T) {
+	const queue = "test_tx_queue"
+
+	cli, err := New()
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.QueueDeclare(queue)
+	require.NoError(t, err)
+	defer cli.channel.QueueDelete(queue, false, false, false)
+	require.NoError(t, cli.EnableConfirms(), "confirm mode does not prevent transactions")
+
+	messages := func() int {
+		q, err := cli.channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+		require.NoError(t, err)
+		return q.Messages
+	}
+
+	tx, err := cli.Tx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Publish(DefaultExchange, queue, []byte("one")))
+	require.NoError(t, tx.Publish(DefaultExchange, queue, []byte("two")))
+	require.Equal(t, 0, messages())
+	require.NoError(t, tx.Rollback())
+	require.Equal(t, 0, messages())
+	require.ErrorIs(t, tx.Publish(DefaultExchange, queue, []byte("late")), ErrTxDone)
+
+	tx, err = cli.Tx()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, tx.Publish(DefaultExchange, queue, []byte("one")))
+	require.NoError(t, tx.Publish(DefaultExchange, queue, []byte("two")))
+	require.NoError(t, tx.Commit())
+	require.Equal(t, 2, messages())
+	require.ErrorIs(t, tx.Commit(), ErrTxDone)
+
+	// A closed transaction channel fails at once, not after the retries.
+	cli.SetPublishRetry(3, ExponentialBackoff{InitialInterval: time.Second})
+	tx, err = cli.Tx()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, tx.channel.Close())
+	start := time.Now()
+	require.ErrorIs(t, tx.Publish(DefaultExchange, queue, []byte("lost")), amqp.ErrClosed)
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -15,3 +15,22 @@ const (
 	ExchangeTopic   = amqp.ExchangeTopic
 	ExchangeHeaders = amqp.ExchangeHeaders
 )
+
+// Headers set by the consumer when it republishes a failed delivery.
+const (
+	HeaderRetryCount    = "x-amqpx-retry-count"    // number of failed processing attempts
+	HeaderError         = "x-amqpx-error"          // error returned by the last attempt
+	HeaderOriginalQueue = "x-amqpx-original-queue" // queue the message was consumed from
+)
+
+// Headers set by the consumer when it quarantines a delivery whose handler panicked.
+const (
+	HeaderQuarantineReason = "x-quarantine-reason" // value of the recovered panic
+	HeaderQuarantineStack  = "x-quarantine-stack"  // beginning of the stack trace of the panic
+	HeaderQuarantinedAt    = "x-quarantine-time"   // when the delivery was quarantined
+)
+
+// HeaderReturnID is set by PublishMandatory to match a returned message with
+// the call that published it. Consumers remove it from deliveries before
+// handlers see them, and from the copies they republish.
+const HeaderReturnID = "x-amqpx-return-id"
@@ -0,0 +1,61 @@
+package amqpx
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Validator checks a message before it is written to the channel, after the
+// publish interceptors ran. A non-nil error aborts the publish and is returned
+// to the caller as is.
+type Validator func(exchange, key string, p *amqp.Publishing) error
+
+// SetMaxMessageSize makes the publish methods fail with ErrMessageTooLarge for
+// messages whose body, once the interceptors ran, is larger than size bytes.
+// Zero, the default, means unlimited.
+func (ad *Amqpx) SetMaxMessageSize(size int) {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	ad.maxMessageSize = size
+	ad.resetChain()
+}
+
+// SetValidator sets the Validator of the messages published through ad,
+// called after the size check of SetMaxMessageSize. A nil v removes it.
+func (ad *Amqpx) SetValidator(v Validator) {
+	ad.publishMu.Lock()
+	defer ad.publishMu.Unlock()
+
+	ad.validator = v
+	ad.resetChain()
+}
+
+// validating wraps p, the innermost PublishFunc, with the checks of
+// SetStrictRouting, SetMaxMessageSize and SetValidator, so that rejected
+// messages are neither written nor tracked for confirmation. It is called with
+// publishMu held.
+func (ad *Amqpx) validating(p PublishFunc) PublishFunc {
+	maxSize, validator, strict := ad.maxMessageSize, ad.validator, ad.strictRouting.Load()
+	if maxSize <= 0 && validator == nil && !strict {
+		return p
+	}
+	return func(ctx context.Context, exchange, key string, msg *amqp.Publishing) error {
+		if strict {
+			if err := ValidateRoutingKey(key); err != nil {
+				return err
+			}
+		}
+		if maxSize > 0 && len(msg.Body) > maxSize {
+			return fmt.Errorf("%w: %d bytes, limit %d", ErrMessageTooLarge, len(msg.Body), maxSize)
+		}
+		if validator != nil {
+			if err := validator(exchange, key, msg); err != nil {
+				return err
+			}
+		}
+		return p(ctx, exchange, key, msg)
+	}
+}
@@ -0,0 +1,56 @@
+package amqpx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishValidation(t *testing.T) {
+	ad := &Amqpx{}
+	var sent []string
+	publish := func(body string) error {
+		return ad.chain(func(_ context.Context, _, _ string, msg *amqp.Publishing) error {
+			sent = append(sent, string(msg.Body))
+			return nil
+		})(context.Background(), "ex", "key", &amqp.Publishing{Body: []byte(body)})
+	}
+
+	require.NoError(t, publish("unlimited by default"))
+
+	ad.SetMaxMessageSize(5)
+	require.NoError(t, publish("small"))
+	err := publish("too large")
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+	require.EqualError(t, err, "amqpx: message too large: 9 bytes, limit 5")
+
+	errForbidden := errors.New("forbidden exchange")
+	ad.SetValidator(func(exchange, _ string, p *amqp.Publishing) error {
+		if p.Type == "" {
+			return errForbidden
+		}
+		return nil
+	})
+	require.ErrorIs(t, publish("untyped"), ErrMessageTooLarge, "size is checked first")
+	require.ErrorIs(t, publish("none"), errForbidden)
+	require.Equal(t, []string{"unlimited by default", "small"}, sent)
+	require.Zero(t, ad.publishing.count())
+}
+
+func TestPublishAsyncValidation(t *testing.T) {
+	ad := &Amqpx{}
+	ad.confirms.Store(true)
+	tracker := &confirmTracker{pending: map[uint64]PublishedMessage{}}
+	ad.tracker.Store(tracker)
+	ad.SetMaxMessageSize(2)
+
+	// The tracker has no channel to write to, the message must be rejected
+	// before reaching it.
+	_, err := ad.PublishAsync("ex", "key", []byte("body"))
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+	require.Empty(t, tracker.pending)
+	require.Zero(t, ad.publishing.count())
+}
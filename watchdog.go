@@ -0,0 +1,85 @@
+package amqpx
+
+import (
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// WithWatchdog checks every interval that the running consumers still receive
+// deliveries. A consumer that has been subscribed for staleAfter without
+// receiving anything while its queue holds messages and none of its handlers
+// runs is considered stuck: it is cancelled and subscribes again, and the
+// OnRestart hook and the IncWatchdogRestart metric are fired. Idle queues are
+// never restarted since their depth is checked first, with a passive declare
+// on a throwaway channel of the consumer's connection, and neither are the
+// standby consumers of WithSingleActive and WithExclusive.
+func WithWatchdog(interval, staleAfter time.Duration) ConsumerOption {
+	return func(ac *AmqpxConsumer) {
+		ac.watchdogInterval = interval
+		ac.watchdogStaleAfter = staleAfter
+	}
+}
+
+// watchdog runs the checks of WithWatchdog until the consumer is stopped.
+func (ac *AmqpxConsumer) watchdog() {
+	ticker := time.NewTicker(ac.watchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ac.stopped:
+			return
+		case <-ticker.C:
+			ac.checkStale()
+		}
+	}
+}
+
+// checkStale restarts the consumers that look stuck.
+func (ac *AmqpxConsumer) checkStale() {
+	ac.runningMu.Lock()
+	var suspects []*entry
+	for _, e := range ac.entries {
+		if ac.entryStatus(e) == StatusRunning && !e.standby() && e.stats.stale(ac.now(), ac.watchdogStaleAfter) {
+			suspects = append(suspects, e)
+		}
+	}
+	ac.runningMu.Unlock()
+
+	for _, e := range suspects {
+		cli := ac.openedClient(e)
+		if cli == nil {
+			continue
+		}
+		// A passive declare of a missing queue closes the channel, keep it
+		// away from the consumer.
+		var q amqp.Queue
+		err := cli.throwaway(func(ch *amqp.Channel) (err error) {
+			q, err = ch.QueueDeclarePassive(e.Queue, true, false, false, false, nil)
+			return err
+		})
+		if err != nil {
+			ac.channelError(e, "watchdog", err, nil)
+			continue
+		}
+		if q.Messages == 0 {
+			continue
+		}
+		if err := cli.Cancel(e.tag); err != nil {
+			ac.channelError(e, "watchdog", err, nil)
+			continue
+		}
+		e.stopWaiting()
+		ac.onRestart(e)
+	}
+}
+
+// stale reports whether the entry has been subscribed for staleAfter without
+// receiving a delivery, and without a handler running.
+func (s *entryStats) stale(now time.Time, staleAfter time.Duration) bool {
+	if s.inflight.Load() > 0 {
+		return false
+	}
+	last := max(s.lastMessageAt.Load(), s.subscribedAt.Load())
+	return last != 0 && now.Sub(time.Unix(0, last)) >= staleAfter
+}
@@ -0,0 +1,33 @@
+package amqpx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryStatsStale(t *testing.T) {
+	var s entryStats
+	now := time.Now()
+	require.False(t, s.stale(now, time.Minute), "never subscribed")
+
+	s.subscribedAt.Store(now.Add(-2 * time.Minute).UnixNano())
+	require.True(t, s.stale(now, time.Minute))
+
+	s.lastMessageAt.Store(now.Add(-30 * time.Second).UnixNano())
+	require.False(t, s.stale(now, time.Minute))
+
+	s.lastMessageAt.Store(now.Add(-90 * time.Second).UnixNano())
+	s.inflight.Add(1)
+	require.False(t, s.stale(now, time.Minute), "a handler is running")
+}
+
+func TestEntryStandby(t *testing.T) {
+	e := &entry{}
+	require.False(t, e.standby())
+	e.setActive(false)
+	require.True(t, e.standby(), "refused by an exclusive queue")
+	e.setActive(true)
+	require.False(t, e.standby())
+}